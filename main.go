@@ -1,107 +1,20 @@
 package main
 
 import (
-	"context"
-	"fmt"
 	"log"
 	"os"
-	"os/signal"
-	"time"
 
-	"github.com/jackc/pgx/v5"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
-	"go.opentelemetry.io/otel/trace"
+	"github.com/bonnefoa/pg-tracing-otel-forwarder/pkg/forwarder"
 )
 
-func fatalIf(err error) {
-	if err != nil {
-		log.Fatalf("Error: %v", err)
-	}
-}
-
-type FixedIdGenerator struct {
-	FixedSpanID  trace.SpanID
-	FixedTraceID trace.TraceID
-}
-
-func (f *FixedIdGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
-	return f.FixedSpanID
-}
-
-func (f *FixedIdGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
-	return f.FixedTraceID, f.FixedSpanID
-}
-
-func initProvider(g *FixedIdGenerator) (func(context.Context) error, error) {
-	ctx := context.Background()
-
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("PostgreSQL-server"),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
-	defer cancel()
-	conn, err := grpc.DialContext(ctx, "localhost:4317",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC connection to collector: %w", err)
+func main() {
+	// Exemplars, an experimental feature of the metric SDK, are only
+	// enabled through the environment. Measurements only carry a span
+	// context with metrics.exemplars.
+	if _, ok := os.LookupEnv("OTEL_GO_X_EXEMPLAR"); !ok {
+		os.Setenv("OTEL_GO_X_EXEMPLAR", "true")
 	}
-
-	// Set up a trace exporter
-	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	if err := forwarder.Main(os.Args[1:]); err != nil {
+		log.Fatalf("Error: %v", err)
 	}
-
-	// Register the trace exporter with a TracerProvider, using a batch
-	// span processor to aggregate spans before export.
-	bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(bsp),
-		sdktrace.WithIDGenerator(g),
-	)
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-	return tracerProvider.Shutdown, nil
-}
-
-func main() {
-	log.Printf("Waiting for connection...")
-
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
-
-	fixedGenerator := FixedIdGenerator{}
-	shutdown, err := initProvider(&fixedGenerator)
-	fatalIf(err)
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TracerProvider: %w", err)
-		}
-	}()
-
-	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
-	fatalIf(err)
-	defer conn.Close(ctx)
-
-	tracer := otel.Tracer("pgtracing-tracer")
-	fetchSpans(ctx, conn, tracer, &fixedGenerator)
-	log.Printf("Done!")
 }
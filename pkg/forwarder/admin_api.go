@@ -0,0 +1,224 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	adminFlush  = "flush"
+	adminReload = "reload"
+)
+
+// adminRequest is an admin action executed by the forwarder's run loop
+type adminRequest struct {
+	action string
+	// cfg is the configuration applied by a reload
+	cfg  *Config
+	done chan error
+}
+
+// adminAPI serves the endpoints controlling a running forwarder
+type adminAPI struct {
+	token  []byte
+	pool   *targetPool
+	reload func() (*Config, error)
+}
+
+func readAdminToken(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read admin token file: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return nil, fmt.Errorf("admin token file %s is empty", path)
+	}
+	return []byte(token), nil
+}
+
+// startAdminServer serves the admin API on cfg.Listen. reload returns the
+// configuration applied by the reload endpoint.
+func startAdminServer(cfg AdminConfig, pool *targetPool, reload func() (*Config, error)) (func(context.Context), error) {
+	token, err := readAdminToken(cfg.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	api := &adminAPI{token: token, pool: pool, reload: reload}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pause", api.handle(api.pause))
+	mux.HandleFunc("/resume", api.handle(api.resume))
+	mux.HandleFunc("/flush", api.handle(api.flush))
+	mux.HandleFunc("/reload", api.handle(api.reloadConfig))
+	return serveHTTP("admin API", cfg.Listen, mux)
+}
+
+// handle checks the request's method and token before calling fn
+func (a *adminAPI) handle(fn func(*http.Request) (string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), a.token) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		status, err := fn(req)
+		if err != nil {
+			log.Printf("Admin %s failed: %v", req.URL.Path, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Admin %s: %s", req.URL.Path, status)
+		fmt.Fprintln(w, status)
+	}
+}
+
+// selected returns the targets an admin request applies to, all of them
+// unless the target query parameter names one
+func (a *adminAPI) selected(req *http.Request) ([]*target, error) {
+	targets := a.pool.targets()
+	name := req.URL.Query().Get("target")
+	if name == "" {
+		return targets, nil
+	}
+	for _, t := range targets {
+		if t.name == name {
+			return []*target{t}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown target %q", name)
+}
+
+func (a *adminAPI) pause(req *http.Request) (string, error) {
+	targets, err := a.selected(req)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range targets {
+		t.fw.paused.Store(true)
+	}
+	return "consumption paused", nil
+}
+
+func (a *adminAPI) resume(req *http.Request) (string, error) {
+	targets, err := a.selected(req)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range targets {
+		t.fw.paused.Store(false)
+	}
+	return "consumption resumed", nil
+}
+
+func (a *adminAPI) flush(req *http.Request) (string, error) {
+	targets, err := a.selected(req)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range targets {
+		if err := t.fw.submit(req.Context(), adminRequest{action: adminFlush}); err != nil {
+			return "", targetError(t.name, err)
+		}
+		if err := t.provider.ForceFlush(req.Context()); err != nil {
+			return "", targetError(t.name, fmt.Errorf("failed to flush exporters: %w", err))
+		}
+	}
+	return "spans flushed", nil
+}
+
+func (a *adminAPI) reloadConfig(req *http.Request) (string, error) {
+	targets, err := a.selected(req)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := a.reload()
+	if err != nil {
+		return "", err
+	}
+	// The targets are only reconciled when reloading all of them
+	if req.URL.Query().Get("target") == "" {
+		if err := a.pool.reload(req.Context(), cfg); err != nil {
+			return "", err
+		}
+		return "configuration reloaded", nil
+	}
+	for _, t := range targets {
+		if err := t.fw.submit(req.Context(), adminRequest{action: adminReload, cfg: cfg.forTarget(t.config)}); err != nil {
+			return "", targetError(t.name, err)
+		}
+	}
+	return "configuration reloaded", nil
+}
+
+// submit hands an admin request to the run loop and waits for its result
+func (fw *targetForwarder) submit(ctx context.Context, req adminRequest) error {
+	req.done = make(chan error, 1)
+	select {
+	case fw.admin <- req:
+	case <-fw.stopped:
+		return fmt.Errorf("forwarder is stopped")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleAdmin executes an admin request from the run loop
+func (fw *targetForwarder) handleAdmin(ctx context.Context, req adminRequest) error {
+	switch req.action {
+	case adminFlush:
+		fw.flush(ctx)
+		return nil
+	case adminReload:
+		return fw.applyConfig(req.cfg)
+	}
+	return fmt.Errorf("unknown admin action %q", req.action)
+}
+
+// applyConfig applies the conversion, clock, trace assembly, dedup and log
+// level settings of cfg. Other settings are only applied on restart.
+func (fw *targetForwarder) applyConfig(cfg *Config) error {
+	converter, err := newSpanConverter(cfg, fw.conn)
+	if err != nil {
+		return err
+	}
+	converter.stats = fw.stats
+	fw.converter = converter
+	fw.clock = cfg.Clock
+	fw.assembler.window = cfg.TraceAssembly.Window
+	fw.assembler.maxSpans = cfg.Buffer.MaxSpans
+	fw.assembler.dropOldest = cfg.Buffer.DropPolicy == dropOldest
+	fw.pgStatStatements = cfg.PgStatStatements && fw.query.hasColumn("query_id")
+	fw.query.logInterval = spanLogInterval(cfg)
+	if cfg.Dedup != fw.cfg.Dedup {
+		fw.dedup = nil
+		if cfg.Dedup.Size > 0 {
+			fw.dedup = newDedupCache(cfg.Dedup.Size, cfg.Dedup.TTL)
+		}
+	}
+	if !reflect.DeepEqual(cfg.Exporter, fw.cfg.Exporter) || !reflect.DeepEqual(cfg.Routes, fw.cfg.Routes) ||
+		!reflect.DeepEqual(cfg.Sinks, fw.cfg.Sinks) || !reflect.DeepEqual(cfg.Resource, fw.cfg.Resource) ||
+		cfg.HTTP != fw.cfg.HTTP || cfg.Admin != fw.cfg.Admin || cfg.OidCache != fw.cfg.OidCache ||
+		cfg.PollInterval != fw.cfg.PollInterval || cfg.SummaryInterval != fw.cfg.SummaryInterval ||
+		cfg.Connection != fw.cfg.Connection {
+		fw.log.Printf("Exporter, routes, sinks, resource, server, cache, interval and connection changes are only applied on restart")
+	}
+	fw.cfg = cfg
+	return nil
+}
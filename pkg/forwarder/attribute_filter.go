@@ -0,0 +1,59 @@
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Attribute families that can be selected in the configuration
+const (
+	familyProcess    = "process"
+	familyBlocks     = "blocks"
+	familyWal        = "wal"
+	familyJit        = "jit"
+	familyPlan       = "plan"
+	familyParameters = "parameters"
+)
+
+var attributeFamilies = []string{
+	familyProcess,
+	familyBlocks,
+	familyWal,
+	familyJit,
+	familyPlan,
+	familyParameters,
+}
+
+// AttributeFilter tells which attribute families should be exported
+type AttributeFilter struct {
+	enabled map[string]bool
+}
+
+func newAttributeFilter(cfg AttributesConfig) (*AttributeFilter, error) {
+	f := &AttributeFilter{enabled: make(map[string]bool, len(attributeFamilies))}
+	for _, family := range attributeFamilies {
+		f.enabled[family] = len(cfg.Include) == 0
+	}
+	for _, family := range cfg.Include {
+		if _, ok := f.enabled[family]; !ok {
+			return nil, unknownFamilyError(family)
+		}
+		f.enabled[family] = true
+	}
+	for _, family := range cfg.Exclude {
+		if _, ok := f.enabled[family]; !ok {
+			return nil, unknownFamilyError(family)
+		}
+		f.enabled[family] = false
+	}
+	return f, nil
+}
+
+func unknownFamilyError(family string) error {
+	return fmt.Errorf("unknown attribute family %q, expected one of: %s",
+		family, strings.Join(attributeFamilies, ", "))
+}
+
+func (f *AttributeFilter) Enabled(family string) bool {
+	return f.enabled[family]
+}
@@ -0,0 +1,136 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// azureDatabaseScope is the resource of Azure Database for PostgreSQL
+	// tokens
+	azureDatabaseScope = "https://ossrdbms-aad.database.windows.net"
+	azureTokenEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureLoginEndpoint = "https://login.microsoftonline.com"
+	// azureTokenMargin renews tokens before they expire
+	azureTokenMargin = 5 * time.Minute
+	azureTimeout     = 10 * time.Second
+)
+
+// azureCredentials fetches Entra ID tokens, with the managed identity of
+// the VM or pod, or with a service principal when a tenant is set. Tokens
+// are only checked when connecting, and are cached until close to expiry.
+type azureCredentials struct {
+	cfg    AzureAuthConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+type azureToken struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is a number of seconds, as a string for the managed
+	// identity endpoint
+	ExpiresIn json.Number `json:"expires_in"`
+}
+
+func validateAzureAuthConfig(c AzureAuthConfig) error {
+	if c.TenantId != "" && (c.ClientId == "" || c.ClientSecretFile == "") {
+		return fmt.Errorf("azure service principal requires a client_id and a client_secret_file")
+	}
+	if c.TenantId == "" && c.ClientSecretFile != "" {
+		return fmt.Errorf("azure client_secret_file requires a tenant_id")
+	}
+	return nil
+}
+
+func newAzureCredentials(cfg AzureAuthConfig) *azureCredentials {
+	return &azureCredentials{cfg: cfg, client: &http.Client{Timeout: azureTimeout}}
+}
+
+func (a *azureCredentials) credentials(ctx context.Context) (string, string, error) {
+	token, err := a.fetchToken(ctx)
+	return "", token, err
+}
+
+// fetchToken returns the cached token, fetching a new one when close to
+// expiry
+func (a *azureCredentials) fetchToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Until(a.expires) > azureTokenMargin {
+		return a.token, nil
+	}
+	var req *http.Request
+	var err error
+	if a.cfg.TenantId != "" {
+		req, err = a.servicePrincipalRequest(ctx)
+	} else {
+		req, err = a.managedIdentityRequest(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch azure token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch azure token: %s", resp.Status)
+	}
+	var token azureToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode azure token: %w", err)
+	}
+	expiresIn, err := strconv.Atoi(token.ExpiresIn.String())
+	if err != nil {
+		return "", fmt.Errorf("invalid azure token expiry %q", token.ExpiresIn)
+	}
+	a.token = token.AccessToken
+	a.expires = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return a.token, nil
+}
+
+func (a *azureCredentials) managedIdentityRequest(ctx context.Context) (*http.Request, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureDatabaseScope}}
+	if a.cfg.ClientId != "" {
+		// Selects a user-assigned identity
+		query.Set("client_id", a.cfg.ClientId)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureTokenEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure token request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
+
+func (a *azureCredentials) servicePrincipalRequest(ctx context.Context) (*http.Request, error) {
+	secret, err := os.ReadFile(a.cfg.ClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read azure client secret: %w", err)
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.cfg.ClientId},
+		"client_secret": {strings.TrimSpace(string(secret))},
+		"scope":         {azureDatabaseScope + "/.default"},
+	}
+	endpoint := fmt.Sprintf("%s/%s/oauth2/v2.0/token", azureLoginEndpoint, url.PathEscape(a.cfg.TenantId))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
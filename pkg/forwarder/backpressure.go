@@ -0,0 +1,62 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func validateBackpressureConfig(c BackpressureConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.PauseAt <= 0 || c.PauseAt > 1 || c.ResumeAt < 0 || c.ResumeAt >= c.PauseAt {
+		return fmt.Errorf("backpressure requires 0 <= resume_at < pause_at <= 1")
+	}
+	return nil
+}
+
+// queueTracker counts the spans entering the export queue, the exporter
+// counting the ones leaving it
+type queueTracker struct {
+	stats *forwarderStats
+}
+
+func (t *queueTracker) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (t *queueTracker) OnEnd(sdktrace.ReadOnlySpan) {
+	t.stats.spansQueued.Add(1)
+}
+
+func (t *queueTracker) Shutdown(context.Context) error   { return nil }
+func (t *queueTracker) ForceFlush(context.Context) error { return nil }
+
+// exportQueueDepth returns the spans queued or being exported
+func (s *forwarderStats) exportQueueDepth() int64 {
+	return s.spansQueued.Load() - s.spansDequeued.Load()
+}
+
+// backpressured returns whether consumption is paused while the export
+// queue drains. Spans are left in pg_tracing's buffer meanwhile, instead of
+// being dropped by a full queue.
+func (fw *targetForwarder) backpressured() bool {
+	cfg := fw.cfg.Exporter.Backpressure
+	if !cfg.Enabled {
+		return false
+	}
+	queueSize := fw.cfg.Exporter.Batch.MaxQueueSize
+	if queueSize == 0 {
+		queueSize = sdktrace.DefaultMaxQueueSize
+	}
+	fill := float64(fw.stats.exportQueueDepth()) / float64(queueSize)
+	switch {
+	case !fw.throttled && fill >= cfg.PauseAt:
+		fw.log.Printf("Export queue is %.0f%% full, pausing consumption until it drains", fill*100)
+		fw.throttled = true
+	case fw.throttled && fill <= cfg.ResumeAt:
+		fw.log.Printf("Export queue drained to %.0f%%, resuming consumption", fill*100)
+		fw.throttled = false
+	}
+	return fw.throttled
+}
@@ -0,0 +1,153 @@
+package forwarder
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// benchTracesPerPoll is the number of traces converted together, as if
+// consumed by a single poll
+const benchTracesPerPoll = 1000
+
+// discardExporter drops the exported spans
+type discardExporter struct{}
+
+func (discardExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	return nil
+}
+
+func (discardExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// benchTrace synthesizes the spans of an indexed join, as produced by
+// pg_tracing: the statement, its planner and executor spans and plan nodes
+func benchTrace(traceId int64, start time.Time) []*spanRow {
+	spanId := traceId << 4
+	span := func(parent *spanRow, spanType, operation string, offset, duration time.Duration) *spanRow {
+		spanId++
+		r := &spanRow{
+			traceId:       traceId,
+			spanId:        spanId,
+			spanType:      spanType,
+			spanOperation: operation,
+			spanStart:     start.Add(offset),
+			pid:           4242,
+		}
+		end := r.spanStart.Add(duration)
+		r.spanEnd = &end
+		if parent != nil {
+			r.parentId = parent.spanId
+		}
+		return r
+	}
+	top := span(nil, "Select query", "select * from orders o join customers c on c.id = o.customer_id where o.id = $1;", 0, 900*time.Microsecond)
+	top.parameters = sql.NullString{String: "$1 = '42'", Valid: true}
+	top.rows = sql.NullInt64{Int64: 1, Valid: true}
+	top.sharedBlks.hit = sql.NullInt64{Int64: 8, Valid: true}
+	top.sharedBlks.read = sql.NullInt64{Int64: 2, Valid: true}
+	top.blkTime.readTime = sql.NullFloat64{Float64: 0.12, Valid: true}
+	top.walRecords = sql.NullInt64{Valid: true}
+	planner := span(top, "Planner", "Planner", 10*time.Microsecond, 200*time.Microsecond)
+	executor := span(top, "ExecutorRun", "ExecutorRun", 250*time.Microsecond, 600*time.Microsecond)
+	join := span(executor, "NestedLoop", "NestedLoop", 260*time.Microsecond, 580*time.Microsecond)
+	join.planTotalCost = sql.NullFloat64{Float64: 16.6, Valid: true}
+	join.planRows = sql.NullFloat64{Float64: 1, Valid: true}
+	orders := span(join, "IndexScan", "IndexScan using orders_pkey on orders o", 270*time.Microsecond, 250*time.Microsecond)
+	orders.deparseInfo = sql.NullString{String: "Index Cond: (id = '42'::bigint)", Valid: true}
+	customers := span(join, "IndexScan", "IndexScan using customers_pkey on customers c", 530*time.Microsecond, 300*time.Microsecond)
+	customers.deparseInfo = sql.NullString{String: "Index Cond: (id = o.customer_id)", Valid: true}
+	return []*spanRow{top, planner, executor, join, orders, customers}
+}
+
+// benchCommand pushes synthetic spans through the conversion and export
+// pipeline, reporting the throughput and allocations
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to the YAML configuration file, for the conversion and batch settings")
+	spans := fs.Int("spans", 1000000, "Number of spans to convert and export")
+	export := fs.Bool("export", false, "Export to the configured exporter instead of discarding the spans")
+	exporter := fs.String("exporter", "", "Exporter to use with --export: "+exporterTypesUsage())
+	fs.Parse(args)
+	if *spans <= 0 {
+		return fmt.Errorf("--spans must be positive")
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *exporter != "" {
+		cfg.Exporter.Type = *exporter
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	converter, err := newSpanConverter(cfg, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var traceExporter sdktrace.SpanExporter = discardExporter{}
+	if *export {
+		if traceExporter, err = newTraceExporter(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	stats := &forwarderStats{}
+	// Spans are never dropped, so the throughput accounts for the export
+	batchOpts := append(batchOptions(cfg.Exporter.Batch), sdktrace.WithBlocking())
+	idGenerator := &FixedIdGenerator{}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("pg-tracing-bench"))),
+		sdktrace.WithSpanProcessor(sdktrace.NewBatchSpanProcessor(&statsExporter{SpanExporter: traceExporter, stats: stats}, batchOpts...)),
+		sdktrace.WithIDGenerator(idGenerator),
+	)
+	tracer := tp.Tracer("pg-tracing-bench")
+
+	log.Printf("Converting and exporting %d spans", *spans)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	started := time.Now()
+	generated := 0
+	var traceId int64
+	for generated < *spans {
+		traces := make([][]*spanRow, 0, benchTracesPerPoll)
+		for len(traces) < benchTracesPerPoll && generated < *spans {
+			traceId++
+			rows := benchTrace(traceId, started)
+			rows = rows[:min(len(rows), *spans-generated)]
+			generated += len(rows)
+			traces = append(traces, rows)
+		}
+		converter.exportSpans(ctx, tracer, idGenerator, traces)
+	}
+	if err := tp.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to flush spans: %w", err)
+	}
+	elapsed := time.Since(started)
+	runtime.ReadMemStats(&after)
+
+	exported := stats.spansDequeued.Load() - stats.spansExportFailed.Load()
+	fmt.Printf("Exported %d spans in %s: %.0f spans/s\n", exported, elapsed.Round(time.Millisecond), float64(exported)/elapsed.Seconds())
+	fmt.Printf("Allocations: %.1f per span, %.0f bytes per span, %d GC cycles\n",
+		float64(after.Mallocs-before.Mallocs)/float64(generated),
+		float64(after.TotalAlloc-before.TotalAlloc)/float64(generated),
+		after.NumGC-before.NumGC)
+	if failed := stats.spansExportFailed.Load(); failed > 0 {
+		fmt.Printf("Failed exports: %d spans\n", failed)
+	}
+	return nil
+}
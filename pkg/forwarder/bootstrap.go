@@ -0,0 +1,65 @@
+package forwarder
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const defaultBootstrapRole = "pg_tracing_forwarder"
+
+// bootstrapStatements creates the pg_tracing extension and a role allowed to
+// consume spans and read the server information, without superuser
+func bootstrapStatements(role string) []string {
+	ident := pgx.Identifier{role}.Sanitize()
+	literal := "'" + strings.ReplaceAll(role, "'", "''") + "'"
+	return []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_tracing",
+		fmt.Sprintf(`DO $bootstrap$ BEGIN
+  IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = %s) THEN
+    CREATE ROLE %s LOGIN;
+  END IF;
+END $bootstrap$`, literal, ident),
+		"GRANT EXECUTE ON FUNCTION pg_tracing_consume_spans, pg_tracing_peek_spans, pg_tracing_info TO " + ident,
+		// Query texts of pg_stat_statements and the system identifier
+		"GRANT pg_read_all_stats TO " + ident,
+		"GRANT EXECUTE ON FUNCTION pg_control_system() TO " + ident,
+	}
+}
+
+func validateBootstrapRole(role string) error {
+	if role == "" || strings.Contains(role, "$bootstrap$") {
+		return fmt.Errorf("invalid bootstrap role %q", role)
+	}
+	return nil
+}
+
+// bootstrap runs the bootstrap statements, requiring the privileges to
+// create the extension and roles
+func bootstrap(ctx context.Context, conn *pgx.Conn, role string, logger *log.Logger) error {
+	for _, statement := range bootstrapStatements(role) {
+		if _, err := conn.Exec(ctx, statement); err != nil {
+			return fmt.Errorf("failed to bootstrap pg_tracing: %w", err)
+		}
+	}
+	logger.Printf("Bootstrapped pg_tracing and role %s", role)
+	return nil
+}
+
+// grantsCommand prints the bootstrap statements, to be run by an admin
+func grantsCommand(args []string) error {
+	fs := flag.NewFlagSet("grants", flag.ExitOnError)
+	role := fs.String("role", defaultBootstrapRole, "Role used by the forwarder")
+	fs.Parse(args)
+	if err := validateBootstrapRole(*role); err != nil {
+		return err
+	}
+	for _, statement := range bootstrapStatements(*role) {
+		fmt.Printf("%s;\n", statement)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Drop policies of the assembly buffer
+const (
+	dropNewest = "newest"
+	dropOldest = "oldest"
+)
+
+const metricDroppedSpans = "pg_tracing.forwarder.dropped_spans"
+
+func validateBufferConfig(c BufferConfig) error {
+	if c.MaxSpans < 0 {
+		return fmt.Errorf("buffer max_spans can't be negative")
+	}
+	switch c.DropPolicy {
+	case "", dropNewest, dropOldest:
+		return nil
+	}
+	return fmt.Errorf("unknown buffer drop_policy %q, expected %s or %s", c.DropPolicy, dropNewest, dropOldest)
+}
+
+// dropReason is a reason of the spans dropped by the forwarder
+type dropReason struct {
+	reason  string
+	counter *atomic.Int64
+}
+
+// dropReasons lists the counters of the spans dropped by the forwarder,
+// reported by the dropped spans metric and the summaries
+func (s *forwarderStats) dropReasons() []dropReason {
+	return []dropReason{
+		{"buffer_full", &s.spansBufferDropped},
+		{"clock_skew", &s.spansClockDropped},
+		{"duplicate", &s.spansDuplicated},
+		{"export_failed", &s.spansExportFailed},
+		{"malformed", &s.spansMalformedDropped},
+	}
+}
+
+// spansDropped returns the spans dropped by the forwarder for any reason
+func (s *forwarderStats) spansDropped() int64 {
+	var dropped int64
+	for _, r := range s.dropReasons() {
+		dropped += r.counter.Load()
+	}
+	return dropped
+}
+
+// initDropMetric reports the spans dropped by the forwarder, by reason
+func (fw *targetForwarder) initDropMetric(meter metric.Meter) error {
+	reasons := fw.stats.dropReasons()
+	_, err := meter.Int64ObservableCounter(metricDroppedSpans,
+		metric.WithDescription("Spans dropped by the forwarder"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			for _, r := range reasons {
+				o.Observe(r.counter.Load(), metric.WithAttributes(attribute.String("reason", r.reason)))
+			}
+			return nil
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to create dropped spans counter: %w", err)
+	}
+	return nil
+}
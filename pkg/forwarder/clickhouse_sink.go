@@ -0,0 +1,183 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultClickHouseTable = "otel_traces"
+	clickHouseTimeFormat   = "2006-01-02 15:04:05.000000000"
+)
+
+// clickHouseSpan is a row of the collector's clickhouse exporter otel_traces
+// table. Nested columns are flattened as arrays.
+type clickHouseSpan struct {
+	Timestamp          string            `json:"Timestamp"`
+	TraceId            string            `json:"TraceId"`
+	SpanId             string            `json:"SpanId"`
+	ParentSpanId       string            `json:"ParentSpanId"`
+	TraceState         string            `json:"TraceState"`
+	SpanName           string            `json:"SpanName"`
+	SpanKind           string            `json:"SpanKind"`
+	ServiceName        string            `json:"ServiceName"`
+	ResourceAttributes map[string]string `json:"ResourceAttributes"`
+	ScopeName          string            `json:"ScopeName"`
+	ScopeVersion       string            `json:"ScopeVersion"`
+	SpanAttributes     map[string]string `json:"SpanAttributes"`
+	Duration           int64             `json:"Duration"`
+	StatusCode         string            `json:"StatusCode"`
+	StatusMessage      string            `json:"StatusMessage"`
+
+	EventsTimestamp  []string            `json:"Events.Timestamp"`
+	EventsName       []string            `json:"Events.Name"`
+	EventsAttributes []map[string]string `json:"Events.Attributes"`
+
+	LinksTraceId    []string            `json:"Links.TraceId"`
+	LinksSpanId     []string            `json:"Links.SpanId"`
+	LinksTraceState []string            `json:"Links.TraceState"`
+	LinksAttributes []map[string]string `json:"Links.Attributes"`
+}
+
+// clickHouseExporter inserts spans through ClickHouse's HTTP interface with
+// asynchronous inserts, letting the server batch small inserts together
+type clickHouseExporter struct {
+	cfg    ClickHouseSinkConfig
+	url    string
+	client *http.Client
+}
+
+func validateClickHouseConfig(cfg ClickHouseSinkConfig) error {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return fmt.Errorf("invalid clickhouse endpoint: %w", err)
+	}
+	return nil
+}
+
+func newClickHouseExporter(cfg ClickHouseSinkConfig) *clickHouseExporter {
+	table := cfg.Table
+	if table == "" {
+		table = defaultClickHouseTable
+	}
+	if cfg.Database != "" {
+		table = cfg.Database + "." + table
+	}
+	params := url.Values{}
+	params.Set("query", "INSERT INTO "+table+" FORMAT JSONEachRow")
+	params.Set("async_insert", "1")
+	params.Set("wait_for_async_insert", "1")
+	return &clickHouseExporter{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(cfg.Endpoint, "/") + "/?" + params.Encode(),
+		client: &http.Client{},
+	}
+}
+
+func attributesMap(attrs []attribute.KeyValue) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		m[string(attr.Key)] = attr.Value.Emit()
+	}
+	return m
+}
+
+func clickHouseSpanKind(kind trace.SpanKind) string {
+	return "SPAN_KIND_" + strings.ToUpper(kind.String())
+}
+
+func newClickHouseSpan(span sdktrace.ReadOnlySpan) *clickHouseSpan {
+	sc := span.SpanContext()
+	traceId, spanId := sc.TraceID(), sc.SpanID()
+	row := &clickHouseSpan{
+		Timestamp:      span.StartTime().UTC().Format(clickHouseTimeFormat),
+		TraceId:        hex.EncodeToString(traceId[:]),
+		SpanId:         hex.EncodeToString(spanId[:]),
+		TraceState:     sc.TraceState().String(),
+		SpanName:       span.Name(),
+		SpanKind:       clickHouseSpanKind(span.SpanKind()),
+		ServiceName:    resourceValue(span.Resource(), semconv.ServiceNameKey),
+		ScopeName:      span.InstrumentationScope().Name,
+		ScopeVersion:   span.InstrumentationScope().Version,
+		SpanAttributes: attributesMap(span.Attributes()),
+		Duration:       span.EndTime().Sub(span.StartTime()).Nanoseconds(),
+		StatusCode:     "STATUS_CODE_" + strings.ToUpper(span.Status().Code.String()),
+		StatusMessage:  span.Status().Description,
+
+		EventsTimestamp:  []string{},
+		EventsName:       []string{},
+		EventsAttributes: []map[string]string{},
+		LinksTraceId:     []string{},
+		LinksSpanId:      []string{},
+		LinksTraceState:  []string{},
+		LinksAttributes:  []map[string]string{},
+	}
+	if span.Parent().IsValid() {
+		parentId := span.Parent().SpanID()
+		row.ParentSpanId = hex.EncodeToString(parentId[:])
+	}
+	if res := span.Resource(); res != nil {
+		row.ResourceAttributes = attributesMap(res.Attributes())
+	}
+	for _, event := range span.Events() {
+		row.EventsTimestamp = append(row.EventsTimestamp, event.Time.UTC().Format(clickHouseTimeFormat))
+		row.EventsName = append(row.EventsName, event.Name)
+		row.EventsAttributes = append(row.EventsAttributes, attributesMap(event.Attributes))
+	}
+	for _, link := range span.Links() {
+		linkTraceId, linkSpanId := link.SpanContext.TraceID(), link.SpanContext.SpanID()
+		row.LinksTraceId = append(row.LinksTraceId, hex.EncodeToString(linkTraceId[:]))
+		row.LinksSpanId = append(row.LinksSpanId, hex.EncodeToString(linkSpanId[:]))
+		row.LinksTraceState = append(row.LinksTraceState, link.SpanContext.TraceState().String())
+		row.LinksAttributes = append(row.LinksAttributes, attributesMap(link.Attributes))
+	}
+	return row
+}
+
+func (e *clickHouseExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, span := range spans {
+		if err := encoder.Encode(newClickHouseSpan(span)); err != nil {
+			return fmt.Errorf("failed to encode span: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create clickhouse request: %w", err)
+	}
+	if e.cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", e.cfg.Username)
+		req.Header.Set("X-ClickHouse-Key", e.cfg.Password)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to insert spans in clickhouse: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("clickhouse returned %s: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (e *clickHouseExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
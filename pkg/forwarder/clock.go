@@ -0,0 +1,100 @@
+package forwarder
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Actions on spans with invalid timestamps
+const (
+	clockClamp  = "clamp"
+	clockReject = "reject"
+)
+
+func validateClockConfig(cfg ClockConfig) error {
+	if cfg.MaxSkew < 0 {
+		return fmt.Errorf("clock max skew can't be negative")
+	}
+	switch cfg.Action {
+	case "", clockClamp, clockReject:
+		return nil
+	}
+	return fmt.Errorf("unknown clock action %q, expected clamp or reject", cfg.Action)
+}
+
+func (r *spanRow) setTimes(start, end time.Time) {
+	r.spanStart = start
+	r.spanStartNs.Int32 = 0
+	r.spanEnd = &end
+}
+
+// checkClock validates the span's timestamps, returning false if the span
+// should be dropped. An end before the start is clamped to the start, and with
+// a max skew, spans too far from now are moved within the allowed range,
+// keeping their duration.
+func checkClock(cfg ClockConfig, r *spanRow, now time.Time) (bool, bool) {
+	start, end := r.startTime(), r.endTime()
+	valid := !end.Before(start)
+	if !valid {
+		end = start
+	}
+	if cfg.MaxSkew > 0 {
+		duration := end.Sub(start)
+		if start.After(now.Add(cfg.MaxSkew)) {
+			valid = false
+			start = now.Add(cfg.MaxSkew)
+		} else if start.Before(now.Add(-cfg.MaxSkew)) {
+			valid = false
+			start = now.Add(-cfg.MaxSkew)
+		}
+		end = start.Add(duration)
+	}
+	if valid {
+		return true, false
+	}
+	if cfg.Action == clockReject {
+		return false, false
+	}
+	r.setTimes(start, end)
+	return true, true
+}
+
+// filterClock applies the clock sanity checks to the fetched rows
+func filterClock(cfg ClockConfig, rows []*spanRow, now time.Time, stats *forwarderStats) []*spanRow {
+	res := rows[:0]
+	for _, r := range rows {
+		keep, clamped := checkClock(cfg, r, now)
+		if clamped {
+			stats.spansClockClamped.Add(1)
+		}
+		if !keep {
+			stats.spansClockDropped.Add(1)
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// clockLogInterval is the minimum interval between two logs of the spans
+// dropped by the clock checks
+const clockLogInterval = time.Minute
+
+// clockDropLog summarizes the spans dropped by the clock checks, which are
+// counted by the dropped spans metric, rather than logging each span
+type clockDropLog struct {
+	dropped int
+	logged  time.Time
+}
+
+// add counts the dropped spans, logging them when the interval elapsed
+// since the last summary
+func (l *clockDropLog) add(logger *log.Logger, dropped int, now time.Time) {
+	l.dropped += dropped
+	if l.dropped == 0 || now.Sub(l.logged) < clockLogInterval {
+		return
+	}
+	logger.Printf("Dropped %d spans with invalid timestamps", l.dropped)
+	l.dropped, l.logged = 0, now
+}
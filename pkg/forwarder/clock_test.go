@@ -0,0 +1,73 @@
+package forwarder
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckClock(t *testing.T) {
+	now := testStart
+	for _, tc := range []struct {
+		name           string
+		cfg            ClockConfig
+		offset, length time.Duration
+		keep, clamped  bool
+		start          time.Duration
+	}{
+		{name: "valid", cfg: ClockConfig{MaxSkew: time.Minute}, offset: -time.Second, length: time.Millisecond, keep: true, start: -time.Second},
+		{name: "end before start", offset: -time.Second, length: -time.Millisecond, keep: true, clamped: true, start: -time.Second},
+		{name: "future", cfg: ClockConfig{MaxSkew: time.Minute}, offset: time.Hour, length: time.Millisecond, keep: true, clamped: true, start: time.Minute},
+		{name: "past", cfg: ClockConfig{MaxSkew: time.Minute}, offset: -time.Hour, length: time.Millisecond, keep: true, clamped: true, start: -time.Minute},
+		{name: "rejected", cfg: ClockConfig{MaxSkew: time.Minute, Action: clockReject}, offset: time.Hour, length: time.Millisecond, start: time.Hour},
+	} {
+		r := testRow(10, 0, "Select query", "select 1;", tc.offset, tc.length).spanRow()
+		keep, clamped := checkClock(tc.cfg, r, now)
+		if keep != tc.keep || clamped != tc.clamped {
+			t.Errorf("%s: keep %v, clamped %v", tc.name, keep, clamped)
+		}
+		if got := r.startTime().Sub(now); got != tc.start {
+			t.Errorf("%s: start moved to %s", tc.name, got)
+		}
+		if r.endTime().Before(r.startTime()) {
+			t.Errorf("%s: end %s before start %s", tc.name, r.endTime(), r.startTime())
+		}
+	}
+}
+
+func TestFilterClock(t *testing.T) {
+	rows := []*spanRow{
+		testRow(10, 0, "Select query", "select 1;", 0, time.Millisecond).spanRow(),
+		testRow(11, 0, "Select query", "select 1;", time.Hour, time.Millisecond).spanRow(),
+		testRow(12, 10, "Planner", "Planner", 0, -time.Millisecond).spanRow(),
+	}
+	stats := &forwarderStats{}
+	kept := filterClock(ClockConfig{MaxSkew: time.Minute, Action: clockReject}, rows, testStart, stats)
+	if len(kept) != 1 || kept[0].spanId != 10 {
+		t.Fatalf("unexpected kept spans %v", kept)
+	}
+	if dropped := stats.spansClockDropped.Load(); dropped != 2 {
+		t.Fatalf("%d dropped spans counted, expected 2", dropped)
+	}
+}
+
+func TestClockDropLog(t *testing.T) {
+	var logged bytes.Buffer
+	logger := log.New(&logged, "", 0)
+	var l clockDropLog
+	l.add(logger, 2, testStart)
+	l.add(logger, 3, testStart.Add(time.Second))
+	l.add(logger, 0, testStart.Add(2*time.Second))
+	l.add(logger, 0, testStart.Add(clockLogInterval+time.Second))
+	want := "Dropped 2 spans with invalid timestamps\nDropped 3 spans with invalid timestamps\n"
+	if logged.String() != want {
+		t.Fatalf("unexpected logs %q", logged.String())
+	}
+	logged.Reset()
+	l.add(logger, 0, testStart.Add(3*clockLogInterval))
+	if strings.Contains(logged.String(), "Dropped") {
+		t.Fatalf("summary logged without dropped spans: %q", logged.String())
+	}
+}
@@ -0,0 +1,113 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5"
+)
+
+// cloudSQLScheme prefixes the DSNs connecting through the Cloud SQL
+// connector, e.g. cloudsql://user@project:region:instance/dbname
+const cloudSQLScheme = "cloudsql://"
+
+// cloudSQLDialer connects to a Cloud SQL instance with the connector, which
+// handles the TLS certificates and the optional IAM authentication
+type cloudSQLDialer struct {
+	instance string
+	iamAuthN bool
+	dialOpts []cloudsqlconn.DialOption
+
+	mu     sync.Mutex
+	dialer *cloudsqlconn.Dialer
+}
+
+func isCloudSQLDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, cloudSQLScheme)
+}
+
+// parseCloudSQLDSN returns the Postgres DSN and the dialer of a cloudsql://
+// DSN. The iam_authn and ip_type parameters configure the connector, the
+// other ones are passed to Postgres.
+func parseCloudSQLDSN(dsn string) (string, *cloudSQLDialer, error) {
+	rest := strings.TrimPrefix(dsn, cloudSQLScheme)
+	authority, path := rest, ""
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		authority, path = rest[:i], rest[i:]
+	}
+	userinfo, instance := "", authority
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		userinfo, instance = authority[:i+1], authority[i+1:]
+	}
+	if strings.Count(instance, ":") < 2 {
+		return "", nil, fmt.Errorf("invalid cloud sql instance %q, expected project:region:instance", instance)
+	}
+
+	// The Postgres host is replaced by the connector's dialer
+	u, err := url.Parse("postgres://" + userinfo + "localhost" + path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse cloud sql dsn: %w", err)
+	}
+	d := &cloudSQLDialer{instance: instance}
+	query := u.Query()
+	if v := query.Get("iam_authn"); v != "" {
+		d.iamAuthN = v == "true" || v == "1"
+	}
+	switch ipType := query.Get("ip_type"); ipType {
+	case "", "public":
+	case "private":
+		d.dialOpts = append(d.dialOpts, cloudsqlconn.WithPrivateIP())
+	case "psc":
+		d.dialOpts = append(d.dialOpts, cloudsqlconn.WithPSC())
+	default:
+		return "", nil, fmt.Errorf("unknown cloud sql ip_type %q, expected public, private or psc", ipType)
+	}
+	query.Del("iam_authn")
+	query.Del("ip_type")
+	// The connector already encrypts the connection
+	query.Set("sslmode", "disable")
+	u.RawQuery = query.Encode()
+	return u.String(), d, nil
+}
+
+// configure dials the instance with the connector, created on the first
+// connection
+func (d *cloudSQLDialer) configure(connConfig *pgx.ConnConfig) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dialer == nil {
+		var opts []cloudsqlconn.Option
+		if d.iamAuthN {
+			opts = append(opts, cloudsqlconn.WithIAMAuthN())
+		}
+		dialer, err := cloudsqlconn.NewDialer(context.Background(), opts...)
+		if err != nil {
+			return fmt.Errorf("failed to create cloud sql dialer: %w", err)
+		}
+		d.dialer = dialer
+	}
+	dialer := d.dialer
+	connConfig.Host = d.instance
+	connConfig.Fallbacks = nil
+	connConfig.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	connConfig.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.Dial(ctx, d.instance, d.dialOpts...)
+	}
+	return nil
+}
+
+func (d *cloudSQLDialer) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dialer != nil {
+		d.dialer.Close()
+		d.dialer = nil
+	}
+}
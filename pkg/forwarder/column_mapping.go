@@ -0,0 +1,247 @@
+package forwarder
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Column attribute types
+const (
+	columnInt    = "int"
+	columnFloat  = "float"
+	columnString = "string"
+	columnBool   = "bool"
+)
+
+// columnMapping exports a result column as an attribute
+type columnMapping struct {
+	column    string
+	attribute attribute.Key
+	// kind is the attribute type, inferred from the value when empty
+	kind     string
+	omitZero bool
+	// family is the attribute family enabling the column, empty when
+	// always exported
+	family string
+	// The value is read with intValue or floatValue for the scanned
+	// columns, without boxing, and with value for the extra columns
+	intValue   func(r *spanRow) sql.NullInt64
+	floatValue func(r *spanRow) sql.NullFloat64
+	value      func(r *spanRow) any
+}
+
+func intColumn(column, key, family string, value func(r *spanRow) sql.NullInt64) columnMapping {
+	return columnMapping{column: column, attribute: attribute.Key(key), kind: columnInt, omitZero: true, family: family, intValue: value}
+}
+
+func floatColumn(column, key, family string, value func(r *spanRow) sql.NullFloat64) columnMapping {
+	return columnMapping{column: column, attribute: attribute.Key(key), kind: columnFloat, omitZero: true, family: family, floatValue: value}
+}
+
+// defaultColumnMappings are the attributes of the pg_tracing metric columns
+var defaultColumnMappings = []columnMapping{
+	intColumn("query_id", "db.postgresql.query_id", "", func(r *spanRow) sql.NullInt64 { return r.queryId }),
+	intColumn("rows", "rows", "", func(r *spanRow) sql.NullInt64 { return r.rows }),
+	intColumn("startup", "first_tuple", "", func(r *spanRow) sql.NullInt64 { return r.startup }),
+
+	intColumn("shared_blks_hit", "block.shared.hit", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.sharedBlks.hit }),
+	intColumn("shared_blks_read", "block.shared.read", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.sharedBlks.read }),
+	intColumn("shared_blks_dirtied", "block.shared.dirtied", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.sharedBlks.dirtied }),
+	intColumn("shared_blks_written", "block.shared.written", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.sharedBlks.written }),
+	intColumn("local_blks_hit", "block.local.hit", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.localBlks.hit }),
+	intColumn("local_blks_read", "block.local.read", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.localBlks.read }),
+	intColumn("local_blks_dirtied", "block.local.dirtied", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.localBlks.dirtied }),
+	intColumn("local_blks_written", "block.local.written", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.localBlks.written }),
+	floatColumn("blk_read_time", "block.read_time", familyBlocks, func(r *spanRow) sql.NullFloat64 { return r.blkTime.readTime }),
+	floatColumn("blk_write_time", "block.write_time", familyBlocks, func(r *spanRow) sql.NullFloat64 { return r.blkTime.writeTime }),
+	intColumn("temp_blks_read", "block.temp.read", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.tempBlks.read }),
+	intColumn("temp_blks_written", "block.temp.written", familyBlocks, func(r *spanRow) sql.NullInt64 { return r.tempBlks.written }),
+	floatColumn("temp_blk_read_time", "block.temp.read_time", familyBlocks, func(r *spanRow) sql.NullFloat64 { return r.tempBlkTime.readTime }),
+	floatColumn("temp_blk_write_time", "block.temp.write_time", familyBlocks, func(r *spanRow) sql.NullFloat64 { return r.tempBlkTime.writeTime }),
+
+	intColumn("wal_records", "wal.records", familyWal, func(r *spanRow) sql.NullInt64 { return r.walRecords }),
+	intColumn("wal_fpi", "wal.fpi", familyWal, func(r *spanRow) sql.NullInt64 { return r.walFpi }),
+	intColumn("wal_bytes", "wal.bytes", familyWal, func(r *spanRow) sql.NullInt64 { return r.walBytes }),
+
+	floatColumn("plan_startup_cost", "plan.startup_cost", familyPlan, func(r *spanRow) sql.NullFloat64 { return r.planStartupCost }),
+	floatColumn("plan_total_cost", "plan.total_cost", familyPlan, func(r *spanRow) sql.NullFloat64 { return r.planTotalCost }),
+	floatColumn("plan_rows", "plan.rows", familyPlan, func(r *spanRow) sql.NullFloat64 { return r.planRows }),
+	intColumn("plan_width", "plan.width", familyPlan, func(r *spanRow) sql.NullInt64 { return r.planWidth }),
+
+	intColumn("jit_functions", "jit.functions", familyJit, func(r *spanRow) sql.NullInt64 { return r.jitFunctions }),
+	floatColumn("jit_generation_time", "jit.generation_time", familyJit, func(r *spanRow) sql.NullFloat64 { return r.jitGenerationTime }),
+	floatColumn("jit_inlining_time", "jit.inlining_time", familyJit, func(r *spanRow) sql.NullFloat64 { return r.jitInliningTime }),
+	floatColumn("jit_optimization_time", "jit.optimization_time", familyJit, func(r *spanRow) sql.NullFloat64 { return r.jitOptimizationTime }),
+	floatColumn("jit_emission_time", "jit.emission_time", familyJit, func(r *spanRow) sql.NullFloat64 { return r.jitEmissionTime }),
+}
+
+func validateColumnConfig(c ColumnConfig) error {
+	if c.Column == "" {
+		return fmt.Errorf("column mapping requires a column")
+	}
+	switch c.Type {
+	case "", columnInt, columnFloat, columnString, columnBool:
+		return nil
+	}
+	return fmt.Errorf("unknown type %q for column %s, expected one of: int, float, string, bool", c.Type, c.Column)
+}
+
+// newColumnMappings applies the configured mappings to the default ones.
+// Mappings of other columns read the extra columns of the fetch query.
+func newColumnMappings(configs []ColumnConfig) ([]columnMapping, error) {
+	mappings := append([]columnMapping(nil), defaultColumnMappings...)
+	byColumn := make(map[string]int, len(mappings))
+	for i, m := range mappings {
+		byColumn[m.column] = i
+	}
+	for _, c := range configs {
+		if err := validateColumnConfig(c); err != nil {
+			return nil, err
+		}
+		i, ok := byColumn[c.Column]
+		if !ok {
+			column := c.Column
+			mappings = append(mappings, columnMapping{
+				column:    column,
+				attribute: attribute.Key(column),
+				value:     func(r *spanRow) any { return r.extraValue(column) },
+			})
+			i = len(mappings) - 1
+			byColumn[column] = i
+		}
+		m := &mappings[i]
+		if c.Attribute != "" {
+			m.attribute = attribute.Key(c.Attribute)
+		}
+		if c.Type != "" {
+			m.kind = c.Type
+		}
+		if c.OmitZero != nil {
+			m.omitZero = *c.OmitZero
+		}
+	}
+	return mappings, nil
+}
+
+// extraValue returns the value of an extra column, nil when not selected
+func (r *spanRow) extraValue(name string) any {
+	for _, column := range r.extra {
+		if column.name == name {
+			return column.value
+		}
+	}
+	return nil
+}
+
+// isMapped returns true if the extra column is exported by a mapping
+func isMapped(mappings []columnMapping, name string) bool {
+	for _, m := range mappings {
+		if m.column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// appendColumnAttributes appends the attributes of the mapped columns of
+// the enabled families
+func (c *spanConverter) appendColumnAttributes(attributes []attribute.KeyValue, r *spanRow) []attribute.KeyValue {
+	for _, m := range c.columns {
+		if m.family != "" && !c.filter.Enabled(m.family) {
+			continue
+		}
+		if kv, ok := m.attributeOf(r); ok {
+			attributes = append(attributes, kv)
+		}
+	}
+	return attributes
+}
+
+// attributeOf returns the row's attribute for the mapping, false when the
+// column is null or omitted
+func (m columnMapping) attributeOf(r *spanRow) (attribute.KeyValue, bool) {
+	var value any
+	switch {
+	case m.intValue != nil:
+		v := m.intValue(r)
+		if !v.Valid || (m.omitZero && v.Int64 == 0) {
+			return attribute.KeyValue{}, false
+		}
+		if m.kind == columnInt {
+			return m.attribute.Int64(v.Int64), true
+		}
+		value = v.Int64
+	case m.floatValue != nil:
+		v := m.floatValue(r)
+		if !v.Valid || (m.omitZero && v.Float64 == 0) {
+			return attribute.KeyValue{}, false
+		}
+		if m.kind == columnFloat {
+			return m.attribute.Float64(v.Float64), true
+		}
+		value = v.Float64
+	default:
+		value = m.value(r)
+	}
+	kv, ok := extraColumn{name: string(m.attribute), value: value}.attribute()
+	if !ok {
+		return kv, false
+	}
+	switch m.kind {
+	case columnInt:
+		switch kv.Value.Type() {
+		case attribute.FLOAT64:
+			kv = m.attribute.Int64(int64(kv.Value.AsFloat64()))
+		case attribute.STRING:
+			i, err := strconv.ParseInt(kv.Value.AsString(), 10, 64)
+			if err != nil {
+				return kv, false
+			}
+			kv = m.attribute.Int64(i)
+		}
+	case columnFloat:
+		switch kv.Value.Type() {
+		case attribute.INT64:
+			kv = m.attribute.Float64(float64(kv.Value.AsInt64()))
+		case attribute.STRING:
+			f, err := strconv.ParseFloat(kv.Value.AsString(), 64)
+			if err != nil {
+				return kv, false
+			}
+			kv = m.attribute.Float64(f)
+		}
+	case columnString:
+		if kv.Value.Type() != attribute.STRING {
+			kv = m.attribute.String(kv.Value.Emit())
+		}
+	case columnBool:
+		if kv.Value.Type() != attribute.BOOL {
+			b, err := strconv.ParseBool(kv.Value.Emit())
+			if err != nil {
+				return kv, false
+			}
+			kv = m.attribute.Bool(b)
+		}
+	}
+	if m.omitZero && isZeroValue(kv.Value) {
+		return kv, false
+	}
+	return kv, true
+}
+
+func isZeroValue(v attribute.Value) bool {
+	switch v.Type() {
+	case attribute.INT64:
+		return v.AsInt64() == 0
+	case attribute.FLOAT64:
+		return v.AsFloat64() == 0
+	case attribute.STRING:
+		return v.AsString() == ""
+	case attribute.BOOL:
+		return !v.AsBool()
+	}
+	return false
+}
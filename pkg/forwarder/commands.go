@@ -0,0 +1,28 @@
+package forwarder
+
+// Main runs the subcommand of the command line arguments, without the
+// program name
+func Main(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			return runCommand(args[1:], false)
+		case "replay":
+			return replayCommand(args[1:])
+		case "validate":
+			return validateCommand(args[1:])
+		case "tail":
+			return tailCommand(args[1:])
+		case "grants":
+			return grantsCommand(args[1:])
+		case "selftest":
+			return selftestCommand(args[1:])
+		case "bench":
+			return benchCommand(args[1:])
+		case "tui":
+			return tuiCommand(args[1:])
+		}
+	}
+	// Without subcommand, keep the historical one-shot behavior
+	return runCommand(args, true)
+}
@@ -0,0 +1,225 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// schemaAdapter reads the spans of the pg_tracing versions sharing a schema
+type schemaAdapter struct {
+	name string
+	// minVersion is the first pg_tracing version with the schema
+	minVersion string
+	// columns are the optional columns selected with the schema
+	columns []string
+	// ids is the format of the trace, parent and span ids
+	ids string
+}
+
+// Id formats: bigint, or hex digits of a text, uuid or bytea column
+const (
+	idsBigint = "bigint"
+	idsText   = "text"
+)
+
+// schemaAdapters are ordered by version, each schema being used until the
+// next one's version
+var schemaAdapters = []*schemaAdapter{
+	// Spans have a start offset and a duration
+	{name: "start_offset", minVersion: "0.1.0", columns: []string{"span_start_ns", "duration"}, ids: idsBigint},
+	// span_end replaces the offset and duration, query_id is added
+	{name: "span_end", minVersion: "0.1.1", columns: []string{"span_end", "query_id"}, ids: idsBigint},
+	// The database and user oids are added
+	{name: "oids", minVersion: "0.1.2", columns: []string{"span_end", "query_id", "dbid", "userid"}, ids: idsBigint},
+	// Ids are hex text, with the traceparent's 128-bit trace id
+	{name: "text_ids", minVersion: "0.1.3", columns: []string{"span_end", "query_id", "dbid", "userid"}, ids: idsText},
+}
+
+// idFormat returns the format of an id column of type typ
+func idFormat(typ string) string {
+	switch typ {
+	case "bigint", "integer":
+		return idsBigint
+	}
+	return idsText
+}
+
+// idExpression selects an id column of type typ as a bigint or a hex text
+func idExpression(column, typ string) string {
+	switch typ {
+	case "uuid":
+		return column + "::text as " + column
+	case "bytea":
+		return "encode(" + column + ", 'hex') as " + column
+	}
+	return column
+}
+
+// Handling of pg_tracing versions outside the supported range
+const (
+	versionWarn   = "warn"
+	versionRefuse = "refuse"
+)
+
+// maxVersion is the first pg_tracing version past the supported range, a
+// new minor version possibly changing the schema
+const maxVersion = "0.2.0"
+
+func validateVersionPolicy(policy string) error {
+	switch policy {
+	case "", versionWarn, versionRefuse:
+		return nil
+	}
+	return fmt.Errorf("unknown unsupported_versions %q, expected one of: warn, refuse", policy)
+}
+
+// unsupportedVersion describes why a pg_tracing version is outside the
+// supported range, empty when it's supported
+func unsupportedVersion(version string) string {
+	minVersion := schemaAdapters[0].minVersion
+	switch {
+	case compareVersions(version, minVersion) < 0:
+		return fmt.Sprintf("pg_tracing %s is older than the supported versions, from %s and before %s", version, minVersion, maxVersion)
+	case compareVersions(version, maxVersion) >= 0:
+		return fmt.Sprintf("pg_tracing %s is newer than the supported versions, from %s and before %s", version, minVersion, maxVersion)
+	}
+	return ""
+}
+
+// checkExtensionVersion warns about or refuses, depending on policy, a
+// pg_tracing version outside the supported range
+func checkExtensionVersion(ctx context.Context, conn *pgx.Conn, policy string, logger *log.Logger) error {
+	version := extensionVersion(ctx, conn)
+	reason := unsupportedVersion(version)
+	// An unreadable version is left to the column detection
+	if version == "" || reason == "" {
+		return nil
+	}
+	if policy == versionRefuse {
+		return fmt.Errorf("%s, refusing to forward spans", reason)
+	}
+	logger.Printf("Warning: %s, spans are read with the %s", reason, describeAdapter(adapterForVersion(version)))
+	return nil
+}
+
+// compareVersions compares two dotted versions numerically, ignoring
+// non-numeric suffixes such as -dev
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x = leadingNumber(as[i])
+		}
+		if i < len(bs) {
+			y = leadingNumber(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func leadingNumber(s string) int {
+	end := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		s = s[:end]
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// adapterForVersion returns the adapter of a pg_tracing version, nil when
+// it's older than the supported versions
+func adapterForVersion(version string) *schemaAdapter {
+	var adapter *schemaAdapter
+	for _, a := range schemaAdapters {
+		if compareVersions(version, a.minVersion) >= 0 {
+			adapter = a
+		}
+	}
+	return adapter
+}
+
+// mismatch describes how the detected columns differ from the adapter's
+// schema, empty when they match
+func (a *schemaAdapter) mismatch(columns map[string]string) string {
+	for _, column := range a.columns {
+		if columns[column] == "" {
+			return fmt.Sprintf("doesn't provide the %s column", column)
+		}
+	}
+	for _, column := range spanIdColumnNames {
+		if typ := columns[column]; idFormat(typ) != a.ids {
+			return fmt.Sprintf("has a %s %s instead of %s ids", typ, column, a.ids)
+		}
+	}
+	return ""
+}
+
+// selectedColumns returns the id and optional columns to select with the
+// adapter, with their detected types
+func (a *schemaAdapter) selectedColumns(columns map[string]string) map[string]string {
+	selected := make(map[string]string, len(a.columns)+len(spanIdColumnNames))
+	for _, column := range a.columns {
+		selected[column] = columns[column]
+	}
+	for _, column := range spanIdColumnNames {
+		selected[column] = columns[column]
+	}
+	return selected
+}
+
+// extensionVersion returns the installed pg_tracing version, empty when it
+// can't be read
+func extensionVersion(ctx context.Context, conn *pgx.Conn) string {
+	var version string
+	if err := conn.QueryRow(ctx, "select extversion from pg_extension where extname = 'pg_tracing'").Scan(&version); err != nil {
+		return ""
+	}
+	return version
+}
+
+// spanSchema returns the columns to select for the installed pg_tracing,
+// with their types, from the adapter of its version
+func spanSchema(ctx context.Context, conn *pgx.Conn, logger *log.Logger) (map[string]string, *schemaAdapter, error) {
+	columns, err := detectSpanColumns(ctx, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	selected, adapter := resolveSchema(columns, extensionVersion(ctx, conn), logger)
+	return selected, adapter, nil
+}
+
+// resolveSchema returns the columns to select from the detected ones with
+// the adapter of version. The detected columns are used when the version is
+// unknown or doesn't match its adapter's schema.
+func resolveSchema(columns map[string]string, version string, logger *log.Logger) (map[string]string, *schemaAdapter) {
+	adapter := adapterForVersion(version)
+	if adapter == nil {
+		logger.Printf("No schema adapter for pg_tracing %q, using the detected columns", version)
+		return columns, nil
+	}
+	if reason := adapter.mismatch(columns); reason != "" {
+		logger.Printf("pg_tracing %s %s of the %s schema, using the detected columns", version, reason, adapter.name)
+		return columns, nil
+	}
+	return adapter.selectedColumns(columns), adapter
+}
+
+// describeAdapter names the adapter used for logs and reports
+func describeAdapter(adapter *schemaAdapter) string {
+	if adapter == nil {
+		return "detected columns"
+	}
+	return fmt.Sprintf("%s schema (pg_tracing %s+)", adapter.name, adapter.minVersion)
+}
@@ -0,0 +1,214 @@
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// schemaFixture is the pg_tracing_consume_spans schema of a version, with
+// a span row in text format
+type schemaFixture struct {
+	Version string `json:"version"`
+	// Adapter is the expected adapter, empty for the detected columns
+	Adapter string             `json:"adapter"`
+	Columns map[string]string  `json:"columns"`
+	Row     map[string]*string `json:"row"`
+}
+
+// baseColumnTypes are the types of the columns shared by all schemas
+var baseColumnTypes = map[string]string{
+	"span_type": "text", "span_operation": "text", "deparse_info": "text", "parameters": "text",
+	"span_start": "timestamp with time zone",
+	"startup":    "bigint", "pid": "integer", "subxact_count": "smallint", "sql_error_code": "text", "rows": "bigint",
+	"plan_startup_cost": "double precision", "plan_total_cost": "double precision", "plan_rows": "double precision", "plan_width": "integer",
+	"blk_read_time": "double precision", "blk_write_time": "double precision",
+	"temp_blk_read_time": "double precision", "temp_blk_write_time": "double precision",
+	"jit_generation_time": "double precision", "jit_inlining_time": "double precision",
+	"jit_optimization_time": "double precision", "jit_emission_time": "double precision",
+}
+
+var baseRow = map[string]string{
+	"span_type": "Select query", "span_operation": "select 1;", "span_start": "2024-03-01 12:00:00.000123+00",
+	"pid": "4242", "subxact_count": "0", "sql_error_code": "00000",
+}
+
+var typeOids = map[string]uint32{
+	"bigint": pgtype.Int8OID, "integer": pgtype.Int4OID, "smallint": pgtype.Int2OID,
+	"text": pgtype.TextOID, "uuid": pgtype.UUIDOID, "oid": pgtype.OIDOID,
+	"double precision": pgtype.Float8OID, "timestamp with time zone": pgtype.TimestamptzOID,
+}
+
+// fixtureRows returns the fixture's row as pgx decodes text-format results
+type fixtureRows struct {
+	pgx.Rows
+	types  *pgtype.Map
+	fields []pgconn.FieldDescription
+	values [][]byte
+	format int16
+	read   bool
+}
+
+func (r *fixtureRows) Close()                                       {}
+func (r *fixtureRows) Err() error                                   { return nil }
+func (r *fixtureRows) FieldDescriptions() []pgconn.FieldDescription { return r.fields }
+
+func (r *fixtureRows) Next() bool {
+	next := !r.read
+	r.read = true
+	return next
+}
+
+func (r *fixtureRows) Scan(dest ...any) error {
+	if len(dest) != len(r.fields) {
+		return fmt.Errorf("%d scan targets for %d columns", len(dest), len(r.fields))
+	}
+	for i, d := range dest {
+		if err := r.types.Scan(r.fields[i].DataTypeOID, r.format, r.values[i], d); err != nil {
+			return fmt.Errorf("failed to scan %s: %w", r.fields[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// newFixtureRows returns the fixture's row for the columns selected by q
+func newFixtureRows(t testing.TB, fixture schemaFixture, q *spanQuery) *fixtureRows {
+	t.Helper()
+	rows := &fixtureRows{types: pgtype.NewMap()}
+	columns := requiredSpanColumns()
+	for _, column := range q.optional {
+		columns = append(columns, column.name)
+	}
+	for _, column := range columns {
+		typ, ok := fixture.Columns[column]
+		if !ok {
+			typ = baseColumnTypes[column]
+		}
+		if idExpression(column, typ) != column {
+			// Ids are cast to text by the query
+			typ = "text"
+		}
+		oid, ok := typeOids[typ]
+		if !ok {
+			oid = pgtype.Int8OID
+		}
+		rows.fields = append(rows.fields, pgconn.FieldDescription{Name: column, DataTypeOID: oid})
+		var value []byte
+		if v, ok := fixture.Row[column]; ok {
+			if v != nil {
+				value = []byte(*v)
+			}
+		} else if v, ok := baseRow[column]; ok {
+			value = []byte(v)
+		}
+		rows.values = append(rows.values, value)
+	}
+	return rows
+}
+
+// binary re-encodes the row in binary format, as sent for a prepared
+// statement
+func (r *fixtureRows) binary(t testing.TB) {
+	t.Helper()
+	for i, field := range r.fields {
+		if r.values[i] == nil {
+			continue
+		}
+		var value any
+		if err := r.types.Scan(field.DataTypeOID, pgtype.TextFormatCode, r.values[i], &value); err != nil {
+			t.Fatalf("failed to decode %s: %v", field.Name, err)
+		}
+		encoded, err := r.types.Encode(field.DataTypeOID, pgtype.BinaryFormatCode, value, nil)
+		if err != nil {
+			t.Fatalf("failed to encode %s: %v", field.Name, err)
+		}
+		r.values[i] = encoded
+	}
+	r.format = pgtype.BinaryFormatCode
+}
+
+func describeSpanRow(r *spanRow) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "trace_id: %016x%016x\n", uint64(r.traceId), uint64(r.traceIdLow))
+	fmt.Fprintf(&b, "parent_id: %016x\n", uint64(r.parentId))
+	fmt.Fprintf(&b, "span_id: %016x\n", uint64(r.spanId))
+	fmt.Fprintf(&b, "start: %s\n", r.startTime().Format("2006-01-02T15:04:05.000000000Z07:00"))
+	fmt.Fprintf(&b, "end: %s\n", r.endTime().Format("2006-01-02T15:04:05.000000000Z07:00"))
+	fmt.Fprintf(&b, "query_id: %v\n", r.queryId)
+	if r.dbId != nil && r.userId != nil {
+		fmt.Fprintf(&b, "dbid: %d, userid: %d\n", *r.dbId, *r.userId)
+	}
+	fmt.Fprintf(&b, "malformed: %v\n", r.malformed)
+	return b.String()
+}
+
+func readSchemaFixture(t testing.TB, path string) (schemaFixture, map[string]string) {
+	t.Helper()
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture schemaFixture
+	if err := json.Unmarshal(encoded, &fixture); err != nil {
+		t.Fatal(err)
+	}
+	columns := make(map[string]string, len(baseColumnTypes)+len(fixture.Columns))
+	for column, typ := range baseColumnTypes {
+		columns[column] = typ
+	}
+	for column, typ := range fixture.Columns {
+		columns[column] = typ
+	}
+	return fixture, columns
+}
+
+func TestSchemaFixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "schemas", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no schema fixture: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			fixture, columns := readSchemaFixture(t, path)
+			selected, adapter := resolveSchema(columns, fixture.Version, logger)
+			adapterName := ""
+			if adapter != nil {
+				adapterName = adapter.name
+			}
+			if adapterName != fixture.Adapter {
+				t.Fatalf("pg_tracing %s read with the %q adapter, expected %q", fixture.Version, adapterName, fixture.Adapter)
+			}
+			q := newSpanQuery(selected, "pg_tracing_consume_spans", "", FetchConfig{})
+			spanRows, err := q.collectSpanRows(newFixtureRows(t, fixture, q))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(spanRows) != 1 {
+				t.Fatalf("%d rows scanned", len(spanRows))
+			}
+			got := q.sql + "\n\n" + describeSpanRow(spanRows[0])
+			checkGolden(t, filepath.Join("testdata", "schemas", name+".golden"), []byte(got))
+
+			binaryRows := newFixtureRows(t, fixture, q)
+			binaryRows.binary(t)
+			binarySpanRows, err := q.collectSpanRows(binaryRows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text, binary := describeSpanRow(spanRows[0]), describeSpanRow(binarySpanRows[0]); text != binary {
+				t.Fatalf("binary row differs from the text row:\n%s\n%s", binary, text)
+			}
+		})
+	}
+}
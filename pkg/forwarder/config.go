@@ -0,0 +1,859 @@
+package forwarder
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the forwarder settings read from the YAML configuration file.
+type Config struct {
+	// PollInterval is the delay between two span fetches when running continuously.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// SummaryInterval is the delay between two summary log lines. Zero
+	// disables the summary.
+	SummaryInterval time.Duration    `yaml:"summary_interval"`
+	Attributes      AttributesConfig `yaml:"attributes"`
+	Limits          LimitsConfig     `yaml:"limits"`
+	SpanNames       SpanNamesConfig  `yaml:"span_names"`
+	// SpanKinds overrides the span kind for the given span types.
+	SpanKinds map[string]string `yaml:"span_kinds"`
+	Relabel   []RelabelConfig   `yaml:"relabel"`
+	Transform TransformConfig   `yaml:"transform"`
+	Resource  ResourceConfig    `yaml:"resource"`
+	// Orphans is how spans with a missing parent are handled: none
+	// (default), tag or synthesize.
+	Orphans string `yaml:"orphans"`
+	// Subtransactions is how savepoint boundaries are represented: none
+	// (default), events on the parent span or attributes on the savepoint spans.
+	Subtransactions string              `yaml:"subtransactions"`
+	TraceAssembly   TraceAssemblyConfig `yaml:"trace_assembly"`
+	Buffer          BufferConfig        `yaml:"buffer"`
+	Fetch           FetchConfig         `yaml:"fetch"`
+	// Columns maps result columns to attributes, overriding the default
+	// mappings or exporting the extra columns of the fetch query.
+	Columns []ColumnConfig `yaml:"columns"`
+	// Plugins are the paths of Go plugins providing span transformers and
+	// exporters.
+	Plugins []string `yaml:"plugins"`
+	// ConversionWorkers is the number of goroutines converting spans. Zero
+	// or one converts them sequentially.
+	ConversionWorkers int         `yaml:"conversion_workers"`
+	Dedup             DedupConfig `yaml:"dedup"`
+	// PgStatStatements enriches spans with pg_stat_statements' normalized
+	// query and cumulative statistics, matched on query_id.
+	PgStatStatements bool `yaml:"pg_stat_statements"`
+	// PgTracingSettings are the pg_tracing GUCs set with ALTER SYSTEM, and
+	// checked on each poll.
+	PgTracingSettings map[string]string `yaml:"pg_tracing_settings"`
+	OidCache          OidCacheConfig    `yaml:"oid_cache"`
+	Clock             ClockConfig       `yaml:"clock"`
+	Exporter          ExporterConfig    `yaml:"exporter"`
+	// Routes send matching traces to other endpoints than the exporter's.
+	// The first matching route wins.
+	Routes []RouteConfig `yaml:"routes"`
+	Sinks  SinksConfig   `yaml:"sinks"`
+	HTTP   HTTPConfig    `yaml:"http"`
+	Admin  AdminConfig   `yaml:"admin"`
+	// Metrics exports the forwarder's own metrics over OTLP.
+	Metrics MetricsConfig `yaml:"metrics"`
+	// Logs emits OTLP log records for error spans.
+	Logs LogsConfig `yaml:"logs"`
+	// Targets lists the Postgres instances to poll. Empty polls the
+	// DATABASE_URL instance.
+	Targets []TargetConfig `yaml:"targets"`
+	// Discovery adds the targets listed by a query or a file.
+	Discovery DiscoveryConfig `yaml:"discovery"`
+	HA        HAConfig        `yaml:"ha"`
+	Shard     ShardConfig     `yaml:"shard"`
+	// Connection sets up the sessions of the targets' connections.
+	Connection ConnectionConfig `yaml:"connection"`
+	// Collector sets up the connections to the OTLP endpoints of the
+	// exporter, routes, metrics and logs.
+	Collector CollectorConfig `yaml:"collector"`
+
+	// LogLevel is info (default), or debug to log the span query and the
+	// fetched spans.
+	LogLevel string `yaml:"log_level"`
+	// LogSampling logs one fetched span out of LogSampling at debug level.
+	LogSampling int `yaml:"log_sampling"`
+
+	// UnsupportedVersions is how pg_tracing versions outside the supported
+	// range are handled: warn (default) or refuse.
+	UnsupportedVersions string `yaml:"unsupported_versions"`
+
+	// DryRun peeks spans instead of consuming them
+	DryRun bool `yaml:"-"`
+	// Target is the name of the target polled with this configuration
+	Target string `yaml:"-"`
+	// BootstrapRole is the role created with the extension, bootstrap is
+	// disabled when empty
+	BootstrapRole string `yaml:"-"`
+	// SpanProcessors are registered on the targets' TracerProviders
+	SpanProcessors []sdktrace.SpanProcessor `yaml:"-"`
+	// SpanTransformers run after the built-in transformers
+	SpanTransformers []SpanTransformer `yaml:"-"`
+	// SpanExporter replaces the configured exporter when set
+	SpanExporter sdktrace.SpanExporter `yaml:"-"`
+}
+
+// AttributesConfig selects which attribute families are exported.
+type AttributesConfig struct {
+	// Include lists the families to export. An empty list exports all families.
+	Include []string `yaml:"include"`
+	// Exclude lists the families to drop, applied after Include.
+	Exclude []string `yaml:"exclude"`
+}
+
+// LimitsConfig caps the length of exported strings. A zero value disables the limit.
+type LimitsConfig struct {
+	MaxSpanNameLength  int `yaml:"max_span_name_length"`
+	MaxStatementLength int `yaml:"max_statement_length"`
+	MaxAttributeLength int `yaml:"max_attribute_length"`
+}
+
+// SpanNamesConfig holds the templates used to build span names.
+// Templates accept the {span_type}, {operation} and {deparse_info} placeholders.
+type SpanNamesConfig struct {
+	// Default is used for span types without a dedicated template.
+	Default string `yaml:"default"`
+	// BySpanType overrides the template for the given span types.
+	BySpanType map[string]string `yaml:"by_span_type"`
+	// ExcludeDeparseInfo renders {deparse_info} as empty, keeping span names
+	// stable. deparse_info is still exported as an attribute.
+	ExcludeDeparseInfo bool `yaml:"exclude_deparse_info"`
+}
+
+// RelabelConfig is a rule rewriting span attributes.
+type RelabelConfig struct {
+	// Source is the attribute whose value is matched against Regex.
+	Source string `yaml:"source"`
+	// Regex must match the whole value. Defaults to (.*).
+	Regex string `yaml:"regex"`
+	// Target is the attribute written by the replace action.
+	Target string `yaml:"target"`
+	// Replacement is the value written to Target, with $N expansions. Defaults to $1.
+	// A $1 replacement of the whole value keeps the value's type.
+	Replacement string `yaml:"replacement"`
+	// Action is one of replace (default), drop or keep.
+	Action string `yaml:"action"`
+}
+
+// TransformConfig holds OTTL statements executed on every span, after relabeling.
+type TransformConfig struct {
+	Statements []string `yaml:"statements"`
+	// Transformers lists the built-in span transformers run after the
+	// statements: drop_planner or redact_parameters.
+	Transformers []string `yaml:"transformers"`
+	// Wasm lists the paths of WASM modules transforming spans, run after
+	// the built-in transformers.
+	Wasm []string `yaml:"wasm"`
+	// Lua lists the paths of Lua scripts transforming spans, run after the
+	// WASM modules.
+	Lua []string `yaml:"lua"`
+}
+
+// ResourceConfig holds extra resource attributes added to all spans.
+type ResourceConfig struct {
+	// ServiceName is a template for service.name accepting the {cluster_name},
+	// {database}, {host} and {system_identifier} placeholders.
+	ServiceName string            `yaml:"service_name"`
+	Attributes  map[string]string `yaml:"attributes"`
+	// Detectors lists the resource detectors to run at startup.
+	Detectors []string `yaml:"detectors"`
+}
+
+// TraceAssemblyConfig controls how spans are grouped per trace before export.
+type TraceAssemblyConfig struct {
+	// Window is how long a trace is buffered after its last received span.
+	Window time.Duration `yaml:"window"`
+}
+
+// FetchConfig controls how spans are read from pg_tracing.
+type FetchConfig struct {
+	// ChunkSize streams the spans through a server-side cursor, reading
+	// this many rows at a time. Zero reads them with a single query.
+	ChunkSize int `yaml:"chunk_size"`
+	// Query replaces the span query, selecting {columns} from {source}.
+	// Columns selected after {columns} are added as attributes.
+	Query string `yaml:"query"`
+	// SelectAll selects all the columns of pg_tracing, the unknown ones
+	// being added as attributes.
+	SelectAll bool `yaml:"select_all"`
+}
+
+// ColumnConfig maps a result column to an attribute.
+type ColumnConfig struct {
+	Column string `yaml:"column"`
+	// Attribute is the attribute name, the column's by default.
+	Attribute string `yaml:"attribute"`
+	// Type is int, float, string or bool, inferred from the value by
+	// default.
+	Type string `yaml:"type"`
+	// OmitZero skips zero and empty values, the default of the pg_tracing
+	// metric columns.
+	OmitZero *bool `yaml:"omit_zero"`
+}
+
+// BufferConfig bounds the spans held in memory while assembling traces.
+type BufferConfig struct {
+	// MaxSpans is the number of buffered spans. Zero doesn't bound them.
+	MaxSpans int `yaml:"max_spans"`
+	// DropPolicy is newest (default) to drop the incoming spans when full,
+	// or oldest to drop the least recently updated traces.
+	DropPolicy string `yaml:"drop_policy"`
+}
+
+// DedupConfig controls the duplicate span suppression cache.
+type DedupConfig struct {
+	// Size is the maximum number of remembered spans. 0 disables deduplication.
+	Size int `yaml:"size"`
+	// TTL is how long a span is remembered. 0 keeps spans until evicted by Size.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// OidCacheConfig controls the caches resolving OIDs to names.
+type OidCacheConfig struct {
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// ClockConfig controls the sanity checks of span timestamps.
+type ClockConfig struct {
+	// MaxSkew is the maximum distance between a span's start and the current
+	// time. 0 disables the check.
+	MaxSkew time.Duration `yaml:"max_skew"`
+	// Action is applied to spans with invalid timestamps: clamp (default) or reject.
+	Action string `yaml:"action"`
+}
+
+// ExporterConfig selects where spans are exported.
+type ExporterConfig struct {
+	// Type is otlp (default), console, pretty-printing spans to stdout, file,
+	// kafka, jaeger (deprecated), datadog or xray.
+	Type string `yaml:"type"`
+	// Endpoint is the default OTLP endpoint.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are sent with the OTLP exports, to the endpoint and routes.
+	Headers map[string]string `yaml:"headers"`
+	Batch   BatchConfig       `yaml:"batch"`
+	// Backpressure pauses consumption while the export queue is full.
+	Backpressure BackpressureConfig    `yaml:"backpressure"`
+	File         FileExporterConfig    `yaml:"file"`
+	Kafka        KafkaExporterConfig   `yaml:"kafka"`
+	Jaeger       JaegerExporterConfig  `yaml:"jaeger"`
+	Datadog      DatadogExporterConfig `yaml:"datadog"`
+	XRay         XRayExporterConfig    `yaml:"xray"`
+}
+
+// BatchConfig tunes the batch span processor queuing the spans of the
+// exporter. Zero values keep the SDK's defaults.
+type BatchConfig struct {
+	// MaxQueueSize is the number of spans queued before dropping them,
+	// 2048 by default.
+	MaxQueueSize int `yaml:"max_queue_size"`
+	// MaxExportBatchSize is the number of spans of an export, 512 by default.
+	MaxExportBatchSize int `yaml:"max_export_batch_size"`
+	// BatchTimeout is the delay before exporting an incomplete batch, 5s by
+	// default.
+	BatchTimeout time.Duration `yaml:"batch_timeout"`
+	// ExportTimeout bounds an export, 30s by default.
+	ExportTimeout time.Duration `yaml:"export_timeout"`
+}
+
+// BackpressureConfig pauses the consumption of spans when the export queue
+// fills up, e.g. with a slow or unavailable collector.
+type BackpressureConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// PauseAt is the ratio of the queue size pausing consumption, 0.8 by
+	// default.
+	PauseAt float64 `yaml:"pause_at"`
+	// ResumeAt is the ratio of the queue size resuming it, 0.5 by default.
+	ResumeAt float64 `yaml:"resume_at"`
+}
+
+// FileExporterConfig controls the file exporter, writing spans as OTLP JSON lines.
+type FileExporterConfig struct {
+	Path string `yaml:"path"`
+	// MaxSize is the size in bytes after which the file is rotated. 0 disables
+	// size based rotation.
+	MaxSize int64 `yaml:"max_size"`
+	// MaxAge is the age after which the file is rotated. 0 disables time
+	// based rotation.
+	MaxAge time.Duration `yaml:"max_age"`
+	// Gzip compresses rotated files.
+	Gzip bool `yaml:"gzip"`
+}
+
+// RouteConfig matches traces with at least one span satisfying all the
+// conditions. Conditions are regexes that must match the whole value.
+type RouteConfig struct {
+	Name     string `yaml:"name"`
+	Endpoint string `yaml:"endpoint"`
+	// Database matches the db.name attribute.
+	Database string `yaml:"database"`
+	SpanName string `yaml:"span_name"`
+	// Attributes maps attribute names to the regex their value must match.
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// KafkaExporterConfig controls the kafka exporter, publishing one message per trace.
+type KafkaExporterConfig struct {
+	Brokers []string `yaml:"brokers"`
+	// Topic defaults to otlp_spans.
+	Topic string `yaml:"topic"`
+	// Encoding is otlp_proto (default) or otlp_json.
+	Encoding string          `yaml:"encoding"`
+	Auth     KafkaAuthConfig `yaml:"auth"`
+}
+
+// KafkaAuthConfig holds the kafka credentials.
+type KafkaAuthConfig struct {
+	// Mechanism is the SASL mechanism: plain, scram-sha-256 or scram-sha-512.
+	// Empty disables SASL.
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	TLS       bool   `yaml:"tls"`
+}
+
+// JaegerExporterConfig controls the deprecated jaeger exporter.
+type JaegerExporterConfig struct {
+	// Endpoint is the collector's HTTP endpoint. Defaults to
+	// http://localhost:14268/api/traces.
+	Endpoint string `yaml:"endpoint"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Agent is the host:port of a jaeger agent, receiving spans over UDP
+	// instead of the collector.
+	Agent string `yaml:"agent"`
+}
+
+// DatadogExporterConfig controls the datadog exporter. Service, Env and
+// Version default to the service.name, deployment.environment and
+// service.version resource attributes.
+type DatadogExporterConfig struct {
+	// Agent is the URL of the Datadog agent. Defaults to
+	// http://localhost:8126 without APIKey.
+	Agent string `yaml:"agent"`
+	// APIKey sends spans to the intake of Site instead of an agent
+	APIKey string `yaml:"api_key"`
+	// Site is the Datadog site of the intake. Defaults to datadoghq.com.
+	Site    string `yaml:"site"`
+	Service string `yaml:"service"`
+	Env     string `yaml:"env"`
+	Version string `yaml:"version"`
+}
+
+// XRayExporterConfig controls the xray exporter.
+type XRayExporterConfig struct {
+	// Daemon is the UDP address of the X-Ray daemon. Defaults to 127.0.0.1:2000.
+	Daemon string `yaml:"daemon"`
+	// Origin is the AWS resource type of segments, e.g. AWS::RDS::DBInstance.
+	Origin string `yaml:"origin"`
+}
+
+// HTTPConfig controls the HTTP server of the run subcommand.
+type HTTPConfig struct {
+	// Listen is the address of the HTTP server, e.g. :8080. Empty disables it.
+	Listen string `yaml:"listen"`
+}
+
+// MetricsConfig controls the export of the forwarder's metrics.
+type MetricsConfig struct {
+	// Endpoint is the OTLP gRPC endpoint receiving the metrics. Empty
+	// disables metrics.
+	Endpoint string `yaml:"endpoint"`
+	// Interval is the delay between two metric exports.
+	Interval time.Duration `yaml:"interval"`
+	// Prometheus serves the metrics on the HTTP server's /metrics endpoint.
+	Prometheus bool `yaml:"prometheus"`
+	// Exemplars attaches the trace and span ids of recorded spans to the
+	// duration metrics.
+	Exemplars bool `yaml:"exemplars"`
+	// SpanMetrics aggregates the consumed spans into call and duration
+	// metrics per operation fingerprint and database.
+	SpanMetrics bool `yaml:"span_metrics"`
+	// IOMetrics aggregates the block, WAL and JIT counters of statements
+	// into cumulative metrics per operation fingerprint and database.
+	IOMetrics bool `yaml:"io_metrics"`
+}
+
+// LogsConfig controls the log records emitted for spans with an error.
+type LogsConfig struct {
+	// Endpoint is the OTLP gRPC endpoint receiving the log records. Empty
+	// disables them.
+	Endpoint string `yaml:"endpoint"`
+}
+
+// TargetConfig is a Postgres instance polled by its own worker, with its
+// own connection and resource.
+type TargetConfig struct {
+	// Name identifies the target in logs, metrics and the admin API.
+	Name string `yaml:"name"`
+	// DSN is the connection string of the instance.
+	DSN      string               `yaml:"dsn"`
+	Resource TargetResourceConfig `yaml:"resource"`
+	// Headers are added to the exporter's OTLP headers, e.g. the tenant's
+	// X-Scope-OrgID.
+	Headers map[string]string `yaml:"headers"`
+	// PasswordFile overrides the connection's password file for this target.
+	PasswordFile string `yaml:"password_file"`
+	// VaultRole overrides the Vault role issuing this target's credentials.
+	VaultRole string `yaml:"vault_role"`
+}
+
+// TargetResourceConfig holds the resource of a target, added to the common
+// one.
+type TargetResourceConfig struct {
+	// ServiceName overrides the common service name template.
+	ServiceName string            `yaml:"service_name"`
+	Attributes  map[string]string `yaml:"attributes"`
+}
+
+// DiscoveryConfig controls the discovery of targets, polled in addition to
+// the static ones.
+type DiscoveryConfig struct {
+	SQL        SQLDiscoveryConfig        `yaml:"sql"`
+	Kubernetes KubernetesDiscoveryConfig `yaml:"kubernetes"`
+	// File is a YAML or JSON file listing targets, with the schema of the
+	// targets setting.
+	File string `yaml:"file"`
+	// Interval is the delay between two discoveries.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// SQLDiscoveryConfig lists targets with a query on an inventory database.
+type SQLDiscoveryConfig struct {
+	// DSN is the connection string of the inventory database.
+	DSN string `yaml:"dsn"`
+	// Query returns the name and dsn columns of the targets. Other columns
+	// are added to the targets' resource attributes.
+	Query string `yaml:"query"`
+}
+
+// KubernetesDiscoveryConfig lists the pods or services matching a label
+// selector, with the forwarder's service account.
+type KubernetesDiscoveryConfig struct {
+	// Namespace defaults to the forwarder's.
+	Namespace     string `yaml:"namespace"`
+	LabelSelector string `yaml:"label_selector"`
+	// Kind is pods (default), polling each running pod, or services.
+	Kind string `yaml:"kind"`
+}
+
+// HAConfig controls the election of the replica consuming a target's spans,
+// when several forwarders poll the same instance.
+type HAConfig struct {
+	// Mode is none (default), consuming spans unconditionally,
+	// advisory_lock or kubernetes_lease.
+	Mode string `yaml:"mode"`
+	// LockId is the key of the advisory lock.
+	LockId int64       `yaml:"lock_id"`
+	Lease  LeaseConfig `yaml:"lease"`
+}
+
+// LeaseConfig controls the Kubernetes Lease of the kubernetes_lease HA mode.
+type LeaseConfig struct {
+	// Name is suffixed by the target's name.
+	Name string `yaml:"name"`
+	// Namespace defaults to the forwarder's.
+	Namespace string `yaml:"namespace"`
+	// Duration is how long the Lease is valid without renewal. It's renewed
+	// on each poll and must be longer than the poll interval.
+	Duration time.Duration `yaml:"duration"`
+}
+
+// ShardConfig splits the spans of an instance across forwarders, each
+// peeking the traces of its shard.
+type ShardConfig struct {
+	// Count is the number of forwarders. 0 or 1 disables sharding.
+	Count int `yaml:"count"`
+	// Index is the shard of this forwarder, from 0 to Count-1.
+	Index int `yaml:"index"`
+}
+
+// ConnectionConfig holds the session settings of the connections to the
+// targets, identifying the forwarder and bounding its queries.
+type ConnectionConfig struct {
+	// ApplicationName is overridden by an application_name set in the DSN.
+	ApplicationName string `yaml:"application_name"`
+	// StatementTimeout bounds the forwarder's queries. Zero keeps the
+	// server's default.
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	// IdleInTransactionTimeout terminates the session when idle in a
+	// transaction. Zero keeps the server's default.
+	IdleInTransactionTimeout time.Duration `yaml:"idle_in_transaction_timeout"`
+	// PasswordFile holds the password, read again on each connection, e.g.
+	// a mounted secret. It replaces the DSN's password.
+	PasswordFile string     `yaml:"password_file"`
+	Auth         AuthConfig `yaml:"auth"`
+	SSL          SSLConfig  `yaml:"ssl"`
+}
+
+// SSLConfig holds the libpq SSL parameters, added to the DSNs not setting
+// them.
+type SSLConfig struct {
+	// Mode is one of disable, allow, prefer, require, verify-ca or
+	// verify-full.
+	Mode     string `yaml:"mode"`
+	RootCert string `yaml:"root_cert"`
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+}
+
+// AuthConfig selects how the connections' password is obtained.
+type AuthConfig struct {
+	// Type is password (default) to use the DSN's, azure_ad or vault.
+	Type  string          `yaml:"type"`
+	Azure AzureAuthConfig `yaml:"azure"`
+	Vault VaultAuthConfig `yaml:"vault"`
+}
+
+// VaultAuthConfig reads credentials from a Vault database secrets engine.
+type VaultAuthConfig struct {
+	// Address defaults to VAULT_ADDR.
+	Address string `yaml:"address"`
+	// Mount is the path of the secrets engine, database by default.
+	Mount string `yaml:"mount"`
+	// Role is the secrets engine role issuing the credentials.
+	Role string `yaml:"role"`
+	// TokenFile holds the Vault token, VAULT_TOKEN being used otherwise.
+	TokenFile  string                    `yaml:"token_file"`
+	Kubernetes VaultKubernetesAuthConfig `yaml:"kubernetes"`
+}
+
+// VaultKubernetesAuthConfig logs in to Vault with the pod's service account.
+type VaultKubernetesAuthConfig struct {
+	Role string `yaml:"role"`
+	// Mount is the path of the auth method, kubernetes by default.
+	Mount string `yaml:"mount"`
+}
+
+// AzureAuthConfig authenticates with Entra ID tokens, using a managed
+// identity or a service principal.
+type AzureAuthConfig struct {
+	// ClientId selects a user-assigned managed identity, or is the service
+	// principal's application id.
+	ClientId string `yaml:"client_id"`
+	// TenantId and ClientSecretFile authenticate as a service principal.
+	TenantId         string `yaml:"tenant_id"`
+	ClientSecretFile string `yaml:"client_secret_file"`
+}
+
+// CollectorConfig holds the settings of the gRPC connections to the
+// collectors.
+type CollectorConfig struct {
+	TLS TLSConfig `yaml:"tls"`
+	// Proxy is the http:// or https:// proxy tunneling the connections
+	// with CONNECT. HTTPS_PROXY and NO_PROXY are honored when empty.
+	Proxy string `yaml:"proxy"`
+	// NoProxy lists the hosts reached without the proxy, as NO_PROXY.
+	NoProxy   string                   `yaml:"no_proxy"`
+	Keepalive CollectorKeepaliveConfig `yaml:"keepalive"`
+	Backoff   CollectorBackoffConfig   `yaml:"backoff"`
+	// MaxSendMessageSize bounds the size in bytes of an export request.
+	// Zero keeps gRPC's default.
+	MaxSendMessageSize int `yaml:"max_send_message_size"`
+	// MaxRecvMessageSize bounds the size in bytes of an export response.
+	// Zero keeps gRPC's default.
+	MaxRecvMessageSize int `yaml:"max_recv_message_size"`
+}
+
+// CollectorKeepaliveConfig pings idle connections, detecting collectors
+// gone away. A zero Time disables the pings.
+type CollectorKeepaliveConfig struct {
+	Time    time.Duration `yaml:"time"`
+	Timeout time.Duration `yaml:"timeout"`
+	// PermitWithoutStream pings while no export is running.
+	PermitWithoutStream bool `yaml:"permit_without_stream"`
+}
+
+// CollectorBackoffConfig is the delay between two connection attempts to
+// an unavailable collector, growing from BaseDelay to MaxDelay.
+type CollectorBackoffConfig struct {
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+}
+
+// TLSConfig enables TLS with files reloaded when rotated.
+type TLSConfig struct {
+	// Enabled uses TLS with the system CAs, implied when a file is set.
+	Enabled bool `yaml:"enabled"`
+	// CAFile replaces the system CAs to verify the server.
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate and its key.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+func (c TLSConfig) enabled() bool {
+	return c.Enabled || c.CAFile != "" || c.CertFile != ""
+}
+
+// AdminConfig controls the admin API of the run subcommand.
+type AdminConfig struct {
+	// Listen is the address of the admin API, e.g. 127.0.0.1:8081. Empty
+	// disables it.
+	Listen string `yaml:"listen"`
+	// TokenFile holds the bearer token required by the admin API.
+	TokenFile string `yaml:"token_file"`
+}
+
+// SinksConfig holds the sinks receiving the raw span rows, in addition to the exporter.
+type SinksConfig struct {
+	Parquet    ParquetSinkConfig    `yaml:"parquet"`
+	ClickHouse ClickHouseSinkConfig `yaml:"clickhouse"`
+}
+
+// ParquetSinkConfig controls the Parquet sink. An empty Directory disables it.
+type ParquetSinkConfig struct {
+	// Directory receives the files, partitioned by span start date and hour.
+	Directory string `yaml:"directory"`
+	// MaxRows is the number of rows buffered per partition before a file is
+	// written. Defaults to 100000.
+	MaxRows int `yaml:"max_rows"`
+}
+
+// ClickHouseSinkConfig controls the ClickHouse sink, inserting the converted
+// spans in a table with the collector's clickhouse exporter schema. An empty
+// Endpoint disables it.
+type ClickHouseSinkConfig struct {
+	// Endpoint is the URL of ClickHouse's HTTP interface.
+	Endpoint string `yaml:"endpoint"`
+	Database string `yaml:"database"`
+	// Table defaults to otel_traces.
+	Table    string `yaml:"table"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// DefaultConfig returns the configuration used when no file is given
+func DefaultConfig() *Config {
+	return &Config{
+		PollInterval: 5 * time.Second,
+		Orphans:      orphanNone,
+		Exporter: ExporterConfig{
+			Type:     exporterOtlp,
+			Endpoint: defaultOtlpEndpoint,
+			Backpressure: BackpressureConfig{
+				PauseAt:  0.8,
+				ResumeAt: 0.5,
+			},
+		},
+		OidCache: OidCacheConfig{
+			RefreshInterval: 5 * time.Minute,
+		},
+		Metrics: MetricsConfig{
+			Interval: 30 * time.Second,
+		},
+		Discovery: DiscoveryConfig{
+			Interval: 30 * time.Second,
+		},
+		Connection: ConnectionConfig{
+			ApplicationName: "pg-tracing-forwarder",
+		},
+		Collector: CollectorConfig{
+			Backoff: CollectorBackoffConfig{
+				BaseDelay: time.Second,
+				MaxDelay:  30 * time.Second,
+			},
+		},
+		HA: HAConfig{
+			LockId: defaultHALockId,
+			Lease: LeaseConfig{
+				Name:     "pg-tracing-forwarder",
+				Duration: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// LoadConfig reads and validates a YAML configuration file, applied over the
+// defaults. An empty path returns the defaults.
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses a YAML configuration, using the defaults for missing
+// settings
+func ParseConfig(content []byte) (*Config, error) {
+	cfg := DefaultConfig()
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if _, err := newAttributeFilter(c.Attributes); err != nil {
+		return err
+	}
+	if _, err := newSpanNameTemplates(c.SpanNames); err != nil {
+		return err
+	}
+	if _, err := newSpanTransformers(c.Transform.Transformers, nil); err != nil {
+		return err
+	}
+	if err := validatePlugins(c.Plugins); err != nil {
+		return err
+	}
+	for _, path := range c.Transform.Wasm {
+		if path == "" {
+			return fmt.Errorf("wasm module path can't be empty")
+		}
+	}
+	for _, path := range c.Transform.Lua {
+		if _, err := compileLuaScript(path); err != nil {
+			return err
+		}
+	}
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive")
+	}
+	if c.Admin.Listen != "" && c.Admin.TokenFile == "" {
+		return fmt.Errorf("admin API requires a token_file")
+	}
+	if c.Metrics.Interval <= 0 {
+		return fmt.Errorf("metrics interval must be positive")
+	}
+	if c.Metrics.SpanMetrics && !metricsEnabled(c.Metrics) {
+		return fmt.Errorf("span metrics require a metrics endpoint or prometheus")
+	}
+	if c.Metrics.IOMetrics && !metricsEnabled(c.Metrics) {
+		return fmt.Errorf("I/O metrics require a metrics endpoint or prometheus")
+	}
+	if c.Metrics.Prometheus && c.HTTP.Listen == "" {
+		return fmt.Errorf("prometheus metrics require http.listen")
+	}
+	if c.SummaryInterval < 0 {
+		return fmt.Errorf("summary interval can't be negative")
+	}
+	if c.TraceAssembly.Window < 0 {
+		return fmt.Errorf("trace assembly window can't be negative")
+	}
+	if err := validateBufferConfig(c.Buffer); err != nil {
+		return err
+	}
+	for _, column := range c.Columns {
+		if err := validateColumnConfig(column); err != nil {
+			return err
+		}
+	}
+	if err := validateVersionPolicy(c.UnsupportedVersions); err != nil {
+		return err
+	}
+	if err := validateFetchQuery(c.Fetch.Query); err != nil {
+		return err
+	}
+	if c.Fetch.SelectAll && c.Fetch.Query != "" {
+		return fmt.Errorf("fetch select_all can't be used with a fetch query")
+	}
+	if c.Fetch.ChunkSize < 0 {
+		return fmt.Errorf("fetch chunk_size can't be negative")
+	}
+	if err := validateLogLevel(c.LogLevel, c.LogSampling); err != nil {
+		return err
+	}
+	if err := validateConversionWorkers(c.ConversionWorkers); err != nil {
+		return err
+	}
+	if c.Dedup.Size < 0 || c.Dedup.TTL < 0 {
+		return fmt.Errorf("dedup size and ttl can't be negative")
+	}
+	if err := validateClockConfig(c.Clock); err != nil {
+		return err
+	}
+	if err := validateSubxactMode(c.Subtransactions); err != nil {
+		return err
+	}
+	if err := validateOrphanMode(c.Orphans); err != nil {
+		return err
+	}
+	if _, err := parseSpanKinds(c.SpanKinds); err != nil {
+		return err
+	}
+	if _, err := newRelabelRules(c.Relabel); err != nil {
+		return err
+	}
+	if _, err := newOttlStatements(c.Transform.Statements); err != nil {
+		return err
+	}
+	if err := validateExporterConfig(c.Exporter); err != nil {
+		return err
+	}
+	if err := validateClickHouseConfig(c.Sinks.ClickHouse); err != nil {
+		return err
+	}
+	if c.Sinks.Parquet.MaxRows < 0 {
+		return fmt.Errorf("parquet max_rows can't be negative")
+	}
+	if _, err := newRoutes(c.Routes); err != nil {
+		return err
+	}
+	if err := validateResourceDetectors(c.Resource.Detectors); err != nil {
+		return err
+	}
+	if err := validateServiceNameTemplate(c.Resource.ServiceName); err != nil {
+		return err
+	}
+	if err := validateTargets(c); err != nil {
+		return err
+	}
+	if err := validateDiscoveryConfig(c.Discovery); err != nil {
+		return err
+	}
+	if c.Connection.StatementTimeout < 0 || c.Connection.IdleInTransactionTimeout < 0 {
+		return fmt.Errorf("connection timeouts can't be negative")
+	}
+	if err := validateCollectorConfig(c.Collector); err != nil {
+		return err
+	}
+	if err := validateProxyConfig(c.Collector); err != nil {
+		return err
+	}
+	if (c.Collector.TLS.CertFile == "") != (c.Collector.TLS.KeyFile == "") {
+		return fmt.Errorf("collector tls requires both a cert_file and a key_file")
+	}
+	if err := validateSSLConfig(c.Connection.SSL); err != nil {
+		return err
+	}
+	if err := validateAuthConfig(c.Connection.Auth); err != nil {
+		return err
+	}
+	if c.Connection.PasswordFile != "" && c.Connection.Auth.Type != "" && c.Connection.Auth.Type != authPassword {
+		return fmt.Errorf("password_file can't be combined with %s authentication", c.Connection.Auth.Type)
+	}
+	if err := validatePgTracingSettings(c.PgTracingSettings); err != nil {
+		return err
+	}
+	if err := validateHAConfig(c.HA, c.PollInterval); err != nil {
+		return err
+	}
+	if err := validateShardConfig(c); err != nil {
+		return err
+	}
+	if c.Limits.MaxSpanNameLength < 0 || c.Limits.MaxStatementLength < 0 || c.Limits.MaxAttributeLength < 0 {
+		return fmt.Errorf("length limits can't be negative")
+	}
+	return nil
+}
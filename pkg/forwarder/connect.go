@@ -0,0 +1,191 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Credential types
+const (
+	authPassword = "password"
+	authAzureAD  = "azure_ad"
+	authVault    = "vault"
+)
+
+// credentialProvider returns the credentials of a new connection, e.g. a
+// short-lived token. An empty user keeps the DSN's.
+type credentialProvider interface {
+	credentials(ctx context.Context) (user string, password string, err error)
+}
+
+// leasedCredentials are credentials renewed while connected. renew returns
+// whether they expire soon, the connection being reopened with new ones.
+type leasedCredentials interface {
+	renew(ctx context.Context) (bool, error)
+}
+
+// passwordFile reads the password from a file on each connection, picking
+// rotated secrets when reconnecting
+type passwordFile string
+
+func (f passwordFile) credentials(ctx context.Context) (string, string, error) {
+	content, err := os.ReadFile(string(f))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	return "", strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// connector opens the connections to a target, on startup and when
+// reconnecting
+type connector struct {
+	cfg ConnectionConfig
+	dsn string
+	// credentials replace the DSN's password when set
+	credentials credentialProvider
+	// cloudSQL is set for cloudsql:// DSNs
+	cloudSQL *cloudSQLDialer
+	// certs watches the DSN's certificate files, loaded on each connection
+	certs *fileWatcher
+}
+
+func validateAuthConfig(c AuthConfig) error {
+	switch c.Type {
+	case "", authPassword:
+		return nil
+	case authAzureAD:
+		return validateAzureAuthConfig(c.Azure)
+	case authVault:
+		return validateVaultAuthConfig(c.Vault)
+	}
+	return fmt.Errorf("unknown auth type %q, expected one of: %s, %s, %s", c.Type, authPassword, authAzureAD, authVault)
+}
+
+func newConnector(cfg ConnectionConfig, dsn string) (*connector, error) {
+	c := &connector{cfg: cfg, dsn: dsn}
+	if isCloudSQLDSN(dsn) {
+		var err error
+		if c.dsn, c.cloudSQL, err = parseCloudSQLDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	if c.cloudSQL == nil {
+		var err error
+		if c.dsn, err = withDSNParams(c.dsn, cfg.SSL.params()); err != nil {
+			return nil, err
+		}
+	}
+	if params, err := dsnParams(c.dsn); err == nil {
+		// libpq's environment variables are the defaults of the parameters
+		c.certs = newFileWatcher(
+			paramOrEnv(params, "sslcert", "PGSSLCERT"),
+			paramOrEnv(params, "sslkey", "PGSSLKEY"),
+			paramOrEnv(params, "sslrootcert", "PGSSLROOTCERT"))
+	}
+	switch {
+	case cfg.Auth.Type == authAzureAD:
+		c.credentials = newAzureCredentials(cfg.Auth.Azure)
+	case cfg.Auth.Type == authVault:
+		c.credentials = newVaultCredentials(cfg.Auth.Vault)
+	case cfg.PasswordFile != "":
+		c.credentials = passwordFile(cfg.PasswordFile)
+	}
+	return c, nil
+}
+
+// connect opens a connection with the configured session settings and
+// credentials
+func (c *connector) connect(ctx context.Context) (*pgx.Conn, error) {
+	connConfig, err := pgx.ParseConfig(c.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn: %w", err)
+	}
+	params := connConfig.RuntimeParams
+	if _, ok := params["application_name"]; !ok && c.cfg.ApplicationName != "" {
+		params["application_name"] = c.cfg.ApplicationName
+	}
+	if c.cfg.StatementTimeout > 0 {
+		params["statement_timeout"] = milliseconds(c.cfg.StatementTimeout)
+	}
+	if c.cfg.IdleInTransactionTimeout > 0 {
+		params["idle_in_transaction_session_timeout"] = milliseconds(c.cfg.IdleInTransactionTimeout)
+	}
+	if c.cloudSQL != nil {
+		if err := c.cloudSQL.configure(connConfig); err != nil {
+			return nil, err
+		}
+	}
+	if c.credentials != nil {
+		user, password, err := c.credentials.credentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if user != "" {
+			connConfig.User = user
+		}
+		connConfig.Password = password
+	}
+	return pgx.ConnectConfig(ctx, connConfig)
+}
+
+// renew renews leased credentials, returning whether they expire soon
+func (c *connector) renew(ctx context.Context) (bool, error) {
+	leased, ok := c.credentials.(leasedCredentials)
+	if !ok {
+		return false, nil
+	}
+	return leased.renew(ctx)
+}
+
+// certsChanged returns whether the client certificates changed since the
+// last call
+func (c *connector) certsChanged() bool {
+	return c.certs != nil && c.certs.changed()
+}
+
+// dsnParams returns the parameters of a URL or keyword/value DSN
+func dsnParams(dsn string) (map[string]string, error) {
+	params := map[string]string{}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range u.Query() {
+			params[k] = v[0]
+		}
+		return params, nil
+	}
+	for _, field := range strings.Fields(dsn) {
+		if k, v, ok := strings.Cut(field, "="); ok {
+			params[k] = strings.Trim(v, "'")
+		}
+	}
+	return params, nil
+}
+
+func paramOrEnv(params map[string]string, key, env string) string {
+	if v, ok := params[key]; ok {
+		return v
+	}
+	return os.Getenv(env)
+}
+
+// close releases the resources shared by the connections
+func (c *connector) close() {
+	if c.cloudSQL != nil {
+		c.cloudSQL.close()
+	}
+}
+
+// milliseconds formats d as a Postgres duration setting, in milliseconds
+func milliseconds(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
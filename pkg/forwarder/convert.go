@@ -0,0 +1,232 @@
+package forwarder
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Converter maps pg_tracing rows to OTLP spans, with the naming, attribute,
+// relabeling and transform settings of a configuration. It's the mapping
+// used by the forwarder, safe for concurrent use.
+type Converter struct {
+	converter *spanConverter
+}
+
+// NewConverter validates cfg and returns its converter. Without connection,
+// the database attributes are limited to db.system.
+func NewConverter(cfg Config) (*Converter, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	converter, err := newSpanConverter(&cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Converter{converter: converter}, nil
+}
+
+// Convert converts a row as a trace of its own. A parent, when set, is
+// considered an application span.
+func (c *Converter) Convert(row Row) (ptrace.Span, error) {
+	spans, err := c.ConvertTrace([]Row{row})
+	if err != nil {
+		return ptrace.Span{}, err
+	}
+	if spans.Len() == 0 {
+		return ptrace.Span{}, fmt.Errorf("span %d was dropped by a transformer", row.SpanId)
+	}
+	return spans.At(0), nil
+}
+
+// ConvertTrace converts the rows of a trace, resolving their parents within
+// rows. Spans dropped by transformers are skipped. Placeholders of missing
+// parents aren't synthesized, orphans are tagged instead.
+func (c *Converter) ConvertTrace(rows []Row) (ptrace.SpanSlice, error) {
+	spanRows := make([]*spanRow, len(rows))
+	for i, row := range rows {
+		if row.TraceId == 0 || row.SpanId == 0 {
+			return ptrace.SpanSlice{}, fmt.Errorf("row %d has no trace or span id", i)
+		}
+		spanRows[i] = row.spanRow()
+	}
+	batch := newSpanBatch(spanRows)
+	if c.converter.subxactMode == subxactEvents {
+		batch.collectSubxactEvents()
+	}
+	batch.collectWorkerLinks()
+
+	converter := c.converter
+	if converter.orphanMode == orphanSynthesize {
+		tagged := *converter
+		tagged.orphanMode = orphanTag
+		converter = &tagged
+	}
+	spans := ptrace.NewSpanSlice()
+	spans.EnsureCapacity(len(spanRows))
+	for _, r := range spanRows {
+		data := converter.convert(r, batch)
+		if data == nil {
+			continue
+		}
+		setSpan(spans.AppendEmpty(), r, data)
+		data.release()
+	}
+	return spans, nil
+}
+
+var defaultConverter = sync.OnceValues(func() (*Converter, error) {
+	return NewConverter(*DefaultConfig())
+})
+
+// Convert converts a row as a trace of its own with the default
+// configuration
+func Convert(row Row) (ptrace.Span, error) {
+	converter, err := defaultConverter()
+	if err != nil {
+		return ptrace.Span{}, err
+	}
+	return converter.Convert(row)
+}
+
+// spanRow returns the row as read from pg_tracing, zero columns being unset
+func (row Row) spanRow() *spanRow {
+	end := row.End
+	return &spanRow{
+		traceId:       row.TraceId,
+		traceIdLow:    row.TraceIdLow,
+		parentId:      row.ParentId,
+		spanId:        row.SpanId,
+		spanType:      row.SpanType,
+		spanOperation: row.SpanOperation,
+		deparseInfo:   validString(row.DeparseInfo),
+		parameters:    validString(row.Parameters),
+		spanStart:     row.Start,
+		spanEnd:       &end,
+		startup:       validInt(int64(row.Startup)),
+		pid:           row.Pid,
+		subxactCount:  row.SubxactCount,
+		sqlErrorCode:  row.SqlErrorCode,
+		rows:          validInt(row.Rows),
+		queryId:       validInt(row.QueryId),
+		dbName:        row.DatabaseName,
+		userName:      row.UserName,
+
+		planStartupCost: validFloat(row.PlanStartupCost),
+		planTotalCost:   validFloat(row.PlanTotalCost),
+		planRows:        validFloat(row.PlanRows),
+		planWidth:       validInt(row.PlanWidth),
+
+		sharedBlks:  row.SharedBlocks.blockStats(),
+		localBlks:   row.LocalBlocks.blockStats(),
+		blkTime:     row.BlockTime.blockTime(),
+		tempBlks:    row.TempBlocks.blockStats(),
+		tempBlkTime: row.TempBlockTime.blockTime(),
+
+		walRecords: validInt(row.WalRecords),
+		walFpi:     validInt(row.WalFpi),
+		walBytes:   validInt(row.WalBytes),
+
+		jitFunctions:        validInt(row.JitFunctions),
+		jitGenerationTime:   validFloat(row.JitGenerationTime),
+		jitInliningTime:     validFloat(row.JitInliningTime),
+		jitOptimizationTime: validFloat(row.JitOptimizationTime),
+		jitEmissionTime:     validFloat(row.JitEmissionTime),
+	}
+}
+
+func (b BlockCounts) blockStats() BlockStats {
+	return BlockStats{hit: validInt(b.Hit), read: validInt(b.Read), dirtied: validInt(b.Dirtied), written: validInt(b.Written)}
+}
+
+func (b BlockTimings) blockTime() BlockTime {
+	return BlockTime{readTime: validFloat(b.Read), writeTime: validFloat(b.Write)}
+}
+
+func validString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func validInt(i int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: i, Valid: i != 0}
+}
+
+func validFloat(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: f != 0}
+}
+
+// setSpan fills span from a row's converted data, as the SDK exports it
+func setSpan(span ptrace.Span, r *spanRow, data *spanData) {
+	span.SetTraceID(pcommon.TraceID(r.traceID()))
+	span.SetSpanID(pcommon.SpanID(spanIdOf(r.spanId)))
+	if r.parentId != 0 {
+		span.SetParentSpanID(pcommon.SpanID(spanIdOf(r.parentId)))
+	}
+	span.SetName(data.name)
+	// Both use the OTLP span kind values
+	span.SetKind(ptrace.SpanKind(data.kind))
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(r.startTime()))
+	span.SetEndTimestamp(pcommon.NewTimestampFromTime(r.endTime()))
+	putAttributes(span.Attributes(), data.attributes)
+	switch data.statusCode {
+	case codes.Error:
+		span.Status().SetCode(ptrace.StatusCodeError)
+		span.Status().SetMessage(data.statusMessage)
+	case codes.Ok:
+		span.Status().SetCode(ptrace.StatusCodeOk)
+	}
+	for _, e := range data.events {
+		event := span.Events().AppendEmpty()
+		event.SetName(e.name)
+		event.SetTimestamp(pcommon.NewTimestampFromTime(e.timestamp))
+		putAttributes(event.Attributes(), e.attributes)
+	}
+	for _, l := range data.links {
+		link := span.Links().AppendEmpty()
+		link.SetTraceID(pcommon.TraceID(l.SpanContext.TraceID()))
+		link.SetSpanID(pcommon.SpanID(l.SpanContext.SpanID()))
+		putAttributes(link.Attributes(), l.Attributes)
+	}
+}
+
+func putAttributes(m pcommon.Map, attributes []attribute.KeyValue) {
+	m.EnsureCapacity(len(attributes))
+	for _, kv := range attributes {
+		key := string(kv.Key)
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			m.PutBool(key, kv.Value.AsBool())
+		case attribute.INT64:
+			m.PutInt(key, kv.Value.AsInt64())
+		case attribute.FLOAT64:
+			m.PutDouble(key, kv.Value.AsFloat64())
+		case attribute.STRING:
+			m.PutStr(key, kv.Value.AsString())
+		case attribute.BOOLSLICE:
+			slice := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsBoolSlice() {
+				slice.AppendEmpty().SetBool(v)
+			}
+		case attribute.INT64SLICE:
+			slice := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsInt64Slice() {
+				slice.AppendEmpty().SetInt(v)
+			}
+		case attribute.FLOAT64SLICE:
+			slice := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsFloat64Slice() {
+				slice.AppendEmpty().SetDouble(v)
+			}
+		case attribute.STRINGSLICE:
+			slice := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsStringSlice() {
+				slice.AppendEmpty().SetStr(v)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package forwarder
+
+import (
+	"fmt"
+	"sync"
+)
+
+func validateConversionWorkers(workers int) error {
+	if workers < 0 {
+		return fmt.Errorf("conversion_workers can't be negative")
+	}
+	return nil
+}
+
+// convertJob is a span to convert, identified by its batch and position
+type convertJob struct {
+	batch int
+	row   int
+}
+
+// convertBatches converts the spans of the batches with up to c.workers
+// goroutines. The result holds the converted spans in the batches' order.
+func (c *spanConverter) convertBatches(batches []*spanBatch) [][]*spanData {
+	converted := make([][]*spanData, len(batches))
+	total := 0
+	for i, batch := range batches {
+		converted[i] = make([]*spanData, len(batch.rows))
+		total += len(batch.rows)
+	}
+	workers := min(c.workers, total)
+	if workers <= 1 {
+		for i, batch := range batches {
+			for j, r := range batch.rows {
+				converted[i][j] = c.convert(r, batch)
+			}
+		}
+		return converted
+	}
+
+	jobs := make(chan convertJob, workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				batch := batches[job.batch]
+				converted[job.batch][job.row] = c.convert(batch.rows[job.row], batch)
+			}
+		}()
+	}
+	for i, batch := range batches {
+		for j := range batch.rows {
+			jobs <- convertJob{batch: i, row: j}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return converted
+}
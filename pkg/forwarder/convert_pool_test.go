@@ -0,0 +1,41 @@
+package forwarder
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func BenchmarkConvertBatches(b *testing.B) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	batches := make([]*spanBatch, 0, benchTracesPerPoll)
+	spans := 0
+	for traceId := int64(1); traceId <= benchTracesPerPoll; traceId++ {
+		rows := benchTrace(traceId, start)
+		batches = append(batches, newSpanBatch(rows))
+		spans += len(rows)
+	}
+	for _, workers := range []int{1, max(2, runtime.GOMAXPROCS(0))} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := DefaultConfig()
+			cfg.ConversionWorkers = workers
+			converter, err := newSpanConverter(cfg, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, converted := range converter.convertBatches(batches) {
+					for _, data := range converted {
+						if data != nil {
+							data.release()
+						}
+					}
+				}
+			}
+			b.ReportMetric(float64(b.N*spans)/b.Elapsed().Seconds(), "spans/s")
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package forwarder
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// checkGolden compares got with the golden file at path, rewriting it with
+// -update
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, run with -update to accept it:\n%s", path, got)
+	}
+}
+
+// marshalSpans encodes spans as indented OTLP JSON
+func marshalSpans(t *testing.T, spans ptrace.SpanSlice) []byte {
+	t.Helper()
+	traces := ptrace.NewTraces()
+	spans.CopyTo(traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans())
+	encoded, err := (&ptrace.JSONMarshaler{}).MarshalTraces(traces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, encoded, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	return append(indented.Bytes(), '\n')
+}
+
+var testStart = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testRow returns a row of trace 1 starting offset after testStart
+func testRow(spanId, parentId int64, spanType, operation string, offset, duration time.Duration) Row {
+	return Row{
+		TraceId:       1,
+		SpanId:        spanId,
+		ParentId:      parentId,
+		SpanType:      spanType,
+		SpanOperation: operation,
+		Start:         testStart.Add(offset),
+		End:           testStart.Add(offset + duration),
+		Pid:           4242,
+		DatabaseName:  "app",
+		UserName:      "alice",
+	}
+}
+
+func TestConvertGolden(t *testing.T) {
+	query := testRow(10, 0, "Select query", "select * from users where id = $1;", 0, 3*time.Millisecond)
+	query.Parameters = "$1 = '42'"
+	query.QueryId = 1234
+	query.Rows = 1
+
+	planner := testRow(11, 10, "Planner", "Planner", 100*time.Microsecond, 500*time.Microsecond)
+
+	executor := testRow(12, 10, "ExecutorRun", "ExecutorRun", time.Millisecond, 1500*time.Microsecond)
+
+	scan := testRow(13, 12, "IndexScan", "IndexScan using users_pkey on users", 1100*time.Microsecond, time.Millisecond)
+	scan.DeparseInfo = "Index Cond: (id = 42)"
+	scan.Rows = 1
+	scan.PlanStartupCost = 0.29
+	scan.PlanTotalCost = 8.3
+	scan.PlanRows = 1
+	scan.PlanWidth = 72
+	scan.SharedBlocks = BlockCounts{Hit: 3, Read: 1}
+
+	failed := testRow(20, 0, "Select query", "select 1/0;", 0, time.Millisecond)
+	failed.SqlErrorCode = "22012"
+
+	block := testRow(30, 0, "TransactionBlock", "TransactionBlock", 0, 5*time.Millisecond)
+	savepoint := testRow(31, 30, "Utility query", "SAVEPOINT sp1;", time.Millisecond, 100*time.Microsecond)
+	insert := testRow(32, 30, "Insert query", "insert into users values ($1);", 2*time.Millisecond, time.Millisecond)
+	release := testRow(33, 30, "Utility query", "RELEASE SAVEPOINT sp1;", 4*time.Millisecond, 100*time.Microsecond)
+	subxact := []Row{block, savepoint, insert, release}
+
+	for _, tc := range []struct {
+		name            string
+		subtransactions string
+		rows            []Row
+	}{
+		{name: "top_level", rows: []Row{query}},
+		{name: "planner", rows: []Row{query, planner}},
+		{name: "executor", rows: []Row{query, executor}},
+		{name: "plan_node", rows: []Row{query, executor, scan}},
+		{name: "error", rows: []Row{failed}},
+		{name: "subxact_events", subtransactions: subxactEvents, rows: subxact},
+		{name: "subxact_attributes", subtransactions: subxactAttributes, rows: subxact},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := *DefaultConfig()
+			cfg.Subtransactions = tc.subtransactions
+			converter, err := NewConverter(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spans, err := converter.ConvertTrace(tc.rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join("testdata", "convert", tc.name+".json"), marshalSpans(t, spans))
+		})
+	}
+}
+
+func TestConvertDatabaseAttributes(t *testing.T) {
+	resolved := testRow(10, 0, "Select query", "select 1;", 0, time.Millisecond)
+	unresolved := resolved
+	unresolved.DatabaseName, unresolved.UserName = "", ""
+	for _, tc := range []struct {
+		row            Row
+		dbName, dbUser string
+	}{
+		{row: resolved, dbName: "app", dbUser: "alice"},
+		{row: unresolved},
+	} {
+		span, err := Convert(tc.row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range map[string]string{"db.name": tc.dbName, "db.user": tc.dbUser} {
+			value, ok := span.Attributes().Get(key)
+			if want == "" && ok {
+				t.Errorf("%s set to %q without a resolved oid", key, value.Str())
+			} else if want != "" && value.Str() != want {
+				t.Errorf("%s is %q, expected %q", key, value.Str(), want)
+			}
+		}
+	}
+}
+
+func TestConvertDefault(t *testing.T) {
+	span, err := Convert(testRow(10, 0, "Select query", "select 1;", 0, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if span.Name() != "select 1;" {
+		t.Fatalf("unexpected name %q", span.Name())
+	}
+	if got := span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime()); got != time.Millisecond {
+		t.Fatalf("unexpected duration %s", got)
+	}
+}
@@ -0,0 +1,222 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	defaultDatadogAgent = "http://localhost:8126"
+	defaultDatadogSite  = "datadoghq.com"
+)
+
+func validateDatadogConfig(cfg DatadogExporterConfig) error {
+	if cfg.APIKey != "" && cfg.Agent != "" {
+		return fmt.Errorf("datadog agent and api_key are exclusive, spans are sent to the intake with an api_key")
+	}
+	if cfg.Site != "" && cfg.APIKey == "" {
+		return fmt.Errorf("datadog site requires an api_key")
+	}
+	return nil
+}
+
+// datadogSpan is a span of the agent's v0.4 traces API
+type datadogSpan struct {
+	TraceId  uint64             `json:"trace_id"`
+	SpanId   uint64             `json:"span_id"`
+	ParentId uint64             `json:"parent_id"`
+	Name     string             `json:"name"`
+	Resource string             `json:"resource"`
+	Service  string             `json:"service"`
+	Type     string             `json:"type"`
+	Start    int64              `json:"start"`
+	Duration int64              `json:"duration"`
+	Error    int32              `json:"error"`
+	Meta     map[string]string  `json:"meta"`
+	Metrics  map[string]float64 `json:"metrics"`
+}
+
+// datadogExporter sends spans to the traces API of the Datadog agent, or of
+// the site's intake with an API key, mapping service, env and version from
+// the resource attributes
+type datadogExporter struct {
+	cfg    DatadogExporterConfig
+	url    string
+	apiKey string
+	client *http.Client
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newDatadogExporter(cfg DatadogExporterConfig) *datadogExporter {
+	base := cfg.Agent
+	switch {
+	case cfg.APIKey != "":
+		site := cfg.Site
+		if site == "" {
+			site = defaultDatadogSite
+		}
+		base = "https://trace.agent." + site
+	case base == "":
+		base = defaultDatadogAgent
+	}
+	return &datadogExporter{
+		cfg:    cfg,
+		url:    strings.TrimSuffix(base, "/") + "/v0.4/traces",
+		apiKey: cfg.APIKey,
+		client: &http.Client{},
+	}
+}
+
+func resourceValue(res *sdkresource.Resource, key attribute.Key) string {
+	if res == nil {
+		return ""
+	}
+	value, ok := res.Set().Value(key)
+	if !ok {
+		return ""
+	}
+	return value.Emit()
+}
+
+// datadogTraceId keeps the lower 64 bits as the Datadog trace id, the higher
+// ones are carried by the _dd.p.tid tag. pg_tracing's 64 bits trace ids are
+// stored in the higher bits, with the lower ones unset.
+func datadogTraceId(traceId [16]byte) (uint64, string) {
+	high, low := binary.BigEndian.Uint64(traceId[:8]), binary.BigEndian.Uint64(traceId[8:])
+	if low == 0 {
+		return high, ""
+	}
+	return low, hex.EncodeToString(traceId[:8])
+}
+
+func (e *datadogExporter) convert(span sdktrace.ReadOnlySpan) *datadogSpan {
+	res := span.Resource()
+	service := e.cfg.Service
+	if service == "" {
+		service = resourceValue(res, semconv.ServiceNameKey)
+	}
+	traceId, highTraceId := datadogTraceId(span.SpanContext().TraceID())
+	spanId := span.SpanContext().SpanID()
+	parentId := span.Parent().SpanID()
+	dd := &datadogSpan{
+		TraceId:  traceId,
+		SpanId:   binary.BigEndian.Uint64(spanId[:]),
+		ParentId: binary.BigEndian.Uint64(parentId[:]),
+		Name:     "postgresql.query",
+		Resource: span.Name(),
+		Service:  service,
+		Type:     "sql",
+		Start:    span.StartTime().UnixNano(),
+		Duration: span.EndTime().Sub(span.StartTime()).Nanoseconds(),
+		Meta:     map[string]string{"span.kind": span.SpanKind().String()},
+		Metrics:  map[string]float64{},
+	}
+	if highTraceId != "" {
+		dd.Meta["_dd.p.tid"] = highTraceId
+	}
+	env := e.cfg.Env
+	if env == "" {
+		env = resourceValue(res, semconv.DeploymentEnvironmentKey)
+	}
+	version := e.cfg.Version
+	if version == "" {
+		version = resourceValue(res, semconv.ServiceVersionKey)
+	}
+	if env != "" {
+		dd.Meta["env"] = env
+	}
+	if version != "" {
+		dd.Meta["version"] = version
+	}
+	for _, attr := range span.Attributes() {
+		switch attr.Value.Type() {
+		case attribute.INT64:
+			dd.Metrics[string(attr.Key)] = float64(attr.Value.AsInt64())
+		case attribute.FLOAT64:
+			dd.Metrics[string(attr.Key)] = attr.Value.AsFloat64()
+		default:
+			dd.Meta[string(attr.Key)] = attr.Value.Emit()
+		}
+	}
+	if span.Status().Code == codes.Error {
+		dd.Error = 1
+		dd.Meta["error.message"] = span.Status().Description
+	}
+	// Let the agent keep all spans, they were already sampled by pg_tracing
+	dd.Metrics["_sampling_priority_v1"] = 1
+	return dd
+}
+
+func (e *datadogExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	stopped := e.stopped
+	e.mu.Unlock()
+	if stopped {
+		return fmt.Errorf("datadog exporter is stopped")
+	}
+
+	var traceIds []uint64
+	byTrace := map[uint64][]*datadogSpan{}
+	for _, span := range spans {
+		dd := e.convert(span)
+		if _, ok := byTrace[dd.TraceId]; !ok {
+			traceIds = append(traceIds, dd.TraceId)
+		}
+		byTrace[dd.TraceId] = append(byTrace[dd.TraceId], dd)
+	}
+	traces := make([][]*datadogSpan, 0, len(traceIds))
+	for _, traceId := range traceIds {
+		traces = append(traces, byTrace[traceId])
+	}
+	body, err := json.Marshal(traces)
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create datadog request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Datadog-Trace-Count", strconv.Itoa(len(traces)))
+	req.Header.Set("Datadog-Meta-Lang", "go")
+	destination := "datadog agent"
+	if e.apiKey != "" {
+		req.Header.Set("DD-API-KEY", e.apiKey)
+		destination = "datadog intake"
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans to %s: %w", destination, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", destination, resp.Status, msg)
+	}
+	return nil
+}
+
+func (e *datadogExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.stopped = true
+	return nil
+}
@@ -0,0 +1,117 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// datadogRequest is a request received by a fake agent or intake
+type datadogRequest struct {
+	path   string
+	apiKey string
+	traces [][]datadogSpan
+}
+
+func newDatadogServer(t *testing.T, tls bool) (*httptest.Server, <-chan datadogRequest) {
+	t.Helper()
+	requests := make(chan datadogRequest, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := datadogRequest{path: r.URL.Path, apiKey: r.Header.Get("DD-API-KEY")}
+		if err := json.NewDecoder(r.Body).Decode(&req.traces); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- req
+	})
+	var server *httptest.Server
+	if tls {
+		server = httptest.NewTLSServer(handler)
+	} else {
+		server = httptest.NewServer(handler)
+	}
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func datadogTestSpans() []sdktrace.ReadOnlySpan {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return tracetest.SpanStubs{{
+		Name: "select 1;",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceIdOf(1, 0),
+			SpanID:  spanIdOf(2),
+		}),
+		StartTime: start,
+		EndTime:   start.Add(time.Millisecond),
+	}}.Snapshots()
+}
+
+func TestDatadogExporterAgent(t *testing.T) {
+	server, requests := newDatadogServer(t, false)
+	exporter := newDatadogExporter(DatadogExporterConfig{Agent: server.URL, Service: "postgres"})
+	if err := exporter.ExportSpans(context.Background(), datadogTestSpans()); err != nil {
+		t.Fatal(err)
+	}
+	req := <-requests
+	if req.path != "/v0.4/traces" || req.apiKey != "" {
+		t.Fatalf("unexpected request to %s with api key %q", req.path, req.apiKey)
+	}
+	if len(req.traces) != 1 || len(req.traces[0]) != 1 {
+		t.Fatalf("unexpected traces %+v", req.traces)
+	}
+	span := req.traces[0][0]
+	if span.TraceId != 1 || span.SpanId != 2 || span.Service != "postgres" || span.Duration != int64(time.Millisecond) {
+		t.Fatalf("unexpected span %+v", span)
+	}
+}
+
+func TestDatadogExporterIntake(t *testing.T) {
+	for _, tc := range []struct {
+		site string
+		url  string
+	}{
+		{url: "https://trace.agent.datadoghq.com/v0.4/traces"},
+		{site: "datadoghq.eu", url: "https://trace.agent.datadoghq.eu/v0.4/traces"},
+	} {
+		exporter := newDatadogExporter(DatadogExporterConfig{APIKey: "secret", Site: tc.site})
+		if exporter.url != tc.url {
+			t.Errorf("site %q: spans sent to %s, expected %s", tc.site, exporter.url, tc.url)
+		}
+	}
+
+	server, requests := newDatadogServer(t, true)
+	exporter := newDatadogExporter(DatadogExporterConfig{APIKey: "secret"})
+	exporter.url = server.URL + "/v0.4/traces"
+	exporter.client = server.Client()
+	if err := exporter.ExportSpans(context.Background(), datadogTestSpans()); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-requests; req.apiKey != "secret" || len(req.traces) != 1 {
+		t.Fatalf("unexpected request with api key %q and traces %+v", req.apiKey, req.traces)
+	}
+}
+
+func TestValidateDatadogConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg   DatadogExporterConfig
+		valid bool
+	}{
+		{cfg: DatadogExporterConfig{}, valid: true},
+		{cfg: DatadogExporterConfig{Agent: "http://agent:8126"}, valid: true},
+		{cfg: DatadogExporterConfig{APIKey: "secret", Site: "us5.datadoghq.com"}, valid: true},
+		{cfg: DatadogExporterConfig{APIKey: "secret", Agent: "http://agent:8126"}},
+		{cfg: DatadogExporterConfig{Site: "datadoghq.eu"}},
+	} {
+		if err := validateDatadogConfig(tc.cfg); (err == nil) != tc.valid {
+			t.Errorf("%+v: unexpected validation error %v", tc.cfg, err)
+		}
+	}
+}
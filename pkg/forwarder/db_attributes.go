@@ -0,0 +1,67 @@
+package forwarder
+
+import (
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// isTopSpan returns true for the spans representing a whole statement, whose
+// operation is the query text
+func isTopSpan(spanType string) bool {
+	return strings.HasSuffix(spanType, " query")
+}
+
+// activeHost returns the host and port the connection is established to. When
+// multiple hosts are listed in the DSN, the remote address is matched against
+// each of them to find the one in use.
+func activeHost(conn *pgx.Conn) (string, int, bool) {
+	remote, ok := conn.PgConn().Conn().RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		// Connected through a unix socket
+		return "", 0, false
+	}
+	connConfig := conn.Config()
+	candidates := []*pgconn.FallbackConfig{{Host: connConfig.Host, Port: connConfig.Port}}
+	candidates = append(candidates, connConfig.Fallbacks...)
+	for _, candidate := range candidates {
+		if int(candidate.Port) != remote.Port {
+			continue
+		}
+		if ip := net.ParseIP(candidate.Host); ip != nil {
+			if ip.Equal(remote.IP) {
+				return candidate.Host, remote.Port, true
+			}
+			continue
+		}
+		addrs, err := net.LookupHost(candidate.Host)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if net.ParseIP(addr).Equal(remote.IP) {
+				return candidate.Host, remote.Port, true
+			}
+		}
+	}
+	return remote.IP.String(), remote.Port, true
+}
+
+// connectionAttributes returns the database semantic convention attributes
+// derivable from the forwarder's connection. The database and user of the
+// connection aren't the traced sessions' ones, db.name and db.user are only
+// set from the spans' resolved dbid and userid.
+func connectionAttributes(conn *pgx.Conn) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if host, port, ok := activeHost(conn); ok {
+		attributes = append(attributes, semconv.ServerAddress(host))
+		attributes = append(attributes, semconv.ServerPort(port))
+		attributes = append(attributes, semconv.NetPeerName(host))
+		attributes = append(attributes, semconv.NetPeerPort(port))
+	}
+	return attributes
+}
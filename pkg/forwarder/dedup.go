@@ -0,0 +1,91 @@
+package forwarder
+
+import (
+	"container/list"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanKey struct {
+	traceId trace.TraceID
+	spanId  int64
+}
+
+type dedupEntry struct {
+	key  spanKey
+	seen time.Time
+}
+
+// dedupCache remembers recently exported spans so spans read again, like a
+// batch reprocessed after a crash, aren't exported twice. It holds at most
+// size entries, each expiring after ttl.
+type dedupCache struct {
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[spanKey]*list.Element
+}
+
+func newDedupCache(size int, ttl time.Duration) *dedupCache {
+	return &dedupCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[spanKey]*list.Element),
+	}
+}
+
+func (c *dedupCache) expire(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		entry := e.Value.(*dedupEntry)
+		expired := c.ttl > 0 && now.Sub(entry.seen) >= c.ttl
+		if !expired && c.order.Len() <= c.size {
+			return
+		}
+		c.order.Remove(e)
+		delete(c.entries, entry.key)
+	}
+}
+
+// isDuplicate records the span and returns true if it was already seen
+func (c *dedupCache) isDuplicate(r *spanRow, now time.Time) bool {
+	key := spanKey{r.traceID(), r.spanId}
+	if _, ok := c.entries[key]; ok {
+		return true
+	}
+	c.entries[key] = c.order.PushBack(&dedupEntry{key: key, seen: now})
+	c.expire(now)
+	return false
+}
+
+// Len returns the number of remembered spans
+func (c *dedupCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	return c.order.Len()
+}
+
+// Filter returns the rows that weren't seen before
+func (c *dedupCache) Filter(rows []*spanRow, now time.Time, stats *forwarderStats) []*spanRow {
+	if c == nil {
+		return rows
+	}
+	c.expire(now)
+	res := rows[:0]
+	duplicates := 0
+	for _, r := range rows {
+		if c.isDuplicate(r, now) {
+			duplicates++
+			continue
+		}
+		res = append(res, r)
+	}
+	stats.spansDuplicated.Add(int64(duplicates))
+	if duplicates > 0 {
+		log.Printf("Skipped %d duplicated spans", duplicates)
+	}
+	return res
+}
@@ -0,0 +1,21 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupTraceIds(t *testing.T) {
+	c := newDedupCache(10, time.Minute)
+	now := testStart
+	if c.isDuplicate(idRow(0, 1, 10, 0), now) {
+		t.Fatal("first span flagged as duplicate")
+	}
+	// Same span id in another trace with zero high bits
+	if c.isDuplicate(idRow(0, 2, 10, 0), now) {
+		t.Fatal("span of another trace flagged as duplicate")
+	}
+	if !c.isDuplicate(idRow(0, 1, 10, 0), now) {
+		t.Fatal("span read again isn't flagged as duplicate")
+	}
+}
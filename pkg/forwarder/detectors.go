@@ -0,0 +1,109 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/detectors/aws/ec2"
+	"go.opentelemetry.io/contrib/detectors/aws/ecs"
+	"go.opentelemetry.io/contrib/detectors/gcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+var resourceDetectors = map[string]func() resource.Option{
+	"host":      resource.WithHost,
+	"os":        resource.WithOS,
+	"process":   resource.WithProcess,
+	"container": resource.WithContainer,
+	"ec2":       func() resource.Option { return resource.WithDetectors(ec2.NewResourceDetector()) },
+	"ecs":       func() resource.Option { return resource.WithDetectors(ecs.NewResourceDetector()) },
+	"gcp":       func() resource.Option { return resource.WithDetectors(gcp.NewDetector()) },
+	"azure":     func() resource.Option { return resource.WithDetectors(&azureVMDetector{}) },
+}
+
+func resourceDetectorNames() string {
+	names := make([]string, 0, len(resourceDetectors))
+	for name := range resourceDetectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func validateResourceDetectors(names []string) error {
+	for _, name := range names {
+		if _, ok := resourceDetectors[name]; !ok {
+			return fmt.Errorf("unknown resource detector %q, expected one of: %s", name, resourceDetectorNames())
+		}
+	}
+	return nil
+}
+
+func resourceDetectorOptions(names []string) []resource.Option {
+	opts := make([]resource.Option, 0, len(names))
+	for _, name := range names {
+		opts = append(opts, resourceDetectors[name]())
+	}
+	return opts
+}
+
+const azureIMDSEndpoint = "http://169.254.169.254/metadata/instance/compute?api-version=2021-12-13&format=json"
+
+// azureVMDetector reads the Azure Instance Metadata Service. Nothing is
+// detected when the endpoint isn't reachable.
+type azureVMDetector struct{}
+
+type azureComputeMetadata struct {
+	Location          string `json:"location"`
+	Name              string `json:"name"`
+	VMID              string `json:"vmId"`
+	VMSize            string `json:"vmSize"`
+	SubscriptionID    string `json:"subscriptionId"`
+	ResourceGroupName string `json:"resourceGroupName"`
+	VMScaleSetName    string `json:"vmScaleSetName"`
+}
+
+func (d *azureVMDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Not running on Azure
+		return resource.Empty(), nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resource.Empty(), nil
+	}
+
+	var metadata azureComputeMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode Azure instance metadata: %w", err)
+	}
+	attributes := []attribute.KeyValue{
+		semconv.CloudProviderAzure,
+		semconv.CloudPlatformAzureVM,
+		semconv.CloudRegion(metadata.Location),
+		semconv.CloudAccountID(metadata.SubscriptionID),
+		semconv.HostName(metadata.Name),
+		semconv.HostID(metadata.VMID),
+		semconv.HostType(metadata.VMSize),
+		attribute.String("azure.resourcegroup.name", metadata.ResourceGroupName),
+	}
+	if metadata.VMScaleSetName != "" {
+		attributes = append(attributes, attribute.String("azure.vm.scaleset.name", metadata.VMScaleSetName))
+	}
+	return resource.NewWithAttributes(semconv.SchemaURL, attributes...), nil
+}
@@ -0,0 +1,138 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// discoveryTimeout bounds a discovery query
+const discoveryTimeout = 10 * time.Second
+
+func (c DiscoveryConfig) enabled() bool {
+	return c.SQL.DSN != "" || c.Kubernetes.LabelSelector != "" || c.File != ""
+}
+
+func validateDiscoveryConfig(c DiscoveryConfig) error {
+	if (c.SQL.DSN == "") != (c.SQL.Query == "") {
+		return fmt.Errorf("sql discovery requires both a dsn and a query")
+	}
+	if err := validateKubernetesDiscoveryConfig(c.Kubernetes); err != nil {
+		return err
+	}
+	if c.enabled() && c.Interval <= 0 {
+		return fmt.Errorf("discovery interval must be positive")
+	}
+	return nil
+}
+
+// discoverSQLTargets lists the targets returned by the discovery query.
+// Columns besides name and dsn are added as resource attributes.
+func discoverSQLTargets(ctx context.Context, cfg SQLDiscoveryConfig) ([]TargetConfig, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the inventory database: %w", err)
+	}
+	defer conn.Close(ctx)
+	rows, err := conn.Query(ctx, cfg.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run the discovery query: %w", err)
+	}
+	defer rows.Close()
+
+	var targets []TargetConfig
+	fields := rows.FieldDescriptions()
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read discovered target: %w", err)
+		}
+		t := TargetConfig{Resource: TargetResourceConfig{Attributes: map[string]string{}}}
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			switch fields[i].Name {
+			case "name":
+				t.Name = fmt.Sprint(value)
+			case "dsn":
+				t.DSN = fmt.Sprint(value)
+			default:
+				t.Resource.Attributes[fields[i].Name] = fmt.Sprint(value)
+			}
+		}
+		targets = append(targets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read discovered targets: %w", err)
+	}
+	return targets, nil
+}
+
+// discoverFileTargets lists the targets of a YAML or JSON file
+func discoverFileTargets(path string) ([]TargetConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %w", err)
+	}
+	var targets []TargetConfig
+	if err := yaml.Unmarshal(content, &targets); err != nil {
+		return nil, fmt.Errorf("failed to parse targets file %s: %w", path, err)
+	}
+	return targets, nil
+}
+
+// discoverTargets returns the static targets followed by the discovered
+// ones. Invalid discovered targets and the ones reusing a name are skipped.
+func discoverTargets(ctx context.Context, cfg *Config) ([]TargetConfig, error) {
+	if !cfg.Discovery.enabled() {
+		return cfg.targets(), nil
+	}
+	var discovered []TargetConfig
+	if cfg.Discovery.SQL.DSN != "" {
+		targets, err := discoverSQLTargets(ctx, cfg.Discovery.SQL)
+		if err != nil {
+			return nil, err
+		}
+		discovered = append(discovered, targets...)
+	}
+	if cfg.Discovery.Kubernetes.LabelSelector != "" {
+		targets, err := discoverKubernetesTargets(ctx, cfg.Discovery.Kubernetes)
+		if err != nil {
+			return nil, err
+		}
+		discovered = append(discovered, targets...)
+	}
+	if cfg.Discovery.File != "" {
+		targets, err := discoverFileTargets(cfg.Discovery.File)
+		if err != nil {
+			return nil, err
+		}
+		discovered = append(discovered, targets...)
+	}
+
+	targets := append([]TargetConfig{}, cfg.Targets...)
+	names := map[string]bool{}
+	for _, t := range targets {
+		names[t.Name] = true
+	}
+	for _, t := range discovered {
+		switch {
+		case t.Name == "" || t.DSN == "":
+			log.Printf("Skipping discovered target %q without name or dsn", t.Name)
+		case names[t.Name]:
+			log.Printf("Skipping discovered target %q, the name is already used", t.Name)
+		default:
+			names[t.Name] = true
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
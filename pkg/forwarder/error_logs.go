@@ -0,0 +1,93 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorLogKeys are the span attributes copied to the log records of error
+// spans, with the attributes prefixed by parameterKeyPrefix
+var errorLogKeys = map[attribute.Key]bool{
+	semconv.DBStatementKey:    true,
+	semconv.DBNameKey:         true,
+	semconv.DBUserKey:         true,
+	"db.response.status_code": true,
+}
+
+// initLoggerProvider creates a LoggerProvider exporting log records to an
+// OTLP endpoint
+func initLoggerProvider(ctx context.Context, cfg LogsConfig, collector CollectorConfig, res *resource.Resource) (*sdklog.LoggerProvider, error) {
+	conn, err := dialCollector(ctx, collector, cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlploggrpc.New(ctx, otlploggrpc.WithGRPCConn(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log exporter: %w", err)
+	}
+	return sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+	), nil
+}
+
+func logValue(v attribute.Value) log.Value {
+	switch v.Type() {
+	case attribute.BOOL:
+		return log.BoolValue(v.AsBool())
+	case attribute.INT64:
+		return log.Int64Value(v.AsInt64())
+	case attribute.FLOAT64:
+		return log.Float64Value(v.AsFloat64())
+	case attribute.STRING:
+		return log.StringValue(v.AsString())
+	}
+	return log.StringValue(v.Emit())
+}
+
+// errorLogProcessor emits a log record for each span ending with an error.
+// Records are built from the exported span, after the relabeling and
+// transform stages, and are correlated to the span.
+type errorLogProcessor struct {
+	logger log.Logger
+}
+
+func newErrorLogProcessor(provider *sdklog.LoggerProvider) *errorLogProcessor {
+	return &errorLogProcessor{logger: provider.Logger("pgtracing-forwarder")}
+}
+
+func (p *errorLogProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {}
+
+func (p *errorLogProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.Status().Code != codes.Error {
+		return
+	}
+	var record log.Record
+	record.SetTimestamp(s.EndTime())
+	record.SetObservedTimestamp(time.Now())
+	record.SetSeverity(log.SeverityError)
+	record.SetSeverityText("ERROR")
+	record.SetBody(log.StringValue(s.Name() + ": " + s.Status().Description))
+	for _, kv := range s.Attributes() {
+		if errorLogKeys[kv.Key] || strings.HasPrefix(string(kv.Key), parameterKeyPrefix) {
+			record.AddAttributes(log.KeyValue{Key: string(kv.Key), Value: logValue(kv.Value)})
+		}
+	}
+	p.logger.Emit(trace.ContextWithSpanContext(context.Background(), s.SpanContext()), record)
+}
+
+func (p *errorLogProcessor) Shutdown(ctx context.Context) error { return nil }
+
+func (p *errorLogProcessor) ForceFlush(ctx context.Context) error { return nil }
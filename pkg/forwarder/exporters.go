@@ -0,0 +1,275 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const defaultOtlpEndpoint = "localhost:4317"
+
+// Exporter types
+const (
+	exporterOtlp    = "otlp"
+	exporterConsole = "console"
+	exporterFile    = "file"
+	exporterKafka   = "kafka"
+	exporterJaeger  = "jaeger"
+	exporterDatadog = "datadog"
+	exporterXRay    = "xray"
+)
+
+var exporterTypes = []string{exporterOtlp, exporterConsole, exporterFile, exporterKafka, exporterJaeger, exporterDatadog, exporterXRay}
+
+// deprecatedExporters are the exporter types whose OpenTelemetry exporter is
+// deprecated, kept for the deployments without OTLP ingest
+var deprecatedExporters = map[string]string{
+	exporterJaeger: "Jaeger ingests OTLP since v1.35, use the otlp exporter",
+}
+
+// exporterTypesUsage lists the exporter types for the flags' help
+func exporterTypesUsage() string {
+	types := make([]string, 0, len(exporterTypes))
+	for _, t := range exporterTypes {
+		if _, ok := deprecatedExporters[t]; ok {
+			t += " (deprecated)"
+		}
+		types = append(types, t)
+	}
+	return strings.Join(types, ", ")
+}
+
+func validateBatchConfig(cfg BatchConfig) error {
+	if cfg.MaxQueueSize < 0 || cfg.MaxExportBatchSize < 0 || cfg.BatchTimeout < 0 || cfg.ExportTimeout < 0 {
+		return fmt.Errorf("exporter batch settings can't be negative")
+	}
+	queueSize := cfg.MaxQueueSize
+	if queueSize == 0 {
+		queueSize = sdktrace.DefaultMaxQueueSize
+	}
+	if cfg.MaxExportBatchSize > queueSize {
+		return fmt.Errorf("exporter max_export_batch_size can't exceed max_queue_size (%d)", queueSize)
+	}
+	return nil
+}
+
+// batchOptions returns the batch span processor options of cfg
+func batchOptions(cfg BatchConfig) []sdktrace.BatchSpanProcessorOption {
+	var opts []sdktrace.BatchSpanProcessorOption
+	if cfg.MaxQueueSize > 0 {
+		opts = append(opts, sdktrace.WithMaxQueueSize(cfg.MaxQueueSize))
+	}
+	if cfg.MaxExportBatchSize > 0 {
+		opts = append(opts, sdktrace.WithMaxExportBatchSize(cfg.MaxExportBatchSize))
+	}
+	if cfg.BatchTimeout > 0 {
+		opts = append(opts, sdktrace.WithBatchTimeout(cfg.BatchTimeout))
+	}
+	if cfg.ExportTimeout > 0 {
+		opts = append(opts, sdktrace.WithExportTimeout(cfg.ExportTimeout))
+	}
+	return opts
+}
+
+func validateExporterConfig(cfg ExporterConfig) error {
+	if err := validateBatchConfig(cfg.Batch); err != nil {
+		return err
+	}
+	if err := validateBackpressureConfig(cfg.Backpressure); err != nil {
+		return err
+	}
+	switch cfg.Type {
+	case exporterOtlp:
+		if cfg.Endpoint == "" {
+			return fmt.Errorf("exporter endpoint is required")
+		}
+	case exporterConsole:
+	case exporterFile:
+		if cfg.File.Path == "" {
+			return fmt.Errorf("file exporter path is required")
+		}
+		if cfg.File.MaxSize < 0 || cfg.File.MaxAge < 0 {
+			return fmt.Errorf("file exporter max_size and max_age can't be negative")
+		}
+	case exporterKafka:
+		return validateKafkaConfig(cfg.Kafka)
+	case exporterJaeger:
+		return validateJaegerConfig(cfg.Jaeger)
+	case exporterDatadog:
+		return validateDatadogConfig(cfg.Datadog)
+	case exporterXRay:
+	default:
+		return fmt.Errorf("unknown exporter %q, expected one of: %s",
+			cfg.Type, strings.Join(exporterTypes, ", "))
+	}
+	return nil
+}
+
+// collectorCredentials returns the transport credentials of the
+// collectors, reloading the certificates when rotated
+func collectorCredentials(cfg TLSConfig) (credentials.TransportCredentials, error) {
+	if !cfg.enabled() {
+		return insecure.NewCredentials(), nil
+	}
+	reloader, err := newCertReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(reloader.tlsConfig()), nil
+}
+
+func validateCollectorConfig(c CollectorConfig) error {
+	if c.Keepalive.Time < 0 || c.Keepalive.Timeout < 0 {
+		return fmt.Errorf("collector keepalive time and timeout can't be negative")
+	}
+	if c.Backoff.BaseDelay <= 0 || c.Backoff.MaxDelay < c.Backoff.BaseDelay {
+		return fmt.Errorf("collector backoff base_delay must be positive and at most max_delay")
+	}
+	if c.MaxSendMessageSize < 0 || c.MaxRecvMessageSize < 0 {
+		return fmt.Errorf("collector message sizes can't be negative")
+	}
+	return nil
+}
+
+// dialCollector creates a connection to an OTLP gRPC endpoint. It's
+// established in the background, retried with the configured backoff
+// while the collector is unavailable.
+func dialCollector(ctx context.Context, cfg CollectorConfig, endpoint string) (*grpc.ClientConn, error) {
+	creds, err := collectorCredentials(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	backoffConfig := backoff.DefaultConfig
+	backoffConfig.BaseDelay = cfg.Backoff.BaseDelay
+	backoffConfig.MaxDelay = cfg.Backoff.MaxDelay
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoffConfig, MinConnectTimeout: 20 * time.Second}),
+	}
+	if cfg.Keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.Keepalive.Time,
+			Timeout:             cfg.Keepalive.Timeout,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}))
+	}
+	var callOpts []grpc.CallOption
+	if cfg.MaxSendMessageSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(cfg.MaxSendMessageSize))
+	}
+	if cfg.MaxRecvMessageSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(cfg.MaxRecvMessageSize))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if cfg.Proxy != "" {
+		opts = append(opts, grpc.WithContextDialer(proxyDialer(cfg)))
+	}
+	conn, err := grpc.DialContext(ctx, endpoint, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection to collector %s: %w", endpoint, err)
+	}
+	return conn, nil
+}
+
+func newOtlpExporter(ctx context.Context, collector CollectorConfig, endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	conn, err := dialCollector(ctx, collector, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn), otlptracegrpc.WithHeaders(headers))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	return traceExporter, nil
+}
+
+// sharedExporter is an exporter shared by the targets, which isn't shut
+// down with each of them
+type sharedExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e sharedExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// newTraceExporter creates the configured exporter. OTLP exporters are
+// wrapped in a routing exporter when routes are configured.
+func newTraceExporter(ctx context.Context, cfg *Config) (sdktrace.SpanExporter, error) {
+	if cfg.SpanExporter != nil {
+		return sharedExporter{cfg.SpanExporter}, nil
+	}
+	routes, err := newRoutes(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Exporter.Type == exporterOtlp {
+		return newOtlpRoutingExporter(ctx, cfg.Collector, cfg.Exporter.Endpoint, cfg.Exporter.Headers, routes)
+	}
+	if len(routes) > 0 {
+		log.Printf("Routes are ignored by the %s exporter", cfg.Exporter.Type)
+	}
+	switch cfg.Exporter.Type {
+	case exporterConsole:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create console exporter: %w", err)
+		}
+		return exporter, nil
+	case exporterFile:
+		return newFileExporter(ctx, cfg.Exporter.File)
+	case exporterKafka:
+		return newKafkaExporter(ctx, cfg.Exporter.Kafka)
+	case exporterJaeger:
+		return newJaegerExporter(cfg.Exporter.Jaeger)
+	case exporterDatadog:
+		return newDatadogExporter(cfg.Exporter.Datadog), nil
+	case exporterXRay:
+		return newXRayExporter(cfg.Exporter.XRay)
+	}
+	return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter.Type)
+}
+
+func newOtlpRoutingExporter(ctx context.Context, collector CollectorConfig, endpoint string, headers map[string]string, routes []*route) (sdktrace.SpanExporter, error) {
+	exporters := map[string]sdktrace.SpanExporter{}
+	exporterOf := func(endpoint string) (sdktrace.SpanExporter, error) {
+		if exporter, ok := exporters[endpoint]; ok {
+			return exporter, nil
+		}
+		exporter, err := newOtlpExporter(ctx, collector, endpoint, headers)
+		if err != nil {
+			return nil, err
+		}
+		exporters[endpoint] = exporter
+		return exporter, nil
+	}
+
+	fallback, err := exporterOf(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if len(routes) == 0 {
+		return fallback, nil
+	}
+	for _, r := range routes {
+		if r.exporter, err = exporterOf(r.endpoint); err != nil {
+			return nil, fmt.Errorf("route %s: %w", r.name, err)
+		}
+	}
+	return newRoutingExporter(routes, fallback, exporters), nil
+}
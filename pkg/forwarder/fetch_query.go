@@ -0,0 +1,83 @@
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var fetchQueryPlaceholder = regexp.MustCompile(`\{[a-z_]*\}`)
+
+// fetchQueryFields are the placeholders of fetch.query: {columns} is the
+// list of columns scanned into spans, {source} the function returning them
+// and {filter} the shard's condition, true when not sharded
+var fetchQueryFields = map[string]bool{
+	"{columns}": true,
+	"{source}":  true,
+	"{filter}":  true,
+}
+
+func validateFetchQuery(query string) error {
+	if query == "" {
+		return nil
+	}
+	for _, placeholder := range fetchQueryPlaceholder.FindAllString(query, -1) {
+		if !fetchQueryFields[placeholder] {
+			return fmt.Errorf("unknown placeholder %s in fetch query %q", placeholder, query)
+		}
+	}
+	for _, placeholder := range []string{"{columns}", "{source}"} {
+		if !strings.Contains(query, placeholder) {
+			return fmt.Errorf("fetch query %q must select %s", query, placeholder)
+		}
+	}
+	return nil
+}
+
+// renderFetchQuery fills the placeholders of the configured fetch query
+func renderFetchQuery(query, columns, source, filter string) string {
+	if filter == "" {
+		filter = "true"
+	}
+	return strings.NewReplacer("{columns}", columns, "{source}", source, "{filter}", filter).Replace(query)
+}
+
+// extraColumn is a column selected by the fetch query after the scanned
+// ones, exported as an attribute named after it
+type extraColumn struct {
+	name  string
+	value any
+}
+
+// attribute returns the column's attribute, false when it's null
+func (c extraColumn) attribute() (attribute.KeyValue, bool) {
+	key := attribute.Key(c.name)
+	switch value := c.value.(type) {
+	case nil:
+		return attribute.KeyValue{}, false
+	case string:
+		return key.String(value), true
+	case []byte:
+		return key.String(string(value)), true
+	case bool:
+		return key.Bool(value), true
+	case int16:
+		return key.Int64(int64(value)), true
+	case int32:
+		return key.Int64(int64(value)), true
+	case int64:
+		return key.Int64(value), true
+	case float32:
+		return key.Float64(float64(value)), true
+	case float64:
+		return key.Float64(value), true
+	case time.Time:
+		return key.String(value.Format(time.RFC3339Nano)), true
+	case []string:
+		return key.StringSlice(value), true
+	}
+	return key.String(fmt.Sprint(c.value)), true
+}
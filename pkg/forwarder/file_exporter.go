@@ -0,0 +1,243 @@
+package forwarder
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// otlpIdFields are the fields the OTLP JSON encoding writes as hex rather
+// than protojson's base64
+var otlpIdFields = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+// fileClient is an otlptrace client writing each export request as an OTLP
+// JSON line
+type fileClient struct {
+	cfg FileExporterConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func newFileExporter(ctx context.Context, cfg FileExporterConfig) (*otlptrace.Exporter, error) {
+	exporter, err := otlptrace.New(ctx, &fileClient{cfg: cfg})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+func (c *fileClient) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.open()
+}
+
+func (c *fileClient) open() error {
+	file, err := os.OpenFile(c.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open span file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat span file: %w", err)
+	}
+	c.file = file
+	c.size = info.Size()
+	c.opened = time.Now()
+	if c.size > 0 {
+		// Keep the age of the file written by a previous run
+		c.opened = info.ModTime()
+	}
+	return nil
+}
+
+func (c *fileClient) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *fileClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	line, err := marshalOtlpJson(&collectortracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return fmt.Errorf("span file is closed")
+	}
+	if c.shouldRotate(int64(len(line))) {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := c.file.Write(line)
+	c.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write spans: %w", err)
+	}
+	return nil
+}
+
+func (c *fileClient) shouldRotate(next int64) bool {
+	if c.size == 0 {
+		return false
+	}
+	if c.cfg.MaxSize > 0 && c.size+next > c.cfg.MaxSize {
+		return true
+	}
+	return c.cfg.MaxAge > 0 && time.Since(c.opened) >= c.cfg.MaxAge
+}
+
+// rotatedPath inserts the rotation time before the extension, e.g.
+// spans-20231116T101500.000.jsonl, followed by a counter when a file rotated
+// in the same millisecond exists: spans-20231116T101500.000-1.jsonl
+func rotatedPath(path string, now time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext) + "-" + now.Format("20060102T150405.000")
+	rotated := base + ext
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return rotated
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// rotate renames and compresses the span file, and opens a new one. The
+// span file is reopened when the rename or the compression fails, so the
+// spans are still written.
+func (c *fileClient) rotate() error {
+	if err := c.file.Close(); err != nil {
+		log.Printf("Failed to close span file: %v", err)
+	}
+	c.file = nil
+	rotated := rotatedPath(c.cfg.Path, time.Now())
+	if err := os.Rename(c.cfg.Path, rotated); err != nil {
+		log.Printf("Failed to rotate span file: %v", err)
+	} else if c.cfg.Gzip {
+		if err := gzipFile(rotated); err != nil {
+			log.Printf("Failed to rotate span file: %v", err)
+		}
+	}
+	return c.open()
+}
+
+// gzipFile compresses path to path.gz and removes the original
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to compress span file: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return fmt.Errorf("failed to compress span file: %w", err)
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress span file: %w", err)
+	}
+	return os.Remove(path)
+}
+
+// marshalOtlpJson encodes a request following the OTLP JSON encoding:
+// enums as integers and ids as hex strings
+func marshalOtlpJson(req *collectortracepb.ExportTraceServiceRequest) ([]byte, error) {
+	content, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spans: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to encode spans: %w", err)
+	}
+	if err := convertIds(doc, base64.StdEncoding.DecodeString, hex.EncodeToString); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// unmarshalOtlpJson decodes a request written by marshalOtlpJson
+func unmarshalOtlpJson(content []byte) (*collectortracepb.ExportTraceServiceRequest, error) {
+	var doc any
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode spans: %w", err)
+	}
+	if err := convertIds(doc, hex.DecodeString, base64.StdEncoding.EncodeToString); err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode spans: %w", err)
+	}
+	req := &collectortracepb.ExportTraceServiceRequest{}
+	if err := protojson.Unmarshal(content, req); err != nil {
+		return nil, fmt.Errorf("failed to decode spans: %w", err)
+	}
+	return req, nil
+}
+
+// convertIds re-encodes the id fields of a decoded JSON document
+func convertIds(node any, decode func(string) ([]byte, error), encode func([]byte) string) error {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && otlpIdFields[key] {
+				id, err := decode(s)
+				if err != nil {
+					return fmt.Errorf("failed to decode %s: %w", key, err)
+				}
+				v[key] = encode(id)
+				continue
+			}
+			if err := convertIds(value, decode, encode); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if err := convertIds(value, decode, encode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
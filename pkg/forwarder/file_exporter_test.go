@@ -0,0 +1,81 @@
+package forwarder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func newTestFileClient(t *testing.T, cfg FileExporterConfig) *fileClient {
+	t.Helper()
+	client := &fileClient{cfg: cfg}
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Stop(context.Background()) })
+	return client
+}
+
+func uploadTestSpans(t *testing.T, client *fileClient) {
+	t.Helper()
+	spans := []*tracepb.ResourceSpans{{ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "select 1;"}}}}}}
+	if err := client.UploadTraces(context.Background(), spans); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotatedPathSameMillisecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	now := time.Date(2023, 11, 16, 10, 15, 0, 0, time.UTC)
+	first := rotatedPath(path, now)
+	if filepath.Base(first) != "spans-20231116T101500.000.jsonl" {
+		t.Fatalf("unexpected rotated path %s", first)
+	}
+	if err := os.WriteFile(first+".gz", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if second := rotatedPath(path, now); filepath.Base(second) != "spans-20231116T101500.000-1.jsonl" {
+		t.Fatalf("unexpected rotated path %s", second)
+	}
+}
+
+func TestFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	client := newTestFileClient(t, FileExporterConfig{Path: filepath.Join(dir, "spans.jsonl"), MaxSize: 1, Gzip: true})
+	for i := 0; i < 3; i++ {
+		uploadTestSpans(t, client)
+	}
+	rotated, err := filepath.Glob(filepath.Join(dir, "spans-*.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotations in the same millisecond don't overwrite each other
+	if len(rotated) != 2 {
+		t.Fatalf("%d rotated files, expected 2: %v", len(rotated), rotated)
+	}
+}
+
+func TestFileRotationReopensOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	client := newTestFileClient(t, FileExporterConfig{Path: path, MaxSize: 1})
+	uploadTestSpans(t, client)
+	// The rename of the removed file fails
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	uploadTestSpans(t, client)
+	if client.file == nil {
+		t.Fatal("span file wasn't reopened")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() == 0 {
+		t.Fatal("spans weren't written to the reopened file")
+	}
+}
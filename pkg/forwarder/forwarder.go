@@ -0,0 +1,145 @@
+package forwarder
+
+import (
+	"context"
+	"log"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Forwarder consumes the spans of the configured targets and exports them.
+// It's the pipeline run by the run subcommand, for programs embedding it.
+type Forwarder struct {
+	cfg          *Config
+	once         bool
+	configPath   string
+	load         func() (*Config, error)
+	processors   []sdktrace.SpanProcessor
+	transformers []SpanTransformer
+	exporter     sdktrace.SpanExporter
+	signals      bool
+}
+
+// Option configures a Forwarder
+type Option func(*Forwarder)
+
+// WithOnce consumes and exports the available spans, then returns from Run
+func WithOnce() Option {
+	return func(f *Forwarder) {
+		f.once = true
+	}
+}
+
+// WithReload reloads the configuration with load when the file at path
+// changes, through the admin API and on SIGHUP with WithSignals. Without it, a reload applies
+// the initial configuration again.
+func WithReload(path string, load func() (*Config, error)) Option {
+	return func(f *Forwarder) {
+		f.configPath = path
+		f.load = load
+	}
+}
+
+// WithSignals reloads the configuration on SIGHUP and logs the targets'
+// stats on SIGUSR1. Without it, no signal handler is installed, leaving the
+// signals to the embedding program.
+func WithSignals() Option {
+	return func(f *Forwarder) {
+		f.signals = true
+	}
+}
+
+// WithSpanProcessor registers processor on the TracerProvider of each
+// target, receiving the converted spans in-process. It's shut down with each
+// target.
+func WithSpanProcessor(processor sdktrace.SpanProcessor) Option {
+	return func(f *Forwarder) {
+		f.processors = append(f.processors, processor)
+	}
+}
+
+// WithSpanTransformer runs transformer on the spans of each target, after
+// the built-in transformers. It must be safe for concurrent use.
+func WithSpanTransformer(transformer SpanTransformer) Option {
+	return func(f *Forwarder) {
+		f.transformers = append(f.transformers, transformer)
+	}
+}
+
+// WithSpanExporter exports the spans of all targets with exporter instead
+// of the configured exporter. It's shared by the targets, and must be shut
+// down by the caller once Run returns.
+func WithSpanExporter(exporter sdktrace.SpanExporter) Option {
+	return func(f *Forwarder) {
+		f.exporter = exporter
+	}
+}
+
+// New validates cfg and returns a Forwarder running it
+func New(cfg Config, opts ...Option) (*Forwarder, error) {
+	f := &Forwarder{cfg: &cfg}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if err := f.cfg.validate(); err != nil {
+		return nil, err
+	}
+	f.cfg.SpanProcessors, f.cfg.SpanTransformers = f.processors, f.transformers
+	f.cfg.SpanExporter = f.exporter
+	load := f.load
+	if load == nil {
+		initial := f.cfg
+		load = func() (*Config, error) { return initial, nil }
+	}
+	// Reloaded configurations keep the processors, transformers and exporter
+	f.load = func() (*Config, error) {
+		cfg, err := load()
+		if err != nil {
+			return nil, err
+		}
+		cfg.SpanProcessors, cfg.SpanTransformers = f.processors, f.transformers
+		cfg.SpanExporter = f.exporter
+		return cfg, nil
+	}
+	return f, nil
+}
+
+// Run polls the targets until ctx is cancelled, or until the available
+// spans are exported with WithOnce. Buffered spans are flushed before
+// returning.
+func (f *Forwarder) Run(ctx context.Context) error {
+	cfg := f.cfg
+	// Buffered spans are still flushed once interrupted
+	shutdownCtx := context.Background()
+	pool := newTargetPool(cfg, f.once, f.signals, shutdownCtx)
+
+	if cfg.HTTP.Listen != "" {
+		stopHTTP, err := startHTTPServer(cfg.HTTP, cfg.Metrics, pool.targets)
+		if err != nil {
+			return err
+		}
+		defer stopHTTP(shutdownCtx)
+	}
+	if cfg.Admin.Listen != "" && f.once {
+		log.Printf("The admin API is only served when running continuously")
+	} else if cfg.Admin.Listen != "" {
+		stopAdmin, err := startAdminServer(cfg.Admin, pool, f.load)
+		if err != nil {
+			return err
+		}
+		defer stopAdmin(shutdownCtx)
+	}
+
+	// Each target is polled by its own worker
+	targets, err := discoverTargets(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if err := pool.start(ctx, targets); err != nil {
+		return err
+	}
+	if !f.once {
+		pool.startWatching(ctx, f.configPath, f.load)
+	}
+	return pool.wait()
+}
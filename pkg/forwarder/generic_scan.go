@@ -0,0 +1,106 @@
+package forwarder
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// spanColumnTargets are the scan targets of the columns known to the
+// forwarder, used when all the columns are selected
+var spanColumnTargets = map[string]func(r *spanRow) any{
+	"trace_id":       func(r *spanRow) any { return r.traceIdTarget() },
+	"parent_id":      func(r *spanRow) any { return r.idTarget("parent_id", &r.parentId) },
+	"span_id":        func(r *spanRow) any { return r.idTarget("span_id", &r.spanId) },
+	"span_type":      func(r *spanRow) any { return &r.spanType },
+	"span_operation": func(r *spanRow) any { return &r.spanOperation },
+	"deparse_info":   func(r *spanRow) any { return &r.deparseInfo },
+	"parameters":     func(r *spanRow) any { return &r.parameters },
+	"span_start":     func(r *spanRow) any { return &r.spanStart },
+	"startup":        func(r *spanRow) any { return &r.startup },
+	"pid":            func(r *spanRow) any { return &r.pid },
+	"subxact_count":  func(r *spanRow) any { return &r.subxactCount },
+	"sql_error_code": func(r *spanRow) any { return &r.sqlErrorCode },
+	"rows":           func(r *spanRow) any { return &r.rows },
+
+	"plan_startup_cost": func(r *spanRow) any { return &r.planStartupCost },
+	"plan_total_cost":   func(r *spanRow) any { return &r.planTotalCost },
+	"plan_rows":         func(r *spanRow) any { return &r.planRows },
+	"plan_width":        func(r *spanRow) any { return &r.planWidth },
+
+	"shared_blks_hit":     func(r *spanRow) any { return &r.sharedBlks.hit },
+	"shared_blks_read":    func(r *spanRow) any { return &r.sharedBlks.read },
+	"shared_blks_dirtied": func(r *spanRow) any { return &r.sharedBlks.dirtied },
+	"shared_blks_written": func(r *spanRow) any { return &r.sharedBlks.written },
+	"local_blks_hit":      func(r *spanRow) any { return &r.localBlks.hit },
+	"local_blks_read":     func(r *spanRow) any { return &r.localBlks.read },
+	"local_blks_dirtied":  func(r *spanRow) any { return &r.localBlks.dirtied },
+	"local_blks_written":  func(r *spanRow) any { return &r.localBlks.written },
+	"blk_read_time":       func(r *spanRow) any { return &r.blkTime.readTime },
+	"blk_write_time":      func(r *spanRow) any { return &r.blkTime.writeTime },
+	"temp_blks_read":      func(r *spanRow) any { return &r.tempBlks.read },
+	"temp_blks_written":   func(r *spanRow) any { return &r.tempBlks.written },
+	"temp_blk_read_time":  func(r *spanRow) any { return &r.tempBlkTime.readTime },
+	"temp_blk_write_time": func(r *spanRow) any { return &r.tempBlkTime.writeTime },
+
+	"wal_records": func(r *spanRow) any { return &r.walRecords },
+	"wal_fpi":     func(r *spanRow) any { return &r.walFpi },
+	"wal_bytes":   func(r *spanRow) any { return &r.walBytes },
+
+	"jit_functions":         func(r *spanRow) any { return &r.jitFunctions },
+	"jit_generation_time":   func(r *spanRow) any { return &r.jitGenerationTime },
+	"jit_inlining_time":     func(r *spanRow) any { return &r.jitInliningTime },
+	"jit_optimization_time": func(r *spanRow) any { return &r.jitOptimizationTime },
+	"jit_emission_time":     func(r *spanRow) any { return &r.jitEmissionTime },
+}
+
+func init() {
+	for _, column := range optionalColumns {
+		spanColumnTargets[column.name] = column.target
+	}
+}
+
+// minimalSpanColumns are the columns a span can't be built without
+var minimalSpanColumns = []string{"trace_id", "parent_id", "span_id", "span_type", "span_operation", "span_start"}
+
+// genericTargets returns the scan targets of the selected columns. Unknown
+// columns are scanned into pgx's generic values, nil for known columns.
+func genericTargets(fields []pgconn.FieldDescription) ([]func(r *spanRow) any, error) {
+	selected := make(map[string]bool, len(fields))
+	targets := make([]func(r *spanRow) any, len(fields))
+	for i, field := range fields {
+		selected[field.Name] = true
+		targets[i] = spanColumnTargets[field.Name]
+	}
+	for _, column := range minimalSpanColumns {
+		if !selected[column] {
+			return nil, fmt.Errorf("spans are missing the %s column", column)
+		}
+	}
+	return targets, nil
+}
+
+// scanGenericRow scans a row of all the columns, keeping the unknown ones as
+// extra columns exported as attributes
+func scanGenericRow(rows pgx.Rows, targets []func(r *spanRow) any) (*spanRow, error) {
+	r := &spanRow{}
+	fields := rows.FieldDescriptions()
+	values := make([]any, len(targets))
+	var extra []int
+	for i, target := range targets {
+		if target != nil {
+			values[i] = target(r)
+		} else {
+			values[i] = new(any)
+			extra = append(extra, i)
+		}
+	}
+	if err := rows.Scan(values...); err != nil {
+		return r, err
+	}
+	for _, i := range extra {
+		r.extra = append(r.extra, extraColumn{name: fields[i].Name, value: *values[i].(*any)})
+	}
+	return r, nil
+}
@@ -0,0 +1,120 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// HA modes
+const (
+	haNone            = "none"
+	haAdvisoryLock    = "advisory_lock"
+	haKubernetesLease = "kubernetes_lease"
+)
+
+const metricLeader = "pg_tracing.forwarder.leader"
+
+// defaultHALockId is the default advisory lock key, "pgtracin" as an int64
+const defaultHALockId = 0x706774726163696e
+
+func validateHAConfig(cfg HAConfig, pollInterval time.Duration) error {
+	switch cfg.Mode {
+	case "", haNone, haAdvisoryLock:
+		return nil
+	case haKubernetesLease:
+		if cfg.Lease.Name == "" {
+			return fmt.Errorf("kubernetes lease requires a name")
+		}
+		if cfg.Lease.Duration <= pollInterval {
+			return fmt.Errorf("kubernetes lease duration must be longer than the poll interval")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown ha mode %q, expected one of: none, advisory_lock, kubernetes_lease", cfg.Mode)
+}
+
+// consumerLock elects the replica consuming a target's spans
+type consumerLock interface {
+	// acquire returns whether the lock is held, trying to take it otherwise
+	acquire(ctx context.Context) (bool, error)
+}
+
+// newConsumerLock returns the lock of the HA mode, nil if none is set
+func newConsumerLock(cfg *Config, conn *pgx.Conn) (consumerLock, error) {
+	switch cfg.HA.Mode {
+	case haAdvisoryLock:
+		return &advisoryLock{conn: conn, id: cfg.HA.LockId}, nil
+	case haKubernetesLease:
+		lock, err := newLeaseLock(cfg.HA.Lease, cfg.Target)
+		if err != nil {
+			return nil, err
+		}
+		return lock, nil
+	}
+	return nil, nil
+}
+
+// advisoryLock is a session level advisory lock, held until the connection
+// is closed. A replica dying releases it with its connection.
+type advisoryLock struct {
+	conn *pgx.Conn
+	id   int64
+	held bool
+}
+
+func (l *advisoryLock) acquire(ctx context.Context) (bool, error) {
+	if l.held {
+		return true, nil
+	}
+	if err := l.conn.QueryRow(ctx, "select pg_try_advisory_lock($1)", l.id).Scan(&l.held); err != nil {
+		return false, fmt.Errorf("failed to acquire advisory lock %d: %w", l.id, err)
+	}
+	return l.held, nil
+}
+
+// initLeaderMetric reports whether the replica holds the consumer lock
+func (fw *targetForwarder) initLeaderMetric(meter metric.Meter) error {
+	_, err := meter.Int64ObservableGauge(metricLeader,
+		metric.WithDescription("1 when the replica holds the consumer lock, 0 on standby"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			var leader int64
+			if fw.leader.Load() {
+				leader = 1
+			}
+			o.Observe(leader)
+			return nil
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to create leader gauge: %w", err)
+	}
+	return nil
+}
+
+// holdsLock returns whether this replica consumes spans, logging the
+// transitions. Spans are consumed when no HA mode is set.
+func (fw *targetForwarder) holdsLock(ctx context.Context) bool {
+	if fw.lock == nil {
+		return true
+	}
+	held, err := fw.lock.acquire(ctx)
+	if err != nil {
+		fw.log.Printf("Failed to check the consumer lock: %v", err)
+	}
+	if held != fw.leader.Load() || !fw.lockChecked {
+		switch {
+		case held:
+			fw.log.Printf("Acquired the consumer lock, consuming spans")
+		case fw.leader.Load():
+			fw.log.Printf("Lost the consumer lock, standing by")
+		default:
+			fw.log.Printf("Another replica holds the consumer lock, standing by")
+		}
+	}
+	fw.lockChecked = true
+	fw.leader.Store(held)
+	return held
+}
@@ -0,0 +1,61 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// startHTTPServer serves the forwarder's HTTP endpoints on cfg.Listen, with
+// Prometheus metrics if enabled. The returned function stops the server.
+func startHTTPServer(cfg HTTPConfig, metrics MetricsConfig, targets func() []*target) (func(context.Context), error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveWebUI(targets))
+	if metrics.Prometheus {
+		// OpenMetrics is needed to expose exemplars
+		mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(targetsGatherer(targets), promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	}
+	return serveHTTP("HTTP", cfg.Listen, mux)
+}
+
+// targetsGatherer gathers the default registry and the registries of the
+// running targets
+func targetsGatherer(targets func() []*target) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer}
+		for _, t := range targets() {
+			gatherers = append(gatherers, t.registry)
+		}
+		return gatherers.Gather()
+	})
+}
+
+// serveHTTP serves handler on address in the background. The returned
+// function stops the server.
+func serveHTTP(name string, address string, handler http.Handler) (func(context.Context), error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("%s server failed: %v", name, err)
+		}
+	}()
+	log.Printf("Serving %s on %s", name, listener.Addr())
+	return func(ctx context.Context) {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shutdown %s server: %v", name, err)
+		}
+	}, nil
+}
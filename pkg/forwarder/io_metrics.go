@@ -0,0 +1,121 @@
+package forwarder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	metricIOBlocks     = "pg_tracing.io.blocks"
+	metricIOBlockTime  = "pg_tracing.io.block_time"
+	metricWALRecords   = "pg_tracing.wal.records"
+	metricWALFpi       = "pg_tracing.wal.fpi"
+	metricWALBytes     = "pg_tracing.wal.bytes"
+	metricJITFunctions = "pg_tracing.jit.functions"
+	metricJITTime      = "pg_tracing.jit.time"
+)
+
+// ioMetrics aggregates the block, WAL and JIT counters of statements into
+// cumulative counters per operation fingerprint and database
+type ioMetrics struct {
+	blocks       metric.Int64Counter
+	blockTime    metric.Float64Counter
+	walRecords   metric.Int64Counter
+	walFpi       metric.Int64Counter
+	walBytes     metric.Int64Counter
+	jitFunctions metric.Int64Counter
+	jitTime      metric.Float64Counter
+}
+
+func newIOMetrics(meter metric.Meter) (*ioMetrics, error) {
+	m := &ioMetrics{}
+	var err error
+	int64Counters := []struct {
+		counter     *metric.Int64Counter
+		name        string
+		unit        string
+		description string
+	}{
+		{&m.blocks, metricIOBlocks, "{block}", "Blocks accessed by statements per kind and operation"},
+		{&m.walRecords, metricWALRecords, "{record}", "WAL records generated by statements"},
+		{&m.walFpi, metricWALFpi, "{page}", "WAL full page images generated by statements"},
+		{&m.walBytes, metricWALBytes, "By", "WAL bytes generated by statements"},
+		{&m.jitFunctions, metricJITFunctions, "{function}", "Functions JIT compiled by statements"},
+	}
+	for _, c := range int64Counters {
+		if *c.counter, err = meter.Int64Counter(c.name, metric.WithUnit(c.unit), metric.WithDescription(c.description)); err != nil {
+			return nil, fmt.Errorf("failed to create %s counter: %w", c.name, err)
+		}
+	}
+	if m.blockTime, err = meter.Float64Counter(metricIOBlockTime, metric.WithUnit("ms"),
+		metric.WithDescription("Time spent reading and writing blocks by statements")); err != nil {
+		return nil, fmt.Errorf("failed to create %s counter: %w", metricIOBlockTime, err)
+	}
+	if m.jitTime, err = meter.Float64Counter(metricJITTime, metric.WithUnit("ms"),
+		metric.WithDescription("Time spent in JIT compilation by statements per phase")); err != nil {
+		return nil, fmt.Errorf("failed to create %s counter: %w", metricJITTime, err)
+	}
+	return m, nil
+}
+
+func addInt64(ctx context.Context, c metric.Int64Counter, v sql.NullInt64, attrs []attribute.KeyValue) {
+	if v.Valid && v.Int64 > 0 {
+		c.Add(ctx, v.Int64, metric.WithAttributes(attrs...))
+	}
+}
+
+func addFloat64(ctx context.Context, c metric.Float64Counter, v sql.NullFloat64, attrs []attribute.KeyValue) {
+	if v.Valid && v.Float64 > 0 {
+		c.Add(ctx, v.Float64, metric.WithAttributes(attrs...))
+	}
+}
+
+// record adds the counters of a top-level statement span. Planner and
+// executor spans are skipped as their counters are included in their
+// statement's.
+func (m *ioMetrics) record(ctx context.Context, r *spanRow) {
+	if !isTopSpan(r.spanType) {
+		return
+	}
+	base := []attribute.KeyValue{
+		attribute.String("db.operation.fingerprint", operationFingerprint(r.spanOperation)),
+		semconv.DBName(r.dbName),
+	}
+	with := func(kvs ...attribute.KeyValue) []attribute.KeyValue {
+		return append(append([]attribute.KeyValue{}, base...), kvs...)
+	}
+
+	for _, b := range []struct {
+		kind  string
+		stats BlockStats
+	}{{"shared", r.sharedBlks}, {"local", r.localBlks}, {"temp", r.tempBlks}} {
+		kind := attribute.String("block.kind", b.kind)
+		addInt64(ctx, m.blocks, b.stats.hit, with(kind, attribute.String("block.op", "hit")))
+		addInt64(ctx, m.blocks, b.stats.read, with(kind, attribute.String("block.op", "read")))
+		addInt64(ctx, m.blocks, b.stats.dirtied, with(kind, attribute.String("block.op", "dirtied")))
+		addInt64(ctx, m.blocks, b.stats.written, with(kind, attribute.String("block.op", "written")))
+	}
+	for _, t := range []struct {
+		kind string
+		time BlockTime
+	}{{"shared", r.blkTime}, {"temp", r.tempBlkTime}} {
+		kind := attribute.String("block.kind", t.kind)
+		addFloat64(ctx, m.blockTime, t.time.readTime, with(kind, attribute.String("block.op", "read")))
+		addFloat64(ctx, m.blockTime, t.time.writeTime, with(kind, attribute.String("block.op", "write")))
+	}
+
+	addInt64(ctx, m.walRecords, r.walRecords, base)
+	addInt64(ctx, m.walFpi, r.walFpi, base)
+	addInt64(ctx, m.walBytes, r.walBytes, base)
+
+	addInt64(ctx, m.jitFunctions, r.jitFunctions, base)
+	addFloat64(ctx, m.jitTime, r.jitGenerationTime, with(attribute.String("jit.phase", "generation")))
+	addFloat64(ctx, m.jitTime, r.jitInliningTime, with(attribute.String("jit.phase", "inlining")))
+	addFloat64(ctx, m.jitTime, r.jitOptimizationTime, with(attribute.String("jit.phase", "optimization")))
+	addFloat64(ctx, m.jitTime, r.jitEmissionTime, with(attribute.String("jit.phase", "emission")))
+}
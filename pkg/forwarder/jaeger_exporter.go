@@ -0,0 +1,51 @@
+package forwarder
+
+import (
+	"fmt"
+	"log"
+	"net"
+
+	"go.opentelemetry.io/otel/exporters/jaeger"
+)
+
+const defaultJaegerEndpoint = "http://localhost:14268/api/traces"
+
+func validateJaegerConfig(cfg JaegerExporterConfig) error {
+	if cfg.Agent == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.Agent); err != nil {
+		return fmt.Errorf("invalid jaeger agent address %q: %w", cfg.Agent, err)
+	}
+	return nil
+}
+
+// newJaegerExporter sends spans to the agent over UDP if configured,
+// otherwise to the collector's HTTP endpoint. The OpenTelemetry jaeger
+// exporter is deprecated and no longer maintained.
+func newJaegerExporter(cfg JaegerExporterConfig) (*jaeger.Exporter, error) {
+	log.Printf("The jaeger exporter is deprecated: %s", deprecatedExporters[exporterJaeger])
+	var endpoint jaeger.EndpointOption
+	if cfg.Agent != "" {
+		host, port, err := net.SplitHostPort(cfg.Agent)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jaeger agent address %q: %w", cfg.Agent, err)
+		}
+		endpoint = jaeger.WithAgentEndpoint(jaeger.WithAgentHost(host), jaeger.WithAgentPort(port))
+	} else {
+		url := cfg.Endpoint
+		if url == "" {
+			url = defaultJaegerEndpoint
+		}
+		opts := []jaeger.CollectorEndpointOption{jaeger.WithEndpoint(url)}
+		if cfg.Username != "" {
+			opts = append(opts, jaeger.WithUsername(cfg.Username), jaeger.WithPassword(cfg.Password))
+		}
+		endpoint = jaeger.WithCollectorEndpoint(opts...)
+	}
+	exporter, err := jaeger.New(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jaeger exporter: %w", err)
+	}
+	return exporter, nil
+}
@@ -0,0 +1,112 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	// kubeAnnotationPrefix prefixes the annotations describing how to
+	// connect to a discovered instance
+	kubeAnnotationPrefix = "pg-tracing-forwarder/"
+	kubeKindPods         = "pods"
+	kubeKindServices     = "services"
+)
+
+type kubeMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// kubeObjectList is a list of pods or services, with the fields used by the
+// discovery only
+type kubeObjectList struct {
+	Items []struct {
+		Metadata kubeMetadata `json:"metadata"`
+		Status   struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func validateKubernetesDiscoveryConfig(c KubernetesDiscoveryConfig) error {
+	if c.LabelSelector == "" {
+		if c.Namespace != "" || c.Kind != "" {
+			return fmt.Errorf("kubernetes discovery requires a label_selector")
+		}
+		return nil
+	}
+	if c.Kind != "" && c.Kind != kubeKindPods && c.Kind != kubeKindServices {
+		return fmt.Errorf("unknown kubernetes discovery kind %q, expected %s or %s", c.Kind, kubeKindPods, kubeKindServices)
+	}
+	return nil
+}
+
+// kubeTargetDSN builds the DSN of a discovered instance from its
+// annotations. The dsn annotation is used as is, after replacing {host}.
+func kubeTargetDSN(host string, annotations map[string]string) string {
+	if dsn, ok := annotations[kubeAnnotationPrefix+"dsn"]; ok {
+		return strings.ReplaceAll(dsn, "{host}", host)
+	}
+	port := "5432"
+	if p, ok := annotations[kubeAnnotationPrefix+"port"]; ok {
+		port = p
+	}
+	dsn := "host=" + host + " port=" + port
+	for _, key := range []string{"dbname", "user"} {
+		if v, ok := annotations[kubeAnnotationPrefix+key]; ok {
+			dsn += " " + key + "=" + v
+		}
+	}
+	return dsn
+}
+
+// discoverKubernetesTargets lists the running pods, or the services,
+// matching the label selector. Targets are named namespace/name.
+func discoverKubernetesTargets(ctx context.Context, cfg KubernetesDiscoveryConfig) ([]TargetConfig, error) {
+	client, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = client.namespace
+	}
+	kind := cfg.Kind
+	if kind == "" {
+		kind = kubeKindPods
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/%s?labelSelector=%s", url.PathEscape(namespace), kind, url.QueryEscape(cfg.LabelSelector))
+	var list kubeObjectList
+	if err := client.get(ctx, path, &list); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", kind, err)
+	}
+
+	var targets []TargetConfig
+	for _, item := range list.Items {
+		meta := item.Metadata
+		attributes := map[string]string{"k8s.namespace.name": meta.Namespace}
+		var host string
+		if kind == kubeKindPods {
+			// Pending and terminated pods are picked on a later discovery
+			if item.Status.Phase != "Running" || item.Status.PodIP == "" {
+				continue
+			}
+			host = item.Status.PodIP
+			attributes["k8s.pod.name"] = meta.Name
+		} else {
+			host = meta.Name + "." + meta.Namespace + ".svc"
+			attributes["k8s.service.name"] = meta.Name
+		}
+		targets = append(targets, TargetConfig{
+			Name:     meta.Namespace + "/" + meta.Name,
+			DSN:      kubeTargetDSN(host, meta.Annotations),
+			Resource: TargetResourceConfig{Attributes: attributes},
+		})
+	}
+	return targets, nil
+}
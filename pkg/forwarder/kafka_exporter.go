@@ -0,0 +1,166 @@
+package forwarder
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Kafka message encodings, named like the collector's kafka receiver
+const (
+	kafkaOtlpProto = "otlp_proto"
+	kafkaOtlpJson  = "otlp_json"
+)
+
+// SASL mechanisms
+const (
+	saslPlain       = "plain"
+	saslScramSha256 = "scram-sha-256"
+	saslScramSha512 = "scram-sha-512"
+)
+
+const defaultKafkaTopic = "otlp_spans"
+
+func validateKafkaConfig(cfg KafkaExporterConfig) error {
+	if len(cfg.Brokers) == 0 {
+		return fmt.Errorf("kafka exporter brokers are required")
+	}
+	switch cfg.Encoding {
+	case "", kafkaOtlpProto, kafkaOtlpJson:
+	default:
+		return fmt.Errorf("unknown kafka encoding %q, expected one of: %s, %s", cfg.Encoding, kafkaOtlpProto, kafkaOtlpJson)
+	}
+	_, err := kafkaSasl(cfg.Auth)
+	return err
+}
+
+func kafkaSasl(cfg KafkaAuthConfig) (sasl.Mechanism, error) {
+	switch strings.ToLower(cfg.Mechanism) {
+	case "":
+		return nil, nil
+	case saslPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case saslScramSha256:
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case saslScramSha512:
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	}
+	return nil, fmt.Errorf("unknown kafka sasl mechanism %q, expected one of: %s, %s, %s",
+		cfg.Mechanism, saslPlain, saslScramSha256, saslScramSha512)
+}
+
+// kafkaClient is an otlptrace client publishing one message per trace, keyed
+// by trace id so all spans of a trace land in the same partition
+type kafkaClient struct {
+	encoding string
+	writer   *kafka.Writer
+}
+
+func newKafkaExporter(ctx context.Context, cfg KafkaExporterConfig) (*otlptrace.Exporter, error) {
+	mechanism, err := kafkaSasl(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	transport := &kafka.Transport{SASL: mechanism}
+	if cfg.Auth.TLS {
+		transport.TLS = &tls.Config{}
+	}
+	topic := cfg.Topic
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	encoding := cfg.Encoding
+	if encoding == "" {
+		encoding = kafkaOtlpProto
+	}
+	client := &kafkaClient{
+		encoding: encoding,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+	}
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka exporter: %w", err)
+	}
+	return exporter, nil
+}
+
+func (c *kafkaClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *kafkaClient) Stop(ctx context.Context) error {
+	return c.writer.Close()
+}
+
+// splitByTrace regroups resource spans per trace, keeping their resource
+// and scope
+func splitByTrace(resourceSpans []*tracepb.ResourceSpans) (map[string][]*tracepb.ResourceSpans, []string) {
+	var traceIds []string
+	byTrace := map[string][]*tracepb.ResourceSpans{}
+	for _, rs := range resourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				traceId := hex.EncodeToString(span.TraceId)
+				traces := byTrace[traceId]
+				if traces == nil {
+					traceIds = append(traceIds, traceId)
+				}
+				if len(traces) == 0 || traces[len(traces)-1].Resource != rs.Resource {
+					traces = append(traces, &tracepb.ResourceSpans{Resource: rs.Resource, SchemaUrl: rs.SchemaUrl})
+				}
+				last := traces[len(traces)-1]
+				if len(last.ScopeSpans) == 0 || last.ScopeSpans[len(last.ScopeSpans)-1].Scope != ss.Scope {
+					last.ScopeSpans = append(last.ScopeSpans, &tracepb.ScopeSpans{Scope: ss.Scope, SchemaUrl: ss.SchemaUrl})
+				}
+				scope := last.ScopeSpans[len(last.ScopeSpans)-1]
+				scope.Spans = append(scope.Spans, span)
+				byTrace[traceId] = traces
+			}
+		}
+	}
+	return byTrace, traceIds
+}
+
+func (c *kafkaClient) marshal(req *collectortracepb.ExportTraceServiceRequest) ([]byte, error) {
+	if c.encoding == kafkaOtlpJson {
+		return marshalOtlpJson(req)
+	}
+	content, err := proto.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spans: %w", err)
+	}
+	return content, nil
+}
+
+func (c *kafkaClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	byTrace, traceIds := splitByTrace(protoSpans)
+	messages := make([]kafka.Message, 0, len(traceIds))
+	for _, traceId := range traceIds {
+		value, err := c.marshal(&collectortracepb.ExportTraceServiceRequest{ResourceSpans: byTrace[traceId]})
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(traceId), Value: value})
+	}
+	if err := c.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("failed to publish spans to kafka: %w", err)
+	}
+	return nil
+}
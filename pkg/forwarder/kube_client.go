@@ -0,0 +1,113 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient queries the Kubernetes API server with the pod's service account
+type kubeClient struct {
+	baseURL string
+	client  *http.Client
+	// namespace is the namespace of the forwarder's pod
+	namespace string
+}
+
+func newKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT aren't set")
+	}
+	ca, err := os.ReadFile(kubeServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in the service account CA")
+	}
+	namespace, err := os.ReadFile(kubeServiceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the service account namespace: %w", err)
+	}
+	return &kubeClient{
+		baseURL: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Timeout:   discoveryTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		namespace: strings.TrimSpace(string(namespace)),
+	}, nil
+}
+
+// kubeStatusError is an error status returned by the API server
+type kubeStatusError struct {
+	status int
+	msg    string
+}
+
+func (e *kubeStatusError) Error() string {
+	return fmt.Sprintf("Kubernetes API returned %d: %s", e.status, e.msg)
+}
+
+func isKubeStatus(err error, status int) bool {
+	var statusErr *kubeStatusError
+	return errors.As(err, &statusErr) && statusErr.status == status
+}
+
+// get queries the API server and decodes its JSON response in out
+func (c *kubeClient) get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, nil, out)
+}
+
+// do sends body as JSON to the API server and decodes its JSON response in
+// out
+func (c *kubeClient) do(ctx context.Context, method, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode the Kubernetes API request: %w", err)
+		}
+		reqBody = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	// Projected tokens are rotated, the file is read on each request
+	token, err := os.ReadFile(kubeServiceAccountDir + "/token")
+	if err != nil {
+		return fmt.Errorf("failed to read the service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query the Kubernetes API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &kubeStatusError{status: resp.StatusCode, msg: strings.TrimSpace(string(msg))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the Kubernetes API response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// kubeMicroTime is the format of the Lease timestamps
+const kubeMicroTime = "2006-01-02T15:04:05.000000Z07:00"
+
+var invalidLeaseName = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+type kubeLease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+// leaseLock is a Kubernetes Lease, renewed by its holder on each poll. A
+// replica dying stops renewing it, and it's taken over once expired.
+type leaseLock struct {
+	client    *kubeClient
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+}
+
+// leaseName returns the name of a target's Lease, a valid object name
+func leaseName(base, target string) string {
+	if target == "" {
+		return base
+	}
+	name := invalidLeaseName.ReplaceAllString(strings.ToLower(target), "-")
+	return strings.Trim(base+"-"+name, "-.")
+}
+
+func newLeaseLock(cfg LeaseConfig, target string) (*leaseLock, error) {
+	client, err := newKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hostname for the lease identity: %w", err)
+	}
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = client.namespace
+	}
+	return &leaseLock{
+		client:    client,
+		namespace: namespace,
+		name:      leaseName(cfg.Name, target),
+		identity:  identity,
+		duration:  cfg.Duration,
+	}, nil
+}
+
+func (l *leaseLock) path() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", url.PathEscape(l.namespace))
+}
+
+// acquire creates the Lease, renews it if held, or takes it over once
+// expired. Concurrent updates are rejected by the API server on the
+// resource version.
+func (l *leaseLock) acquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	var lease kubeLease
+	err := l.client.get(ctx, l.path()+"/"+url.PathEscape(l.name), &lease)
+	if isKubeStatus(err, http.StatusNotFound) {
+		lease.APIVersion = "coordination.k8s.io/v1"
+		lease.Kind = "Lease"
+		lease.Metadata.Name = l.name
+		lease.Metadata.Namespace = l.namespace
+		lease.Spec.HolderIdentity = l.identity
+		lease.Spec.LeaseDurationSeconds = int(l.duration.Seconds())
+		lease.Spec.AcquireTime = now.Format(kubeMicroTime)
+		lease.Spec.RenewTime = lease.Spec.AcquireTime
+		return l.update(ctx, http.MethodPost, l.path(), &lease)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read lease %s: %w", l.name, err)
+	}
+
+	if lease.Spec.HolderIdentity != l.identity {
+		renewed, err := time.Parse(time.RFC3339Nano, lease.Spec.RenewTime)
+		expiry := time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second
+		if err == nil && lease.Spec.HolderIdentity != "" && now.Before(renewed.Add(expiry)) {
+			return false, nil
+		}
+		lease.Spec.HolderIdentity = l.identity
+		lease.Spec.AcquireTime = now.Format(kubeMicroTime)
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.LeaseDurationSeconds = int(l.duration.Seconds())
+	lease.Spec.RenewTime = now.Format(kubeMicroTime)
+	return l.update(ctx, http.MethodPut, l.path()+"/"+url.PathEscape(l.name), &lease)
+}
+
+func (l *leaseLock) update(ctx context.Context, method, path string, lease *kubeLease) (bool, error) {
+	err := l.client.do(ctx, method, path, lease, lease)
+	if isKubeStatus(err, http.StatusConflict) {
+		// Another replica created or updated the Lease first
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update lease %s: %w", l.name, err)
+	}
+	return true, nil
+}
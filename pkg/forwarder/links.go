@@ -0,0 +1,65 @@
+package forwarder
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const workerNumberKey = "db.postgresql.parallel.worker_number"
+
+var workerSpan = regexp.MustCompile(`^Worker\s*(\d+)?`)
+
+// workerNumber returns the worker number of a parallel worker span
+func workerNumber(r *spanRow) (int, bool) {
+	match := workerSpan.FindStringSubmatch(r.spanOperation)
+	if match == nil {
+		match = workerSpan.FindStringSubmatch(r.spanType)
+	}
+	if match == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return -1, true
+	}
+	return n, true
+}
+
+func isGatherSpan(r *spanRow) bool {
+	return strings.HasPrefix(r.spanType, "Gather") || strings.HasPrefix(r.spanOperation, "Gather")
+}
+
+func spanContextOf(r *spanRow) trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    r.traceID(),
+		SpanID:     spanIdOf(r.spanId),
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+// collectWorkerLinks links each gather node span to the spans of its parallel
+// workers, found by walking up the workers' ancestors
+func (b *spanBatch) collectWorkerLinks() {
+	for _, r := range b.rows {
+		number, ok := workerNumber(r)
+		if !ok {
+			continue
+		}
+		parent := b.bySpanId[r.parentId]
+		for depth := 0; parent != nil && !isGatherSpan(parent) && depth < len(b.rows); depth++ {
+			parent = b.bySpanId[parent.parentId]
+		}
+		if parent == nil || !isGatherSpan(parent) {
+			continue
+		}
+		link := trace.Link{SpanContext: spanContextOf(r)}
+		if number >= 0 {
+			link.Attributes = []attribute.KeyValue{attribute.Int(workerNumberKey, number)}
+		}
+		b.links[parent.spanId] = append(b.links[parent.spanId], link)
+	}
+}
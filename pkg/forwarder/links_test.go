@@ -0,0 +1,71 @@
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// parallelPlanRows returns a parallel query with one numbered and one
+// unnumbered worker under a gather node, and a worker outside of any gather
+func parallelPlanRows() []*spanRow {
+	rows := []Row{
+		testRow(10, 0, "Select query", "select count(*) from events;", 0, 10*time.Millisecond),
+		testRow(11, 10, "ExecutorRun", "ExecutorRun", time.Millisecond, 8*time.Millisecond),
+		testRow(12, 11, "Gather", "Gather", time.Millisecond, 8*time.Millisecond),
+		testRow(13, 12, "SeqScan", "SeqScan on events", 2*time.Millisecond, 6*time.Millisecond),
+		testRow(14, 12, "Worker", "Worker 0", 2*time.Millisecond, 6*time.Millisecond),
+		testRow(15, 14, "SeqScan", "SeqScan on events", 2*time.Millisecond, 6*time.Millisecond),
+		testRow(16, 12, "Worker", "Worker", 2*time.Millisecond, 6*time.Millisecond),
+		testRow(17, 10, "Worker", "Worker 1", 2*time.Millisecond, 6*time.Millisecond),
+	}
+	spanRows := make([]*spanRow, len(rows))
+	for i, row := range rows {
+		spanRows[i] = row.spanRow()
+	}
+	return spanRows
+}
+
+func TestWorkerNumber(t *testing.T) {
+	for _, tc := range []struct {
+		spanType  string
+		operation string
+		number    int
+		ok        bool
+	}{
+		{"Worker", "Worker 2", 2, true},
+		{"Worker 3", "Parallel worker", 3, true},
+		{"Worker", "Worker", -1, true},
+		{"SeqScan", "SeqScan on events", 0, false},
+	} {
+		r := testRow(1, 0, tc.spanType, tc.operation, 0, time.Millisecond).spanRow()
+		number, ok := workerNumber(r)
+		if number != tc.number || ok != tc.ok {
+			t.Errorf("%s/%s: got %d, %v, expected %d, %v", tc.spanType, tc.operation, number, ok, tc.number, tc.ok)
+		}
+	}
+}
+
+func TestCollectWorkerLinks(t *testing.T) {
+	rows := parallelPlanRows()
+	batch := newSpanBatch(rows)
+	batch.collectWorkerLinks()
+
+	want := []trace.Link{
+		{
+			SpanContext: spanContextOf(batch.bySpanId[14]),
+			Attributes:  []attribute.KeyValue{attribute.Int(workerNumberKey, 0)},
+		},
+		{SpanContext: spanContextOf(batch.bySpanId[16])},
+	}
+	if got := batch.links[12]; !reflect.DeepEqual(got, want) {
+		t.Errorf("gather links: got %+v, expected %+v", got, want)
+	}
+	// The worker outside of a gather node isn't linked
+	if len(batch.links) != 1 {
+		t.Errorf("links on %d spans, expected only the gather node", len(batch.links))
+	}
+}
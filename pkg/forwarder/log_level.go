@@ -0,0 +1,28 @@
+package forwarder
+
+import "fmt"
+
+// Log levels
+const (
+	logLevelInfo  = "info"
+	logLevelDebug = "debug"
+)
+
+func validateLogLevel(level string, sampling int) error {
+	if level != "" && level != logLevelInfo && level != logLevelDebug {
+		return fmt.Errorf("unknown log_level %q, expected %s or %s", level, logLevelInfo, logLevelDebug)
+	}
+	if sampling < 0 {
+		return fmt.Errorf("log_sampling can't be negative")
+	}
+	return nil
+}
+
+// spanLogInterval returns every how many fetched spans one is logged, zero
+// when fetched spans and the span query aren't logged
+func spanLogInterval(cfg *Config) int {
+	if cfg.LogLevel != logLevelDebug {
+		return 0
+	}
+	return max(cfg.LogSampling, 1)
+}
@@ -0,0 +1,250 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// luaTransformer calls the transform(row, span) function defined by a Lua
+// script. row is a table of the pg_tracing columns, span a table with the
+// name, kind, attributes, status_code and status_message fields that the
+// function modifies in place. Returning false drops the span.
+//
+// A Lua state isn't safe for concurrent use, states are pooled for the
+// conversion workers.
+type luaTransformer struct {
+	path  string
+	proto *lua.FunctionProto
+	// timeout bounds each transform, the state being discarded when reached
+	timeout time.Duration
+	states  sync.Pool
+}
+
+// compileLuaScript parses and compiles the script at path
+func compileLuaScript(path string) (*lua.FunctionProto, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lua script: %w", err)
+	}
+	defer file.Close()
+	chunk, err := parse.Parse(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lua script %s: %w", path, err)
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile lua script %s: %w", path, err)
+	}
+	return proto, nil
+}
+
+func newLuaTransformer(path string) (*luaTransformer, error) {
+	proto, err := compileLuaScript(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &luaTransformer{path: path, proto: proto, timeout: scriptTimeout}
+	// Check that the script defines transform, and keep the state
+	L, err := t.newState()
+	if err != nil {
+		return nil, err
+	}
+	t.states.Put(L)
+	return t, nil
+}
+
+// newState runs the script in a new state. Scripts only get the base,
+// string, table and math libraries, without access to the file system or
+// the environment.
+func (t *luaTransformer) newState() (*lua.LState, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.Push(L.NewFunctionFromProto(t.proto))
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("failed to run lua script %s: %w", t.path, err)
+	}
+	if _, ok := L.GetGlobal("transform").(*lua.LFunction); !ok {
+		L.Close()
+		return nil, fmt.Errorf("lua script %s doesn't define a transform function", t.path)
+	}
+	return L, nil
+}
+
+func (t *luaTransformer) Transform(row Row, span *Span) bool {
+	keep, err := t.transform(row, span)
+	if err != nil {
+		// Spans are kept unchanged when the script fails
+		log.Printf("Failed to run lua script %s: %v", t.path, err)
+		return true
+	}
+	return keep
+}
+
+func (t *luaTransformer) transform(row Row, span *Span) (bool, error) {
+	L, ok := t.states.Get().(*lua.LState)
+	if !ok {
+		var err error
+		if L, err = t.newState(); err != nil {
+			return true, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	spanTable := newLuaSpan(L, span)
+	err := L.CallByParam(lua.P{Fn: L.GetGlobal("transform"), NRet: 1, Protect: true},
+		newLuaRow(L, row), spanTable)
+	L.RemoveContext()
+	if err != nil {
+		// The state may be left inconsistent
+		L.Close()
+		return true, fmt.Errorf("failed to transform span: %w", err)
+	}
+	ret := L.Get(-1)
+	L.Pop(1)
+	t.states.Put(L)
+	if ret == lua.LFalse {
+		return false, nil
+	}
+	applyLuaSpan(spanTable, span)
+	return true, nil
+}
+
+func newLuaRow(L *lua.LState, row Row) *lua.LTable {
+	t := L.CreateTable(0, 16)
+	// Ids are strings, Lua numbers being floats losing the precision of
+	// ids above 2^53
+	t.RawSetString("trace_id", lua.LString(traceIdOf(row.TraceId, row.TraceIdLow).String()))
+	t.RawSetString("parent_id", lua.LString(spanIdOf(row.ParentId).String()))
+	t.RawSetString("span_id", lua.LString(spanIdOf(row.SpanId).String()))
+	t.RawSetString("span_type", lua.LString(row.SpanType))
+	t.RawSetString("span_operation", lua.LString(row.SpanOperation))
+	t.RawSetString("deparse_info", lua.LString(row.DeparseInfo))
+	t.RawSetString("parameters", lua.LString(row.Parameters))
+	t.RawSetString("start_unix_nano", lua.LNumber(row.Start.UnixNano()))
+	t.RawSetString("end_unix_nano", lua.LNumber(row.End.UnixNano()))
+	t.RawSetString("pid", lua.LNumber(row.Pid))
+	t.RawSetString("subxact_count", lua.LNumber(row.SubxactCount))
+	t.RawSetString("sql_error_code", lua.LString(row.SqlErrorCode))
+	t.RawSetString("rows", lua.LNumber(row.Rows))
+	t.RawSetString("query_id", lua.LString(strconv.FormatInt(row.QueryId, 10)))
+	t.RawSetString("database_name", lua.LString(row.DatabaseName))
+	t.RawSetString("user_name", lua.LString(row.UserName))
+	return t
+}
+
+func newLuaSpan(L *lua.LState, span *Span) *lua.LTable {
+	attributes := L.CreateTable(0, len(span.Attributes))
+	for _, attr := range span.Attributes {
+		var value lua.LValue
+		switch attr.Value.Type() {
+		case attribute.BOOL:
+			value = lua.LBool(attr.Value.AsBool())
+		case attribute.INT64:
+			value = lua.LNumber(attr.Value.AsInt64())
+		case attribute.FLOAT64:
+			value = lua.LNumber(attr.Value.AsFloat64())
+		case attribute.STRINGSLICE:
+			items := L.CreateTable(len(attr.Value.AsStringSlice()), 0)
+			for _, item := range attr.Value.AsStringSlice() {
+				items.Append(lua.LString(item))
+			}
+			value = items
+		default:
+			value = lua.LString(attr.Value.Emit())
+		}
+		attributes.RawSetString(string(attr.Key), value)
+	}
+	t := L.CreateTable(0, 5)
+	t.RawSetString("name", lua.LString(span.Name))
+	t.RawSetString("kind", lua.LNumber(span.Kind))
+	t.RawSetString("attributes", attributes)
+	t.RawSetString("status_code", lua.LNumber(span.StatusCode))
+	t.RawSetString("status_message", lua.LString(span.StatusMessage))
+	return t
+}
+
+// applyLuaSpan sets the span from the script's span table. Attributes are
+// sorted by key, integral numbers are converted to integers.
+func applyLuaSpan(t *lua.LTable, span *Span) {
+	span.Name = lua.LVAsString(t.RawGetString("name"))
+	span.Kind = trace.SpanKind(lua.LVAsNumber(t.RawGetString("kind")))
+	span.StatusCode = codes.Code(lua.LVAsNumber(t.RawGetString("status_code")))
+	span.StatusMessage = lua.LVAsString(t.RawGetString("status_message"))
+	span.Attributes = span.Attributes[:0]
+	attributes, ok := t.RawGetString("attributes").(*lua.LTable)
+	if !ok {
+		return
+	}
+	var keys []string
+	attributes.ForEach(func(key, _ lua.LValue) {
+		if key, ok := key.(lua.LString); ok {
+			keys = append(keys, string(key))
+		}
+	})
+	sort.Strings(keys)
+	for _, key := range keys {
+		k := attribute.Key(key)
+		switch value := attributes.RawGetString(key).(type) {
+		case lua.LString:
+			span.Attributes = append(span.Attributes, k.String(string(value)))
+		case lua.LBool:
+			span.Attributes = append(span.Attributes, k.Bool(bool(value)))
+		case lua.LNumber:
+			if f := float64(value); f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+				span.Attributes = append(span.Attributes, k.Int64(int64(f)))
+			} else {
+				span.Attributes = append(span.Attributes, k.Float64(f))
+			}
+		case *lua.LTable:
+			strs := make([]string, 0, value.Len())
+			for i := 1; i <= value.Len(); i++ {
+				strs = append(strs, value.RawGetInt(i).String())
+			}
+			span.Attributes = append(span.Attributes, k.StringSlice(strs))
+		}
+	}
+}
+
+// luaSpanTransformers loads the Lua scripts at paths
+func luaSpanTransformers(paths []string) ([]SpanTransformer, error) {
+	var transformers []SpanTransformer
+	for _, path := range paths {
+		t, err := newLuaTransformer(path)
+		if err != nil {
+			return nil, err
+		}
+		transformers = append(transformers, t)
+	}
+	return transformers, nil
+}
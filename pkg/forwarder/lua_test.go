@@ -0,0 +1,66 @@
+package forwarder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLuaTransformer(t *testing.T, script string) *luaTransformer {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transform.lua")
+	if err := os.WriteFile(path, []byte(script), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	transformer, err := newLuaTransformer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transformer
+}
+
+func TestLuaRowIds(t *testing.T) {
+	transformer := newTestLuaTransformer(t, `
+function transform(row, span)
+  span.attributes["ids"] = row.trace_id .. " " .. row.parent_id .. " " .. row.span_id .. " " .. row.query_id
+  return true
+end`)
+	// Ids above 2^53 aren't representable by Lua numbers
+	row := Row{TraceId: 1<<62 + 1, TraceIdLow: 2, ParentId: 1<<62 + 3, SpanId: -1, QueryId: -1<<62 - 5}
+	span := &Span{}
+	if !transformer.Transform(row, span) {
+		t.Fatal("span dropped")
+	}
+	want := "40000000000000010000000000000002 4000000000000003 ffffffffffffffff -4611686018427387909"
+	if len(span.Attributes) != 1 || span.Attributes[0].Value.AsString() != want {
+		t.Fatalf("unexpected attributes %v, expected ids %s", span.Attributes, want)
+	}
+}
+
+func TestLuaTransformTimeout(t *testing.T) {
+	transformer := newTestLuaTransformer(t, `
+function transform(row, span)
+  if row.span_type == "loop" then
+    while true do end
+  end
+  span.name = "renamed"
+  return true
+end`)
+	transformer.timeout = 10 * time.Millisecond
+	span := &Span{Name: "select 1;"}
+	done := make(chan bool)
+	go func() { done <- transformer.Transform(Row{SpanType: "loop"}, span) }()
+	select {
+	case keep := <-done:
+		if !keep || span.Name != "select 1;" {
+			t.Fatalf("span wasn't kept unchanged: %+v", span)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transform wasn't interrupted")
+	}
+	// The next spans are transformed by a new state
+	if !transformer.Transform(Row{}, span) || span.Name != "renamed" {
+		t.Fatalf("span wasn't transformed after the timeout: %+v", span)
+	}
+}
@@ -0,0 +1,141 @@
+package forwarder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// malformedKey lists the malformed columns of a partially populated span
+const malformedKey = "pg_tracing.malformed"
+
+// idTarget scans an id column, either a bigint or hex digits, without
+// failing the whole fetch on a malformed value. A malformed or null trace or
+// span id drops the span, a malformed or null parent id makes it a root
+// span.
+type idTarget struct {
+	row    *spanRow
+	column string
+	dest   *int64
+	// low receives the low 64 bits of 128-bit trace ids, nil for span ids
+	low *int64
+}
+
+func (r *spanRow) idTarget(column string, dest *int64) *idTarget {
+	return &idTarget{row: r, column: column, dest: dest}
+}
+
+func (r *spanRow) traceIdTarget() *idTarget {
+	return &idTarget{row: r, column: "trace_id", dest: &r.traceId, low: &r.traceIdLow}
+}
+
+func (t *idTarget) Scan(src any) error {
+	var id, low int64
+	var err error
+	if t.low != nil {
+		id, low, err = scanTraceId(src)
+	} else {
+		id, err = parseId(src)
+	}
+	if err != nil {
+		id, low = 0, 0
+		t.row.malformed = append(t.row.malformed, t.column)
+	}
+	*t.dest = id
+	if t.low != nil {
+		*t.low = low
+	}
+	return nil
+}
+
+// parseId converts a scanned span id column to its 64-bit value
+func parseId(src any) (int64, error) {
+	switch v := src.(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case string:
+		return parseHexId(v)
+	case []byte:
+		return parseHexId(string(v))
+	case nil:
+		return 0, fmt.Errorf("id is null")
+	}
+	return 0, fmt.Errorf("unexpected id type %T", src)
+}
+
+// scanTraceId converts a scanned trace id column to the high and low 64
+// bits of its 128-bit value. Bigint ids and hex ids of up to 16 digits are
+// the high 64 bits, as pg_tracing's bigint ids have always been exported.
+// Hex ids of 17 to 32 digits, like the traceparent's, are kept whole.
+func scanTraceId(src any) (high, low int64, err error) {
+	var s string
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		high, err = parseId(src)
+		return high, 0, err
+	}
+	digits := hexDigits(s)
+	if len(digits) <= 16 {
+		high, err = parseHexId(s)
+		return high, 0, err
+	}
+	if len(digits) > 32 {
+		return 0, 0, fmt.Errorf("hex trace id %q has more than 32 digits", digits)
+	}
+	digits = strings.Repeat("0", 32-len(digits)) + digits
+	if high, err = parseHexId(digits[:16]); err != nil {
+		return 0, 0, err
+	}
+	if low, err = parseHexId(digits[16:]); err != nil {
+		return 0, 0, err
+	}
+	return high, low, nil
+}
+
+// hexDigits strips the 0x prefix and the dashes of uuids from a hex id
+func hexDigits(s string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(s, "-", ""), "0x")
+}
+
+func parseHexId(s string) (int64, error) {
+	s = hexDigits(s)
+	if len(s) == 0 || len(s) > 16 {
+		return 0, fmt.Errorf("hex id %q doesn't have 1 to 16 digits", s)
+	}
+	id, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hex id %q: %w", s, err)
+	}
+	return int64(id), nil
+}
+
+// hasInvalidId returns true if the span can't be exported, without trace or
+// span id
+func (r *spanRow) hasInvalidId() bool {
+	for _, column := range r.malformed {
+		if column == "trace_id" || column == "span_id" {
+			return true
+		}
+	}
+	return false
+}
+
+// dropMalformed drops the spans without valid trace or span id
+func (fw *targetForwarder) dropMalformed(spanRows []*spanRow) []*spanRow {
+	kept := spanRows[:0]
+	for _, r := range spanRows {
+		if r.hasInvalidId() {
+			fw.stats.spansMalformedDropped.Add(1)
+			fw.log.Printf("Dropping span with malformed %s: trace_id %d, span_id %d", strings.Join(r.malformed, ", "), r.traceId, r.spanId)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
@@ -0,0 +1,116 @@
+package forwarder
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestScanTraceId(t *testing.T) {
+	for _, tc := range []struct {
+		src       any
+		high, low int64
+		malformed bool
+	}{
+		{src: int64(42), high: 42},
+		{src: "2a", high: 42},
+		{src: "0x000000000000002a", high: 42},
+		{src: "4bf92f3577b34da6a3ce929d0e0e4736", high: 0x4bf92f3577b34da6, low: -0x5c316d62f1f1b8ca},
+		{src: []byte("4bf92f35-77b3-4da6-a3ce-929d0e0e4736"), high: 0x4bf92f3577b34da6, low: -0x5c316d62f1f1b8ca},
+		{src: "10000000000000000", high: 1},
+		{src: "4bf92f3577b34da6a3ce929d0e0e47360", malformed: true},
+		{src: "not an id", malformed: true},
+		{src: nil, malformed: true},
+	} {
+		var r spanRow
+		r.traceIdTarget().Scan(tc.src)
+		if malformed := len(r.malformed) > 0; malformed != tc.malformed {
+			t.Errorf("%v: malformed %v", tc.src, r.malformed)
+		}
+		if r.traceId != tc.high || r.traceIdLow != tc.low {
+			t.Errorf("%v: got %x %x, expected %x %x", tc.src, r.traceId, r.traceIdLow, tc.high, tc.low)
+		}
+	}
+}
+
+func FuzzParseId(f *testing.F) {
+	for _, seed := range []string{"2a", "0x2a", "ffffffffffffffff", "4bf92f3577b34da6a3ce929d0e0e4736",
+		"4bf92f35-77b3-4da6-a3ce-929d0e0e4736", "", "0x", "-", "g", "+1"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if id, err := parseId(s); err == nil {
+			digits := strings.ToLower(hexDigits(s))
+			if want := strings.TrimLeft(digits, "0"); fmt.Sprintf("%x", uint64(id)) != want && !(id == 0 && want == "") {
+				t.Fatalf("%q parsed as %x", s, uint64(id))
+			}
+		}
+		high, low, err := scanTraceId(s)
+		if err != nil {
+			return
+		}
+		digits := strings.ToLower(hexDigits(s))
+		if len(digits) <= 16 {
+			if low != 0 {
+				t.Fatalf("%q has low bits %x", s, uint64(low))
+			}
+			return
+		}
+		if got := fmt.Sprintf("%016x%016x", uint64(high), uint64(low)); got != strings.Repeat("0", 32-len(digits))+digits {
+			t.Fatalf("%q parsed as %s", s, got)
+		}
+	})
+}
+
+// FuzzScanConvert scans arbitrary id and parameter values, and converts the
+// kept spans
+func FuzzScanConvert(f *testing.F) {
+	writer := log.Writer()
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(writer) })
+	f.Add("1", "0", "2", "$1 = 'a', $2 = 1")
+	f.Add("4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", "a3ce929d0e0e4736", "")
+	f.Add("1", "not an id", "2", "$1 = 'unterminated")
+	f.Add("", "", "", "$1")
+	converter, err := NewConverter(*DefaultConfig())
+	if err != nil {
+		f.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Millisecond)
+	f.Fuzz(func(t *testing.T, traceId, parentId, spanId, parameters string) {
+		r := &spanRow{
+			spanType:      "Select query",
+			spanOperation: "select $1;",
+			parameters:    sql.NullString{String: parameters, Valid: true},
+			spanStart:     start,
+			spanEnd:       &end,
+		}
+		r.traceIdTarget().Scan(traceId)
+		r.idTarget("parent_id", &r.parentId).Scan(parentId)
+		r.idTarget("span_id", &r.spanId).Scan(spanId)
+		if r.hasInvalidId() {
+			return
+		}
+		data := converter.converter.convert(r, newSpanBatch([]*spanRow{r}))
+		if data == nil {
+			t.Fatal("span was dropped")
+		}
+		span := ptrace.NewSpan()
+		setSpan(span, r, data)
+		data.release()
+		if span.TraceID() != [16]byte(traceIdOf(r.traceId, r.traceIdLow)) {
+			t.Fatalf("unexpected trace id %s", span.TraceID())
+		}
+		_, tagged := span.Attributes().Get(malformedKey)
+		if malformed := len(r.malformed) > 0; malformed && !tagged {
+			t.Fatalf("malformed columns %v aren't tagged", r.malformed)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	meterName              = "pgtracing-forwarder"
+	metricExportLag        = "pg_tracing.forwarder.export_lag"
+	metricSpanTypeDuration = "pg_tracing.span.duration"
+)
+
+// exportLagBuckets are the boundaries, in seconds, of the export lag histogram
+var exportLagBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// spanTypeDurationBuckets are the boundaries, in seconds, of the span
+// duration histogram per span type
+var spanTypeDurationBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60}
+
+// metricsEnabled returns whether metrics are exported anywhere
+func metricsEnabled(cfg MetricsConfig) bool {
+	return cfg.Endpoint != "" || cfg.Prometheus
+}
+
+func bucketsView(name string, boundaries []float64) sdkmetric.View {
+	return sdkmetric.NewView(
+		sdkmetric.Instrument{Name: name},
+		sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{Boundaries: boundaries}},
+	)
+}
+
+// exemplarEnv enables the exemplars, an experimental feature of the metric
+// SDK. It's only read from the environment, left to the program embedding
+// the forwarder.
+const exemplarEnv = "OTEL_GO_X_EXEMPLAR"
+
+// initMeterProvider creates a MeterProvider exporting metrics to an OTLP
+// endpoint every cfg.Interval and, if enabled, to the Prometheus registerer
+func initMeterProvider(ctx context.Context, cfg MetricsConfig, collector CollectorConfig, res *resource.Resource, registerer prometheus.Registerer) (*sdkmetric.MeterProvider, error) {
+	if cfg.Exemplars && !strings.EqualFold(os.Getenv(exemplarEnv), "true") {
+		log.Printf("Exemplars require %s=true in the environment, metrics won't carry exemplars", exemplarEnv)
+	}
+	opts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(
+			bucketsView(metricExportLag, exportLagBuckets),
+			bucketsView(metricSpanDuration, spanDurationBuckets),
+			bucketsView(metricSpanTypeDuration, spanTypeDurationBuckets),
+		),
+	}
+	if cfg.Endpoint != "" {
+		conn, err := dialCollector(ctx, collector, cfg.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.Interval))))
+	}
+	if cfg.Prometheus {
+		exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registerer))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create prometheus exporter: %w", err)
+		}
+		opts = append(opts, sdkmetric.WithReader(exporter))
+	}
+	return sdkmetric.NewMeterProvider(opts...), nil
+}
+
+// forwarderMetrics holds the instruments recorded by the forwarder
+type forwarderMetrics struct {
+	exportLag        metric.Float64Histogram
+	spanTypeDuration metric.Float64Histogram
+	// spans is set when span metrics are enabled
+	spans *spanMetrics
+	// io is set when I/O metrics are enabled
+	io *ioMetrics
+	// exemplars records the measurements in the spans' context
+	exemplars bool
+}
+
+func newForwarderMetrics(meter metric.Meter, cfg MetricsConfig) (*forwarderMetrics, error) {
+	exportLag, err := meter.Float64Histogram(metricExportLag,
+		metric.WithUnit("s"),
+		metric.WithDescription("Delay between the end of a span and its hand off to the exporter"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export lag histogram: %w", err)
+	}
+	spanTypeDuration, err := meter.Float64Histogram(metricSpanTypeDuration,
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of consumed spans per span type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span duration histogram: %w", err)
+	}
+	m := &forwarderMetrics{exportLag: exportLag, spanTypeDuration: spanTypeDuration, exemplars: cfg.Exemplars}
+	if cfg.SpanMetrics {
+		if m.spans, err = newSpanMetrics(meter); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.IOMetrics {
+		if m.io, err = newIOMetrics(meter); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// record records the metrics of spans handed to the exporter at now. With
+// exemplars, the measurements are made in the span's context to be sampled
+// as exemplars.
+func (m *forwarderMetrics) record(ctx context.Context, rows []*spanRow, now time.Time) {
+	for _, r := range rows {
+		spanCtx := ctx
+		if m.exemplars {
+			spanCtx = trace.ContextWithSpanContext(ctx, spanContextOf(r))
+		}
+		m.exportLag.Record(spanCtx, now.Sub(r.endTime()).Seconds())
+		m.spanTypeDuration.Record(spanCtx, r.endTime().Sub(r.startTime()).Seconds(),
+			metric.WithAttributes(attribute.String("span.type", r.spanType)))
+		if m.spans != nil {
+			m.spans.record(spanCtx, r)
+		}
+		if m.io != nil {
+			m.io.record(spanCtx, r)
+		}
+	}
+}
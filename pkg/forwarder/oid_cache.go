@@ -0,0 +1,67 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Minimum delay between reloads triggered by unknown OIDs
+const oidCacheMissReloadDelay = time.Second
+
+// oidNameCache resolves catalog OIDs to names, reloading the whole mapping
+// from the catalog once the refresh interval elapsed. With reloadOnMiss, an
+// unknown OID also invalidates the cache.
+type oidNameCache struct {
+	query        string
+	refresh      time.Duration
+	reloadOnMiss bool
+	names        map[uint32]string
+	loadedAt     time.Time
+}
+
+func newOidNameCache(query string, refresh time.Duration, reloadOnMiss bool) *oidNameCache {
+	return &oidNameCache{query: query, refresh: refresh, reloadOnMiss: reloadOnMiss}
+}
+
+func (c *oidNameCache) load(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, c.query)
+	if err != nil {
+		return fmt.Errorf("failed to load names: %w", err)
+	}
+	defer rows.Close()
+	names := make(map[uint32]string)
+	for rows.Next() {
+		var oid uint32
+		var name string
+		if err := rows.Scan(&oid, &name); err != nil {
+			return fmt.Errorf("failed to scan names: %w", err)
+		}
+		names[oid] = name
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load names: %w", err)
+	}
+	c.names = names
+	c.loadedAt = time.Now()
+	return nil
+}
+
+// Lookup returns the name of the OID, or an empty string if unknown
+func (c *oidNameCache) Lookup(ctx context.Context, conn *pgx.Conn, oid uint32) (string, error) {
+	if c.names == nil || time.Since(c.loadedAt) >= c.refresh {
+		if err := c.load(ctx, conn); err != nil {
+			return "", err
+		}
+	}
+	name, ok := c.names[oid]
+	if !ok && c.reloadOnMiss && time.Since(c.loadedAt) >= oidCacheMissReloadDelay {
+		if err := c.load(ctx, conn); err != nil {
+			return "", err
+		}
+		name = c.names[oid]
+	}
+	return name, nil
+}
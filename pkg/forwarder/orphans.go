@@ -0,0 +1,99 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Orphan handling modes
+const (
+	orphanNone       = "none"
+	orphanTag        = "tag"
+	orphanSynthesize = "synthesize"
+)
+
+const (
+	orphanKey    = "otel.orphan"
+	syntheticKey = "otel.synthetic"
+)
+
+func validateOrphanMode(mode string) error {
+	switch mode {
+	case "", orphanNone, orphanTag, orphanSynthesize:
+		return nil
+	}
+	return fmt.Errorf("unknown orphan mode %q, expected one of: none, tag, synthesize", mode)
+}
+
+// isOrphan returns true if the span's parent should have been produced by
+// pg_tracing but is missing, usually because it was dropped on buffer
+// overflow. Top-level spans can have an application parent which is never
+// part of the batch.
+func (b *spanBatch) isOrphan(r *spanRow) bool {
+	return !isTopSpan(r.spanType) && b.hasRemoteParent(r)
+}
+
+// missingParent is a parent span referenced by orphans
+type missingParent struct {
+	traceId trace.TraceID
+	spanId  int64
+	start   time.Time
+	end     time.Time
+}
+
+// missingParents groups the batch's orphans by their missing parent
+func (b *spanBatch) missingParents() []*missingParent {
+	var parents []*missingParent
+	byId := make(map[int64]*missingParent)
+	for _, r := range b.rows {
+		if !b.isOrphan(r) {
+			continue
+		}
+		p, ok := byId[r.parentId]
+		if !ok {
+			p = &missingParent{traceId: r.traceID(), spanId: r.parentId, start: r.startTime(), end: r.endTime()}
+			byId[r.parentId] = p
+			parents = append(parents, p)
+		}
+		if r.startTime().Before(p.start) {
+			p.start = r.startTime()
+		}
+		if r.endTime().After(p.end) {
+			p.end = r.endTime()
+		}
+	}
+	return parents
+}
+
+// exportPlaceholder emits a synthetic root span standing for a missing parent,
+// covering the time range of its orphaned children
+func exportPlaceholder(ctx context.Context, tracer trace.Tracer, f *FixedIdGenerator, p *missingParent) {
+	f.FixedTraceID = p.traceId
+	f.FixedSpanID = spanIdOf(p.spanId)
+	_, span := tracer.Start(ctx, "Missing parent",
+		trace.WithNewRoot(),
+		trace.WithTimestamp(p.start),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.Bool(syntheticKey, true)),
+	)
+	span.End(trace.WithTimestamp(p.end))
+}
+
+// handleOrphans synthesizes placeholder parents if configured. Orphans are
+// then attached to them rather than looking like they have a remote parent.
+func (c *spanConverter) handleOrphans(ctx context.Context, tracer trace.Tracer, f *FixedIdGenerator, batch *spanBatch) {
+	if c.orphanMode != orphanSynthesize {
+		return
+	}
+	for _, p := range batch.missingParents() {
+		log.Printf("Span %016x is missing from trace %s, synthesizing a placeholder", uint64(p.spanId), p.traceId)
+		exportPlaceholder(ctx, tracer, f, p)
+		batch.spanIds[p.spanId] = true
+		batch.synthetic[p.spanId] = true
+	}
+}
@@ -0,0 +1,70 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func orphanRows() []*spanRow {
+	// The executor span 12 is missing, its child 13 is an orphan. The query's
+	// parent is the application's span.
+	return []*spanRow{
+		testRow(10, 99, "Select query", "select 1;", 0, 3*time.Millisecond).spanRow(),
+		testRow(11, 10, "Planner", "Planner", 100*time.Microsecond, 500*time.Microsecond).spanRow(),
+		testRow(13, 12, "SeqScan", "SeqScan on users", time.Millisecond, time.Millisecond).spanRow(),
+		testRow(14, 12, "Hash", "Hash", 1500*time.Microsecond, time.Millisecond).spanRow(),
+	}
+}
+
+func TestMissingParents(t *testing.T) {
+	rows := orphanRows()
+	batch := newSpanBatch(rows)
+	for _, r := range rows {
+		if orphan := batch.isOrphan(r); orphan != (r.parentId == 12) {
+			t.Errorf("span %d orphan: %v", r.spanId, orphan)
+		}
+	}
+	parents := batch.missingParents()
+	if len(parents) != 1 {
+		t.Fatalf("%d missing parents, expected 1", len(parents))
+	}
+	p := parents[0]
+	if p.spanId != 12 || p.traceId != rows[2].traceID() {
+		t.Fatalf("unexpected missing parent %+v", p)
+	}
+	// The placeholder covers its children
+	if !p.start.Equal(rows[2].startTime()) || !p.end.Equal(rows[3].endTime()) {
+		t.Fatalf("placeholder spans %s to %s", p.start, p.end)
+	}
+}
+
+func TestOrphanModes(t *testing.T) {
+	for _, tc := range []struct {
+		mode   string
+		tagged bool
+	}{
+		{"", false},
+		{orphanNone, false},
+		{orphanTag, true},
+	} {
+		cfg := DefaultConfig()
+		if tc.mode != "" {
+			cfg.Orphans = tc.mode
+		}
+		converter, err := newSpanConverter(cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows := orphanRows()
+		batch := newSpanBatch(rows)
+		for _, r := range rows {
+			data := converter.convert(r, batch)
+			tagged := findAttribute(data.attributes, attribute.Key(orphanKey)) >= 0
+			if want := tc.tagged && r.parentId == 12; tagged != want {
+				t.Errorf("mode %q: span %d tagged %v, expected %v", tc.mode, r.spanId, tagged, want)
+			}
+		}
+	}
+}
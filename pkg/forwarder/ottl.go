@@ -0,0 +1,1032 @@
+package forwarder
+
+// Minimal interpreter for a subset of OTTL statements operating on spans.
+//
+// Supported paths: name, attributes, attributes["key"], status.code and
+// status.message.
+// Supported functions: set, delete_key, delete_matching_keys, keep_keys,
+// replace_pattern, replace_all_patterns, truncate_all and limit.
+// Conditions support ==, !=, <, <=, >, >=, and, or, not, parentheses and the
+// IsMatch converter.
+// Function arguments are checked and literal patterns compiled when parsed.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// OTTL status code enums
+const (
+	ottlStatusUnset int64 = 0
+	ottlStatusOk    int64 = 1
+	ottlStatusError int64 = 2
+)
+
+var ottlEnums = map[string]int64{
+	"STATUS_CODE_UNSET": ottlStatusUnset,
+	"STATUS_CODE_OK":    ottlStatusOk,
+	"STATUS_CODE_ERROR": ottlStatusError,
+}
+
+// ---- Tokenizer
+
+type ottlTokenKind int
+
+const (
+	tokEOF ottlTokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type ottlToken struct {
+	kind  ottlTokenKind
+	value string
+}
+
+func tokenizeOttl(input string) ([]ottlToken, error) {
+	var tokens []ottlToken
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(input) && input[j] != '"'; j++ {
+				if input[j] == '\\' && j+1 < len(input) {
+					j++
+				}
+				sb.WriteByte(input[j])
+			}
+			if j >= len(input) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, ottlToken{tokString, sb.String()})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(input) && unicode.IsDigit(rune(input[i+1]))):
+			j := i + 1
+			for j < len(input) && (unicode.IsDigit(rune(input[j])) || input[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, ottlToken{tokNumber, input[i:j]})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(input) && (unicode.IsLetter(rune(input[j])) || unicode.IsDigit(rune(input[j])) || input[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, ottlToken{tokIdent, input[i:j]})
+			i = j
+		default:
+			if i+1 < len(input) {
+				two := input[i : i+2]
+				if two == "==" || two == "!=" || two == "<=" || two == ">=" {
+					tokens = append(tokens, ottlToken{tokPunct, two})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("()[],.<>", c) {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, ottlToken{tokPunct, string(c)})
+			i++
+		}
+	}
+	return append(tokens, ottlToken{kind: tokEOF}), nil
+}
+
+// ---- AST
+
+type ottlPath struct {
+	name string
+	key  *string
+}
+
+type ottlValue interface {
+	eval(span *spanData) (any, error)
+}
+
+type ottlLiteral struct{ value any }
+
+type ottlPathValue struct{ path ottlPath }
+
+// ottlPattern is a literal regular expression, compiled when parsed
+type ottlPattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+type ottlCall struct {
+	name string
+	args []ottlValue
+}
+
+type ottlCondition interface {
+	test(span *spanData) (bool, error)
+}
+
+type ottlComparison struct {
+	op          string
+	left, right ottlValue
+}
+
+type ottlBoolCall struct{ call *ottlCall }
+
+type ottlAnd struct{ left, right ottlCondition }
+
+type ottlOr struct{ left, right ottlCondition }
+
+type ottlNot struct{ cond ottlCondition }
+
+// OttlStatement is a parsed editor call with its optional where clause
+type OttlStatement struct {
+	source string
+	editor *ottlCall
+	where  ottlCondition
+}
+
+// ---- Parser
+
+type ottlParser struct {
+	tokens []ottlToken
+	pos    int
+}
+
+func (p *ottlParser) peek() ottlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *ottlParser) next() ottlToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *ottlParser) expect(punct string) error {
+	t := p.next()
+	if t.kind != tokPunct || t.value != punct {
+		return fmt.Errorf("expected %q, got %q", punct, t.value)
+	}
+	return nil
+}
+
+func (p *ottlParser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.value == punct
+}
+
+func (p *ottlParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.value == keyword
+}
+
+func parseOttlStatement(source string) (*OttlStatement, error) {
+	tokens, err := tokenizeOttl(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &ottlParser{tokens: tokens}
+	name := p.next()
+	if name.kind != tokIdent {
+		return nil, fmt.Errorf("expected function name, got %q", name.value)
+	}
+	editor, err := p.parseCall(name.value)
+	if err != nil {
+		return nil, err
+	}
+	signature, ok := ottlEditorSignatures[editor.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", editor.name)
+	}
+	if err := signature.check(editor); err != nil {
+		return nil, err
+	}
+	stmt := &OttlStatement{source: source, editor: editor}
+	if p.isKeyword("where") {
+		p.next()
+		stmt.where, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected token %q", t.value)
+	}
+	return stmt, nil
+}
+
+func (p *ottlParser) parseCall(name string) (*ottlCall, error) {
+	call := &ottlCall{name: name}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.isPunct(")") {
+		arg, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+func (p *ottlParser) parseValue() (ottlValue, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return ottlLiteral{t.value}, nil
+	case tokNumber:
+		if strings.Contains(t.value, ".") {
+			f, err := strconv.ParseFloat(t.value, 64)
+			if err != nil {
+				return nil, err
+			}
+			return ottlLiteral{f}, nil
+		}
+		i, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return ottlLiteral{i}, nil
+	case tokIdent:
+		switch t.value {
+		case "true":
+			return ottlLiteral{true}, nil
+		case "false":
+			return ottlLiteral{false}, nil
+		case "nil":
+			return ottlLiteral{nil}, nil
+		}
+		if enum, ok := ottlEnums[t.value]; ok {
+			return ottlLiteral{enum}, nil
+		}
+		if p.isPunct("(") {
+			return p.parseConverter(t.value)
+		}
+		return p.parsePath(t.value)
+	}
+	return nil, fmt.Errorf("unexpected token %q", t.value)
+}
+
+func (p *ottlParser) parseConverter(name string) (*ottlCall, error) {
+	call, err := p.parseCall(name)
+	if err != nil {
+		return nil, err
+	}
+	signature, ok := ottlConverterSignatures[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown converter %q", name)
+	}
+	return call, signature.check(call)
+}
+
+func (p *ottlParser) parsePath(first string) (ottlValue, error) {
+	path := ottlPath{name: first}
+	for p.isPunct(".") {
+		p.next()
+		t := p.next()
+		if t.kind != tokIdent {
+			return nil, fmt.Errorf("expected path segment, got %q", t.value)
+		}
+		path.name += "." + t.value
+	}
+	if p.isPunct("[") {
+		p.next()
+		t := p.next()
+		if t.kind != tokString {
+			return nil, fmt.Errorf("expected string key, got %q", t.value)
+		}
+		key := t.value
+		path.key = &key
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case path.name == "attributes":
+	case path.key != nil:
+		return nil, fmt.Errorf("path %s doesn't accept a key", path.name)
+	case path.name == "name", path.name == "status.code", path.name == "status.message":
+	default:
+		return nil, fmt.Errorf("unknown path %s", path.name)
+	}
+	return ottlPathValue{path}, nil
+}
+
+func (p *ottlParser) parseOr() (ottlCondition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = ottlOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *ottlParser) parseAnd() (ottlCondition, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = ottlAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *ottlParser) parseTerm() (ottlCondition, error) {
+	if p.isKeyword("not") {
+		p.next()
+		cond, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return ottlNot{cond}, nil
+	}
+	if p.isPunct("(") {
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+	left, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind == tokPunct && ottlOperators[t.value] {
+		p.next()
+		right, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return ottlComparison{t.value, left, right}, nil
+	}
+	if call, ok := left.(*ottlCall); ok {
+		return ottlBoolCall{call}, nil
+	}
+	return nil, fmt.Errorf("expected comparison operator, got %q", t.value)
+}
+
+var ottlOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// ---- Signatures
+
+type ottlArgKind int
+
+const (
+	argNone ottlArgKind = iota
+	argAny
+	argPath
+	argAttributes
+	argString
+	argInt
+	// argPattern is a string compiled as a regular expression
+	argPattern
+)
+
+// ottlSignature describes a function's arguments, checked when parsed
+type ottlSignature struct {
+	args []ottlArgKind
+	// variadic is the kind of the arguments following args, if accepted
+	variadic ottlArgKind
+	// validate runs additional checks on the call
+	validate func(call *ottlCall) error
+}
+
+var ottlEditorSignatures = map[string]ottlSignature{
+	"set":                  {args: []ottlArgKind{argPath, argAny}, validate: checkSet},
+	"delete_key":           {args: []ottlArgKind{argAttributes, argString}},
+	"delete_matching_keys": {args: []ottlArgKind{argAttributes, argPattern}},
+	"keep_keys":            {args: []ottlArgKind{argAttributes}, variadic: argString},
+	"replace_pattern":      {args: []ottlArgKind{argPath, argPattern, argString}},
+	"replace_all_patterns": {args: []ottlArgKind{argAttributes, argString, argPattern, argString}, validate: checkReplaceMode},
+	"truncate_all":         {args: []ottlArgKind{argAttributes, argInt}},
+	"limit":                {args: []ottlArgKind{argAttributes, argInt}, variadic: argString},
+}
+
+var ottlConverterSignatures = map[string]ottlSignature{
+	"IsMatch": {args: []ottlArgKind{argAny, argPattern}},
+}
+
+// check validates the call's arguments, compiling its literal patterns
+func (s ottlSignature) check(call *ottlCall) error {
+	if len(call.args) < len(s.args) || (s.variadic == argNone && len(call.args) > len(s.args)) {
+		return fmt.Errorf("%s expects %d arguments, got %d", call.name, len(s.args), len(call.args))
+	}
+	for i, arg := range call.args {
+		kind := s.variadic
+		if i < len(s.args) {
+			kind = s.args[i]
+		}
+		checked, err := checkArg(call, i, kind, arg)
+		if err != nil {
+			return err
+		}
+		call.args[i] = checked
+	}
+	if s.validate != nil {
+		return s.validate(call)
+	}
+	return nil
+}
+
+func checkArg(call *ottlCall, i int, kind ottlArgKind, arg ottlValue) (ottlValue, error) {
+	switch kind {
+	case argPath:
+		if _, ok := arg.(ottlPathValue); !ok {
+			return nil, fmt.Errorf("%s: argument %d must be a path", call.name, i)
+		}
+	case argAttributes:
+		if v, ok := arg.(ottlPathValue); !ok || v.path.name != "attributes" || v.path.key != nil {
+			return nil, fmt.Errorf("%s: argument %d must be attributes", call.name, i)
+		}
+	case argString, argPattern:
+		literal, ok := arg.(ottlLiteral)
+		if !ok {
+			// Paths and converters are checked when executed
+			return arg, nil
+		}
+		s, ok := literal.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: argument %d must be a string", call.name, i)
+		}
+		if kind == argPattern {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern %q: %w", call.name, s, err)
+			}
+			return ottlPattern{source: s, re: re}, nil
+		}
+	case argInt:
+		if literal, ok := arg.(ottlLiteral); ok {
+			if _, ok := literal.value.(int64); !ok {
+				return nil, fmt.Errorf("%s: argument %d must be an integer", call.name, i)
+			}
+		}
+	}
+	return arg, nil
+}
+
+// checkSet rejects literal values of the wrong type for the path
+func checkSet(call *ottlCall) error {
+	literal, ok := call.args[1].(ottlLiteral)
+	if !ok {
+		return nil
+	}
+	path := call.args[0].(ottlPathValue).path
+	if err := setPath(&spanData{}, path, literal.value); err != nil {
+		return fmt.Errorf("set: %w", err)
+	}
+	return nil
+}
+
+func checkReplaceMode(call *ottlCall) error {
+	literal, ok := call.args[1].(ottlLiteral)
+	if ok && literal.value != "key" && literal.value != "value" {
+		return fmt.Errorf("replace_all_patterns: mode must be key or value")
+	}
+	return nil
+}
+
+// ---- Evaluation
+
+func (l ottlLiteral) eval(span *spanData) (any, error) {
+	return l.value, nil
+}
+
+func (p ottlPattern) eval(span *spanData) (any, error) {
+	return p.source, nil
+}
+
+func (v ottlPathValue) eval(span *spanData) (any, error) {
+	switch v.path.name {
+	case "name":
+		return span.name, nil
+	case "status.code":
+		switch span.statusCode {
+		case codes.Ok:
+			return ottlStatusOk, nil
+		case codes.Error:
+			return ottlStatusError, nil
+		}
+		return ottlStatusUnset, nil
+	case "status.message":
+		return span.statusMessage, nil
+	case "attributes":
+		if v.path.key == nil {
+			return span.attributes, nil
+		}
+		idx := findAttribute(span.attributes, attribute.Key(*v.path.key))
+		if idx < 0 {
+			return nil, nil
+		}
+		return span.attributes[idx].Value.AsInterface(), nil
+	}
+	return nil, fmt.Errorf("unknown path %s", v.path.name)
+}
+
+func (c *ottlCall) eval(span *spanData) (any, error) {
+	converter, ok := ottlConverters[c.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown converter %q", c.name)
+	}
+	return converter(span, c)
+}
+
+func (c ottlComparison) test(span *spanData) (bool, error) {
+	left, err := c.left.eval(span)
+	if err != nil {
+		return false, err
+	}
+	right, err := c.right.eval(span)
+	if err != nil {
+		return false, err
+	}
+	switch c.op {
+	case "==":
+		return ottlEqual(left, right), nil
+	case "!=":
+		return !ottlEqual(left, right), nil
+	}
+	cmp, ok := ottlCompare(left, right)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %s", c.op)
+}
+
+func (c ottlBoolCall) test(span *spanData) (bool, error) {
+	res, err := c.call.eval(span)
+	if err != nil {
+		return false, err
+	}
+	b, _ := res.(bool)
+	return b, nil
+}
+
+func (c ottlAnd) test(span *spanData) (bool, error) {
+	left, err := c.left.test(span)
+	if err != nil || !left {
+		return false, err
+	}
+	return c.right.test(span)
+}
+
+func (c ottlOr) test(span *spanData) (bool, error) {
+	left, err := c.left.test(span)
+	if err != nil || left {
+		return left, err
+	}
+	return c.right.test(span)
+}
+
+func (c ottlNot) test(span *spanData) (bool, error) {
+	res, err := c.cond.test(span)
+	return !res, err
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func ottlEqual(left, right any) bool {
+	if l, ok := toFloat(left); ok {
+		r, ok := toFloat(right)
+		return ok && l == r
+	}
+	return left == right
+}
+
+func ottlCompare(left, right any) (int, bool) {
+	if l, ok := toFloat(left); ok {
+		r, ok := toFloat(right)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case l < r:
+			return -1, true
+		case l > r:
+			return 1, true
+		}
+		return 0, true
+	}
+	l, lok := left.(string)
+	r, rok := right.(string)
+	if !lok || !rok {
+		return 0, false
+	}
+	return strings.Compare(l, r), true
+}
+
+// ---- Functions
+
+var ottlConverters = map[string]func(span *spanData, call *ottlCall) (any, error){
+	"IsMatch": func(span *spanData, call *ottlCall) (any, error) {
+		re, err := patternArg(span, call, 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := call.args[0].eval(span)
+		if err != nil || v == nil {
+			return false, err
+		}
+		return re.MatchString(fmt.Sprint(v)), nil
+	},
+}
+
+type ottlEditor func(span *spanData, call *ottlCall) error
+
+var ottlEditors = map[string]ottlEditor{
+	"set":                  ottlSet,
+	"delete_key":           ottlDeleteKey,
+	"delete_matching_keys": ottlDeleteMatchingKeys,
+	"keep_keys":            ottlKeepKeys,
+	"replace_pattern":      ottlReplacePattern,
+	"replace_all_patterns": ottlReplaceAllPatterns,
+	"truncate_all":         ottlTruncateAll,
+	"limit":                ottlLimit,
+}
+
+func pathArg(call *ottlCall, i int) (ottlPath, error) {
+	if i >= len(call.args) {
+		return ottlPath{}, fmt.Errorf("%s: missing argument %d", call.name, i)
+	}
+	v, ok := call.args[i].(ottlPathValue)
+	if !ok {
+		return ottlPath{}, fmt.Errorf("%s: argument %d must be a path", call.name, i)
+	}
+	return v.path, nil
+}
+
+func attributesArg(call *ottlCall, i int) error {
+	path, err := pathArg(call, i)
+	if err != nil {
+		return err
+	}
+	if path.name != "attributes" || path.key != nil {
+		return fmt.Errorf("%s: argument %d must be attributes", call.name, i)
+	}
+	return nil
+}
+
+func stringArg(span *spanData, call *ottlCall, i int) (string, error) {
+	if i >= len(call.args) {
+		return "", fmt.Errorf("%s: missing argument %d", call.name, i)
+	}
+	v, err := call.args[i].eval(span)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: argument %d must be a string", call.name, i)
+	}
+	return s, nil
+}
+
+// patternArg returns the pattern compiled when parsed, compiling the
+// patterns read from the span
+func patternArg(span *spanData, call *ottlCall, i int) (*regexp.Regexp, error) {
+	if i < len(call.args) {
+		if p, ok := call.args[i].(ottlPattern); ok {
+			return p.re, nil
+		}
+	}
+	pattern, err := stringArg(span, call, i)
+	if err != nil {
+		return nil, err
+	}
+	return regexp.Compile(pattern)
+}
+
+func intArg(span *spanData, call *ottlCall, i int) (int64, error) {
+	if i >= len(call.args) {
+		return 0, fmt.Errorf("%s: missing argument %d", call.name, i)
+	}
+	v, err := call.args[i].eval(span)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%s: argument %d must be an integer", call.name, i)
+	}
+	return n, nil
+}
+
+func toAttributeValue(key attribute.Key, v any) (attribute.KeyValue, error) {
+	switch value := v.(type) {
+	case string:
+		return key.String(value), nil
+	case int64:
+		return key.Int64(value), nil
+	case float64:
+		return key.Float64(value), nil
+	case bool:
+		return key.Bool(value), nil
+	}
+	return attribute.KeyValue{}, fmt.Errorf("unsupported attribute value %v", v)
+}
+
+func setPath(span *spanData, path ottlPath, v any) error {
+	switch path.name {
+	case "name":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("name must be a string")
+		}
+		span.name = s
+	case "status.code":
+		code, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("status.code must be a status code")
+		}
+		switch code {
+		case ottlStatusOk:
+			span.statusCode = codes.Ok
+		case ottlStatusError:
+			span.statusCode = codes.Error
+		default:
+			span.statusCode = codes.Unset
+		}
+	case "status.message":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("status.message must be a string")
+		}
+		span.statusMessage = s
+	case "attributes":
+		if path.key == nil {
+			return fmt.Errorf("can't set the whole attributes map")
+		}
+		key := attribute.Key(*path.key)
+		idx := findAttribute(span.attributes, key)
+		if v == nil {
+			if idx >= 0 {
+				span.attributes = append(span.attributes[:idx], span.attributes[idx+1:]...)
+			}
+			return nil
+		}
+		kv, err := toAttributeValue(key, v)
+		if err != nil {
+			return err
+		}
+		if idx >= 0 {
+			span.attributes[idx] = kv
+		} else {
+			span.attributes = append(span.attributes, kv)
+		}
+	}
+	return nil
+}
+
+func ottlSet(span *spanData, call *ottlCall) error {
+	if len(call.args) != 2 {
+		return fmt.Errorf("set expects 2 arguments")
+	}
+	path, err := pathArg(call, 0)
+	if err != nil {
+		return err
+	}
+	v, err := call.args[1].eval(span)
+	if err != nil {
+		return err
+	}
+	return setPath(span, path, v)
+}
+
+func filterAttributes(span *spanData, keep func(attribute.KeyValue) bool) {
+	res := span.attributes[:0]
+	for _, attr := range span.attributes {
+		if keep(attr) {
+			res = append(res, attr)
+		}
+	}
+	span.attributes = res
+}
+
+func ottlDeleteKey(span *spanData, call *ottlCall) error {
+	if err := attributesArg(call, 0); err != nil {
+		return err
+	}
+	key, err := stringArg(span, call, 1)
+	if err != nil {
+		return err
+	}
+	filterAttributes(span, func(attr attribute.KeyValue) bool { return string(attr.Key) != key })
+	return nil
+}
+
+func ottlDeleteMatchingKeys(span *spanData, call *ottlCall) error {
+	if err := attributesArg(call, 0); err != nil {
+		return err
+	}
+	re, err := patternArg(span, call, 1)
+	if err != nil {
+		return err
+	}
+	filterAttributes(span, func(attr attribute.KeyValue) bool { return !re.MatchString(string(attr.Key)) })
+	return nil
+}
+
+func ottlKeepKeys(span *spanData, call *ottlCall) error {
+	if err := attributesArg(call, 0); err != nil {
+		return err
+	}
+	keys := make(map[string]bool)
+	for i := 1; i < len(call.args); i++ {
+		key, err := stringArg(span, call, i)
+		if err != nil {
+			return err
+		}
+		keys[key] = true
+	}
+	filterAttributes(span, func(attr attribute.KeyValue) bool { return keys[string(attr.Key)] })
+	return nil
+}
+
+func ottlReplacePattern(span *spanData, call *ottlCall) error {
+	path, err := pathArg(call, 0)
+	if err != nil {
+		return err
+	}
+	re, err := patternArg(span, call, 1)
+	if err != nil {
+		return err
+	}
+	replacement, err := stringArg(span, call, 2)
+	if err != nil {
+		return err
+	}
+	v, err := ottlPathValue{path}.eval(span)
+	if err != nil {
+		return err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	return setPath(span, path, re.ReplaceAllString(s, replacement))
+}
+
+func ottlReplaceAllPatterns(span *spanData, call *ottlCall) error {
+	if err := attributesArg(call, 0); err != nil {
+		return err
+	}
+	mode, err := stringArg(span, call, 1)
+	if err != nil {
+		return err
+	}
+	re, err := patternArg(span, call, 2)
+	if err != nil {
+		return err
+	}
+	replacement, err := stringArg(span, call, 3)
+	if err != nil {
+		return err
+	}
+	for i, attr := range span.attributes {
+		switch mode {
+		case "key":
+			span.attributes[i] = attribute.KeyValue{
+				Key:   attribute.Key(re.ReplaceAllString(string(attr.Key), replacement)),
+				Value: attr.Value,
+			}
+		case "value":
+			if attr.Value.Type() == attribute.STRING {
+				span.attributes[i] = attr.Key.String(re.ReplaceAllString(attr.Value.AsString(), replacement))
+			}
+		default:
+			return fmt.Errorf("replace_all_patterns: mode must be key or value")
+		}
+	}
+	return nil
+}
+
+func ottlTruncateAll(span *spanData, call *ottlCall) error {
+	if err := attributesArg(call, 0); err != nil {
+		return err
+	}
+	limit, err := intArg(span, call, 1)
+	if err != nil || limit < 0 {
+		return err
+	}
+	for i, attr := range span.attributes {
+		if attr.Value.Type() != attribute.STRING {
+			continue
+		}
+		s := attr.Value.AsString()
+		if int64(len(s)) <= limit {
+			continue
+		}
+		cut := int(limit)
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		span.attributes[i] = attr.Key.String(s[:cut])
+	}
+	return nil
+}
+
+func ottlLimit(span *spanData, call *ottlCall) error {
+	if err := attributesArg(call, 0); err != nil {
+		return err
+	}
+	limit, err := intArg(span, call, 1)
+	if err != nil {
+		return err
+	}
+	priority := make(map[string]bool)
+	for i := 2; i < len(call.args); i++ {
+		key, err := stringArg(span, call, i)
+		if err != nil {
+			return err
+		}
+		priority[key] = true
+	}
+	if limit < 0 || int64(len(span.attributes)) <= limit {
+		return nil
+	}
+	sort.SliceStable(span.attributes, func(i, j int) bool {
+		return priority[string(span.attributes[i].Key)] && !priority[string(span.attributes[j].Key)]
+	})
+	span.attributes = span.attributes[:limit]
+	return nil
+}
+
+func newOttlStatements(statements []string) ([]*OttlStatement, error) {
+	res := make([]*OttlStatement, 0, len(statements))
+	for _, source := range statements {
+		stmt, err := parseOttlStatement(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statement %q: %w", source, err)
+		}
+		res = append(res, stmt)
+	}
+	return res, nil
+}
+
+// Execute runs the statement on the span if its where clause matches
+func (s *OttlStatement) Execute(span *spanData) error {
+	if s.where != nil {
+		match, err := s.where.test(span)
+		if err != nil || !match {
+			return err
+		}
+	}
+	return ottlEditors[s.editor.name](span, s.editor)
+}
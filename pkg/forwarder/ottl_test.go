@@ -0,0 +1,158 @@
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestParseOttlStatement(t *testing.T) {
+	for _, tc := range []struct {
+		source string
+		ok     bool
+	}{
+		{`set(name, "query")`, true},
+		{`set(attributes["env"], 1) where name == "query"`, true},
+		{`set(status.code, STATUS_CODE_ERROR) where IsMatch(name, "^Select")`, true},
+		{`keep_keys(attributes, "a", "b")`, true},
+		{`limit(attributes, 10, "db.statement")`, true},
+		{`replace_all_patterns(attributes, "value", "[0-9]+", "?")`, true},
+		{`set(name, 1)`, false},
+		{`set(status.message, attributes["pid"])`, true},
+		{`set(attributes, "a")`, false},
+		{`set(name)`, false},
+		{`unknown(name)`, false},
+		{`set(name, Unknown(name))`, false},
+		{`delete_key(name, "a")`, false},
+		{`delete_key(attributes, "a", "b")`, false},
+		{`delete_matching_keys(attributes, "[")`, false},
+		{`replace_pattern(name, "(", "?")`, false},
+		{`replace_all_patterns(attributes, "both", "a", "b")`, false},
+		{`truncate_all(attributes, "10")`, false},
+		{`set(name, "a") where IsMatch(name, "[")`, false},
+		{`set(name, "a") where IsMatch(name)`, false},
+		{`set(name, "a") where name`, false},
+	} {
+		_, err := parseOttlStatement(tc.source)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected error %v", tc.source, err)
+		}
+	}
+}
+
+func TestOttlExecute(t *testing.T) {
+	for _, tc := range []struct {
+		source     string
+		attributes []attribute.KeyValue
+		want       spanData
+		ok         bool
+	}{
+		{
+			source:     `set(name, "renamed") where attributes["pid"] > 10`,
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 42)},
+			want:       spanData{name: "renamed", attributes: []attribute.KeyValue{attribute.Int64("pid", 42)}},
+			ok:         true,
+		},
+		{
+			source:     `set(name, "renamed") where attributes["pid"] > 100 or not IsMatch(name, "^Select")`,
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 42)},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.Int64("pid", 42)}},
+			ok:         true,
+		},
+		{
+			source: `set(status.code, STATUS_CODE_ERROR)`,
+			want:   spanData{name: "Select", statusCode: codes.Error},
+			ok:     true,
+		},
+		{
+			source:     `set(attributes["a"], nil)`,
+			attributes: []attribute.KeyValue{attribute.String("a", "1"), attribute.String("b", "2")},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.String("b", "2")}},
+			ok:         true,
+		},
+		{
+			source:     `delete_matching_keys(attributes, "^db\\.")`,
+			attributes: []attribute.KeyValue{attribute.String("db.name", "postgres"), attribute.Int64("pid", 1)},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.Int64("pid", 1)}},
+			ok:         true,
+		},
+		{
+			source:     `keep_keys(attributes, "pid")`,
+			attributes: []attribute.KeyValue{attribute.String("db.name", "postgres"), attribute.Int64("pid", 1)},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.Int64("pid", 1)}},
+			ok:         true,
+		},
+		{
+			source: `replace_pattern(name, "^Sel", "Del")`,
+			want:   spanData{name: "Delect"},
+			ok:     true,
+		},
+		{
+			source:     `replace_all_patterns(attributes, "key", "^db\\.", "pg.")`,
+			attributes: []attribute.KeyValue{attribute.String("db.name", "postgres")},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.String("pg.name", "postgres")}},
+			ok:         true,
+		},
+		{
+			source:     `truncate_all(attributes, 3)`,
+			attributes: []attribute.KeyValue{attribute.String("db.name", "postgres"), attribute.Int64("pid", 12345)},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.String("db.name", "pos"), attribute.Int64("pid", 12345)}},
+			ok:         true,
+		},
+		{
+			source:     `limit(attributes, 1, "pid")`,
+			attributes: []attribute.KeyValue{attribute.String("db.name", "postgres"), attribute.Int64("pid", 1)},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.Int64("pid", 1)}},
+			ok:         true,
+		},
+		{
+			// Type errors of values read from the span are only detected
+			// when executed
+			source:     `set(name, attributes["pid"])`,
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 1)},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.Int64("pid", 1)}},
+		},
+		{
+			source:     `delete_matching_keys(attributes, attributes["pattern"])`,
+			attributes: []attribute.KeyValue{attribute.String("pattern", "(")},
+			want:       spanData{name: "Select", attributes: []attribute.KeyValue{attribute.String("pattern", "(")}},
+		},
+	} {
+		stmt, err := parseOttlStatement(tc.source)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.source, err)
+		}
+		span := &spanData{name: "Select", attributes: tc.attributes}
+		err = stmt.Execute(span)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected error %v", tc.source, err)
+		}
+		if !reflect.DeepEqual(*span, tc.want) {
+			t.Errorf("%s: got %+v, expected %+v", tc.source, *span, tc.want)
+		}
+	}
+}
+
+func TestConvertCountsStatementErrors(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Transform.Statements = []string{`set(name, attributes["pid"])`}
+	converter, err := newSpanConverter(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converter.stats = &forwarderStats{}
+	row := testRow(10, 0, "Select query", "select 1;", 0, time.Millisecond).spanRow()
+	data := converter.convert(row, newSpanBatch([]*spanRow{row}))
+	if data == nil {
+		t.Fatal("span dropped")
+	}
+	if data.name != "select 1;" {
+		t.Errorf("span renamed to %q by the failed statement", data.name)
+	}
+	if got := converter.stats.statementsFailed.Load(); got != 1 {
+		t.Errorf("%d failed statements counted, expected 1", got)
+	}
+}
@@ -0,0 +1,88 @@
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const parameterKeyPrefix = "db.query.parameter."
+
+// parseParameters splits pg_tracing's parameters column, formatted like
+// "$1 = 'a', $2 = 'b'", into (name, value) pairs. Quotes doubled inside a
+// value are unescaped.
+func parseParameters(s string) ([][2]string, error) {
+	var params [][2]string
+	for i := 0; i < len(s); {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] != '$' {
+			return params, fmt.Errorf("expected parameter name at offset %d", i)
+		}
+		start := i
+		i++
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		name := s[start:i]
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) || s[i] != '=' {
+			return params, fmt.Errorf("expected '=' after %s", name)
+		}
+		i++
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+
+		var value strings.Builder
+		if i < len(s) && s[i] == '\'' {
+			i++
+			for {
+				if i >= len(s) {
+					return params, fmt.Errorf("unterminated value for %s", name)
+				}
+				if s[i] == '\'' {
+					if i+1 < len(s) && s[i+1] == '\'' {
+						value.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				value.WriteByte(s[i])
+				i++
+			}
+		} else {
+			// Unquoted value like NULL
+			end := strings.IndexByte(s[i:], ',')
+			if end < 0 {
+				end = len(s) - i
+			}
+			value.WriteString(strings.TrimSpace(s[i : i+end]))
+			i += end
+		}
+		params = append(params, [2]string{name, value.String()})
+	}
+	return params, nil
+}
+
+// parameterAttributes converts the parameters column to db.query.parameter.$N
+// attributes. What could be parsed is kept when the column is malformed,
+// returning false.
+func parameterAttributes(attributes []attribute.KeyValue, parameters string) ([]attribute.KeyValue, bool) {
+	// The values aren't logged: they may hold the data redacted downstream.
+	// Malformed columns are tagged and counted by the caller.
+	params, err := parseParameters(parameters)
+	for _, param := range params {
+		attributes = append(attributes, attribute.String(parameterKeyPrefix+param[0], param[1]))
+	}
+	return attributes, err == nil
+}
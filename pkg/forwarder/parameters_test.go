@@ -0,0 +1,52 @@
+package forwarder
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestParseParameters(t *testing.T) {
+	for _, tc := range []struct {
+		s      string
+		params [][2]string
+		ok     bool
+	}{
+		{s: "", ok: true},
+		{s: "$1 = 'a', $2 = 'b'", params: [][2]string{{"$1", "a"}, {"$2", "b"}}, ok: true},
+		{s: "$1 = 'it''s', $2 = NULL", params: [][2]string{{"$1", "it's"}, {"$2", "NULL"}}, ok: true},
+		{s: "$1 = 'a, b'", params: [][2]string{{"$1", "a, b"}}, ok: true},
+		{s: "$1 = 'a', oops", params: [][2]string{{"$1", "a"}}},
+		{s: "$1 'a'"},
+	} {
+		params, err := parseParameters(tc.s)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q: unexpected error %v", tc.s, err)
+		}
+		if !reflect.DeepEqual(params, tc.params) {
+			t.Errorf("%q parsed as %v, expected %v", tc.s, params, tc.params)
+		}
+	}
+}
+
+func TestParameterAttributesMalformed(t *testing.T) {
+	var logged bytes.Buffer
+	writer := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(writer) })
+
+	attributes, ok := parameterAttributes(nil, "$1 = 'secret', $2 = 'unterminated")
+	if ok {
+		t.Fatal("malformed parameters accepted")
+	}
+	want := []attribute.KeyValue{attribute.String("db.query.parameter.$1", "secret")}
+	if !reflect.DeepEqual(attributes, want) {
+		t.Fatalf("unexpected attributes %v", attributes)
+	}
+	if logged.Len() > 0 {
+		t.Fatalf("parameters logged: %q", logged.String())
+	}
+}
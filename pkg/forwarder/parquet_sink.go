@@ -0,0 +1,239 @@
+package forwarder
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const defaultParquetMaxRows = 100000
+
+// parquetSpan is the schema of the Parquet files, one row per pg_tracing span.
+// duration and startup are in nanoseconds, block and JIT times in
+// milliseconds as reported by pg_tracing.
+type parquetSpan struct {
+	// TraceIdLow holds the low 64 bits of 128-bit trace ids
+	TraceId    int64 `parquet:"trace_id"`
+	TraceIdLow int64 `parquet:"trace_id_low"`
+	ParentId   int64 `parquet:"parent_id"`
+	SpanId     int64 `parquet:"span_id"`
+
+	SpanType      string    `parquet:"span_type"`
+	SpanOperation string    `parquet:"span_operation"`
+	DeparseInfo   *string   `parquet:"deparse_info"`
+	Parameters    *string   `parquet:"parameters"`
+	SpanStart     time.Time `parquet:"span_start,timestamp(microsecond)"`
+	SpanEnd       time.Time `parquet:"span_end,timestamp(microsecond)"`
+	Duration      int64     `parquet:"duration"`
+
+	Startup      *int64  `parquet:"startup"`
+	Pid          int32   `parquet:"pid"`
+	SubxactCount int32   `parquet:"subxact_count"`
+	SqlErrorCode string  `parquet:"sql_error_code"`
+	Rows         *int64  `parquet:"rows"`
+	QueryId      *int64  `parquet:"query_id"`
+	Database     *string `parquet:"database"`
+	User         *string `parquet:"user"`
+
+	PlanStartupCost *float64 `parquet:"plan_startup_cost"`
+	PlanTotalCost   *float64 `parquet:"plan_total_cost"`
+	PlanRows        *float64 `parquet:"plan_rows"`
+	PlanWidth       *int64   `parquet:"plan_width"`
+
+	SharedBlksHit     *int64   `parquet:"shared_blks_hit"`
+	SharedBlksRead    *int64   `parquet:"shared_blks_read"`
+	SharedBlksDirtied *int64   `parquet:"shared_blks_dirtied"`
+	SharedBlksWritten *int64   `parquet:"shared_blks_written"`
+	LocalBlksHit      *int64   `parquet:"local_blks_hit"`
+	LocalBlksRead     *int64   `parquet:"local_blks_read"`
+	LocalBlksDirtied  *int64   `parquet:"local_blks_dirtied"`
+	LocalBlksWritten  *int64   `parquet:"local_blks_written"`
+	BlkReadTime       *float64 `parquet:"blk_read_time"`
+	BlkWriteTime      *float64 `parquet:"blk_write_time"`
+	TempBlksRead      *int64   `parquet:"temp_blks_read"`
+	TempBlksWritten   *int64   `parquet:"temp_blks_written"`
+	TempBlkReadTime   *float64 `parquet:"temp_blk_read_time"`
+	TempBlkWriteTime  *float64 `parquet:"temp_blk_write_time"`
+
+	WalRecords *int64 `parquet:"wal_records"`
+	WalFpi     *int64 `parquet:"wal_fpi"`
+	WalBytes   *int64 `parquet:"wal_bytes"`
+
+	JitFunctions        *int64   `parquet:"jit_functions"`
+	JitGenerationTime   *float64 `parquet:"jit_generation_time"`
+	JitInliningTime     *float64 `parquet:"jit_inlining_time"`
+	JitOptimizationTime *float64 `parquet:"jit_optimization_time"`
+	JitEmissionTime     *float64 `parquet:"jit_emission_time"`
+}
+
+func nullInt64(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+func nullFloat64(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func nullString(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func newParquetSpan(r *spanRow) parquetSpan {
+	start, end := r.startTime(), r.endTime()
+	return parquetSpan{
+		TraceId:    r.traceId,
+		TraceIdLow: r.traceIdLow,
+		ParentId:   r.parentId,
+		SpanId:     r.spanId,
+
+		SpanType:      r.spanType,
+		SpanOperation: r.spanOperation,
+		DeparseInfo:   nullString(r.deparseInfo),
+		Parameters:    nullString(r.parameters),
+		SpanStart:     start,
+		SpanEnd:       end,
+		Duration:      int64(end.Sub(start)),
+
+		Startup:      nullInt64(r.startup),
+		Pid:          r.pid,
+		SubxactCount: r.subxactCount,
+		SqlErrorCode: r.sqlErrorCode,
+		Rows:         nullInt64(r.rows),
+		QueryId:      nullInt64(r.queryId),
+		Database:     nonEmpty(r.dbName),
+		User:         nonEmpty(r.userName),
+
+		PlanStartupCost: nullFloat64(r.planStartupCost),
+		PlanTotalCost:   nullFloat64(r.planTotalCost),
+		PlanRows:        nullFloat64(r.planRows),
+		PlanWidth:       nullInt64(r.planWidth),
+
+		SharedBlksHit:     nullInt64(r.sharedBlks.hit),
+		SharedBlksRead:    nullInt64(r.sharedBlks.read),
+		SharedBlksDirtied: nullInt64(r.sharedBlks.dirtied),
+		SharedBlksWritten: nullInt64(r.sharedBlks.written),
+		LocalBlksHit:      nullInt64(r.localBlks.hit),
+		LocalBlksRead:     nullInt64(r.localBlks.read),
+		LocalBlksDirtied:  nullInt64(r.localBlks.dirtied),
+		LocalBlksWritten:  nullInt64(r.localBlks.written),
+		BlkReadTime:       nullFloat64(r.blkTime.readTime),
+		BlkWriteTime:      nullFloat64(r.blkTime.writeTime),
+		TempBlksRead:      nullInt64(r.tempBlks.read),
+		TempBlksWritten:   nullInt64(r.tempBlks.written),
+		TempBlkReadTime:   nullFloat64(r.tempBlkTime.readTime),
+		TempBlkWriteTime:  nullFloat64(r.tempBlkTime.writeTime),
+
+		WalRecords: nullInt64(r.walRecords),
+		WalFpi:     nullInt64(r.walFpi),
+		WalBytes:   nullInt64(r.walBytes),
+
+		JitFunctions:        nullInt64(r.jitFunctions),
+		JitGenerationTime:   nullFloat64(r.jitGenerationTime),
+		JitInliningTime:     nullFloat64(r.jitInliningTime),
+		JitOptimizationTime: nullFloat64(r.jitOptimizationTime),
+		JitEmissionTime:     nullFloat64(r.jitEmissionTime),
+	}
+}
+
+// parquetSink buffers span rows per partition and writes them to Parquet
+// files, partitioned hive style on the span start, e.g.
+// date=2023-11-16/hour=10/spans-20231116T101500.000-1.parquet
+type parquetSink struct {
+	cfg ParquetSinkConfig
+
+	mu         sync.Mutex
+	partitions map[string][]parquetSpan
+	files      int
+}
+
+func newParquetSink(cfg ParquetSinkConfig) (*parquetSink, error) {
+	if err := os.MkdirAll(cfg.Directory, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create parquet directory: %w", err)
+	}
+	if cfg.MaxRows == 0 {
+		cfg.MaxRows = defaultParquetMaxRows
+	}
+	return &parquetSink{cfg: cfg, partitions: map[string][]parquetSpan{}}, nil
+}
+
+func partitionOf(start time.Time) string {
+	start = start.UTC()
+	return filepath.Join("date="+start.Format("2006-01-02"), "hour="+start.Format("15"))
+}
+
+func (s *parquetSink) Write(rows []*spanRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range rows {
+		partition := partitionOf(r.startTime())
+		s.partitions[partition] = append(s.partitions[partition], newParquetSpan(r))
+		if len(s.partitions[partition]) >= s.cfg.MaxRows {
+			if err := s.writePartition(partition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writePartition writes the buffered rows of a partition to a new file.
+// Files are renamed once complete so readers never see partial files.
+func (s *parquetSink) writePartition(partition string) error {
+	spans := s.partitions[partition]
+	delete(s.partitions, partition)
+	dir := filepath.Join(s.cfg.Directory, partition)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create parquet partition: %w", err)
+	}
+	s.files++
+	path := filepath.Join(dir, fmt.Sprintf("spans-%s-%d.parquet", time.Now().UTC().Format("20060102T150405.000"), s.files))
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create parquet file: %w", err)
+	}
+	w := parquet.NewGenericWriter[parquetSpan](file, parquet.Compression(&parquet.Zstd))
+	if _, err = w.Write(spans); err == nil {
+		err = w.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return fmt.Errorf("failed to write parquet file: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Close writes all buffered rows
+func (s *parquetSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for partition := range s.partitions {
+		if err := s.writePartition(partition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
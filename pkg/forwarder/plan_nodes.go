@@ -0,0 +1,49 @@
+package forwarder
+
+import "go.opentelemetry.io/otel/attribute"
+
+// Span types which aren't plan nodes, besides top-level statement spans
+var nonPlanNodeTypes = map[string]bool{
+	"Planner":           true,
+	"ProcessUtility":    true,
+	"ExecutorStart":     true,
+	"ExecutorRun":       true,
+	"ExecutorFinish":    true,
+	"ExecutorEnd":       true,
+	"TransactionCommit": true,
+	"TransactionBlock":  true,
+}
+
+func isPlanNode(r *spanRow) bool {
+	if isTopSpan(r.spanType) || nonPlanNodeTypes[r.spanType] {
+		return false
+	}
+	_, isWorker := workerNumber(r)
+	return !isWorker
+}
+
+// planNodeAttributes describes the position of a plan node span in the plan:
+// its node type, its parent node type and its depth among plan nodes
+func (b *spanBatch) planNodeAttributes(r *spanRow) []attribute.KeyValue {
+	if !isPlanNode(r) {
+		return nil
+	}
+	attributes := []attribute.KeyValue{attribute.String("db.postgresql.plan.node_type", r.spanType)}
+	depth := 0
+	var parentNode *spanRow
+	parent := b.bySpanId[r.parentId]
+	// Steps are bounded to guard against cycles in malformed data
+	for steps := 0; parent != nil && steps < len(b.rows); steps++ {
+		if isPlanNode(parent) {
+			if parentNode == nil {
+				parentNode = parent
+			}
+			depth++
+		}
+		parent = b.bySpanId[parent.parentId]
+	}
+	if parentNode != nil {
+		attributes = append(attributes, attribute.String("db.postgresql.plan.parent_node_type", parentNode.spanType))
+	}
+	return append(attributes, attribute.Int("db.postgresql.plan.depth", depth))
+}
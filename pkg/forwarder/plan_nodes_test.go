@@ -0,0 +1,51 @@
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestPlanNodeAttributes(t *testing.T) {
+	batch := newSpanBatch(parallelPlanRows())
+	for _, tc := range []struct {
+		spanId int64
+		want   []attribute.KeyValue
+	}{
+		{10, nil},
+		{11, nil},
+		{14, nil},
+		{12, []attribute.KeyValue{
+			attribute.String("db.postgresql.plan.node_type", "Gather"),
+			attribute.Int("db.postgresql.plan.depth", 0),
+		}},
+		{13, []attribute.KeyValue{
+			attribute.String("db.postgresql.plan.node_type", "SeqScan"),
+			attribute.String("db.postgresql.plan.parent_node_type", "Gather"),
+			attribute.Int("db.postgresql.plan.depth", 1),
+		}},
+		// Workers are skipped, the scan run by a worker belongs to the gather node
+		{15, []attribute.KeyValue{
+			attribute.String("db.postgresql.plan.node_type", "SeqScan"),
+			attribute.String("db.postgresql.plan.parent_node_type", "Gather"),
+			attribute.Int("db.postgresql.plan.depth", 1),
+		}},
+	} {
+		got := batch.planNodeAttributes(batch.bySpanId[tc.spanId])
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("span %d: got %v, expected %v", tc.spanId, got, tc.want)
+		}
+	}
+}
+
+func TestPlanNodeAttributesCycle(t *testing.T) {
+	rows := parallelPlanRows()[:4]
+	// Malformed data where the top span's parent is one of its descendants
+	rows[0].parentId = 13
+	batch := newSpanBatch(rows)
+	got := batch.planNodeAttributes(batch.bySpanId[13])
+	if len(got) != 3 {
+		t.Fatalf("unexpected attributes %v", got)
+	}
+}
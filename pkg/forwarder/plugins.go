@@ -0,0 +1,89 @@
+package forwarder
+
+import (
+	"fmt"
+	"plugin"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Constructors looked up in plugins, both optional:
+//
+//	func NewSpanTransformer() (forwarder.SpanTransformer, error)
+//	func NewSpanExporter() (sdktrace.SpanExporter, error)
+const (
+	pluginTransformerSymbol = "NewSpanTransformer"
+	pluginExporterSymbol    = "NewSpanExporter"
+)
+
+func validatePlugins(paths []string) error {
+	for _, path := range paths {
+		if path == "" {
+			return fmt.Errorf("plugin path can't be empty")
+		}
+	}
+	return nil
+}
+
+// lookupPlugin returns the symbol of the plugin at path, nil if the plugin
+// doesn't export it. Plugins are only loaded once by the runtime.
+func lookupPlugin(path string, symbol string) (plugin.Symbol, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin: %w", err)
+	}
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return nil, nil
+	}
+	return sym, nil
+}
+
+// pluginTransformers creates the span transformers of the plugins
+func pluginTransformers(paths []string) ([]SpanTransformer, error) {
+	var transformers []SpanTransformer
+	for _, path := range paths {
+		sym, err := lookupPlugin(path, pluginTransformerSymbol)
+		if err != nil {
+			return nil, err
+		}
+		if sym == nil {
+			continue
+		}
+		newTransformer, ok := sym.(func() (SpanTransformer, error))
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: %s has type %T, expected func() (forwarder.SpanTransformer, error)", path, pluginTransformerSymbol, sym)
+		}
+		transformer, err := newTransformer()
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: failed to create span transformer: %w", path, err)
+		}
+		transformers = append(transformers, transformer)
+	}
+	return transformers, nil
+}
+
+// pluginExporters creates the span exporters of the plugins, spans being
+// exported to them in addition to the exporter
+func pluginExporters(paths []string) ([]sdktrace.SpanExporter, error) {
+	var exporters []sdktrace.SpanExporter
+	for _, path := range paths {
+		sym, err := lookupPlugin(path, pluginExporterSymbol)
+		if err != nil {
+			return nil, err
+		}
+		if sym == nil {
+			continue
+		}
+		newExporter, ok := sym.(func() (sdktrace.SpanExporter, error))
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: %s has type %T, expected func() (trace.SpanExporter, error)", path, pluginExporterSymbol, sym)
+		}
+		exporter, err := newExporter()
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: failed to create span exporter: %w", path, err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
@@ -0,0 +1,86 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type FixedIdGenerator struct {
+	FixedSpanID  trace.SpanID
+	FixedTraceID trace.TraceID
+}
+
+func (f *FixedIdGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	return f.FixedSpanID
+}
+
+func (f *FixedIdGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	return f.FixedTraceID, f.FixedSpanID
+}
+
+// newResource builds the resource shared by the exported spans and metrics
+func newResource(ctx context.Context, cfg *Config, serverInfo *ServerInfo) (*resource.Resource, error) {
+	opts := resourceDetectorOptions(cfg.Resource.Detectors)
+	opts = append(opts,
+		resource.WithAttributes(
+			semconv.ServiceName(serverInfo.ServiceName(cfg.Resource.ServiceName)),
+		),
+		resource.WithAttributes(serverInfo.ResourceAttributes()...),
+		// User provided attributes take precedence over detected ones
+		resource.WithAttributes(userResourceAttributes(cfg.Resource)...),
+	)
+	res, err := resource.New(ctx, opts...)
+	if errors.Is(err, resource.ErrPartialResource) {
+		log.Printf("Some resource attributes couldn't be detected: %v", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
+
+func initProvider(g *FixedIdGenerator, cfg *Config, res *resource.Resource, stats *forwarderStats, processors ...sdktrace.SpanProcessor) (*sdktrace.TracerProvider, error) {
+	ctx := context.Background()
+	traceExporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Register the trace exporter with a TracerProvider, using a batch
+	// span processor to aggregate spans before export.
+	batchOpts := batchOptions(cfg.Exporter.Batch)
+	if cfg.Exporter.Backpressure.Enabled {
+		// A full queue blocks the poll loop instead of dropping spans
+		batchOpts = append(batchOpts, sdktrace.WithBlocking())
+	}
+	bsp := sdktrace.NewBatchSpanProcessor(&statsExporter{SpanExporter: traceExporter, stats: stats}, batchOpts...)
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(&queueTracker{stats: stats}),
+		sdktrace.WithSpanProcessor(bsp),
+		sdktrace.WithIDGenerator(g),
+	}
+	for _, processor := range processors {
+		providerOpts = append(providerOpts, sdktrace.WithSpanProcessor(processor))
+	}
+	for _, sink := range newSinkExporters(cfg.Sinks) {
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(sink))
+	}
+	plugins, err := pluginExporters(cfg.Plugins)
+	if err != nil {
+		return nil, err
+	}
+	for _, exporter := range plugins {
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+	// The provider generates the ids of the pg_tracing rows, it's only used
+	// by the target's forwarder and never registered globally
+	return sdktrace.NewTracerProvider(providerOpts...), nil
+}
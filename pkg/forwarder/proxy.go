@@ -0,0 +1,117 @@
+package forwarder
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+func validateProxyConfig(c CollectorConfig) error {
+	if c.Proxy == "" {
+		if c.NoProxy != "" {
+			return fmt.Errorf("collector no_proxy requires a proxy")
+		}
+		return nil
+	}
+	u, err := url.Parse(c.Proxy)
+	if err != nil {
+		return fmt.Errorf("invalid collector proxy: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid collector proxy %q, expected http://host:port or https://host:port", c.Proxy)
+	}
+	return nil
+}
+
+// proxyDialer returns a dialer tunneling the connections to the collectors
+// through the configured proxy with HTTP CONNECT, except for the no_proxy
+// hosts. Without proxy, gRPC honors HTTPS_PROXY and NO_PROXY.
+func proxyDialer(c CollectorConfig) func(ctx context.Context, addr string) (net.Conn, error) {
+	proxyFunc := (&httpproxy.Config{HTTPSProxy: c.Proxy, NoProxy: c.NoProxy}).ProxyFunc()
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		var dialer net.Dialer
+		proxy, err := proxyFunc(&url.URL{Scheme: "https", Host: addr})
+		if err != nil || proxy == nil {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", canonicalProxyAddr(proxy))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to proxy %s: %w", proxy.Host, err)
+		}
+		if proxy.Scheme == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed to connect to proxy %s: %w", proxy.Host, err)
+			}
+			conn = tlsConn
+		}
+		tunnel, err := connectTunnel(ctx, conn, proxy, addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tunnel, nil
+	}
+}
+
+func canonicalProxyAddr(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	if proxy.Scheme == "https" {
+		return net.JoinHostPort(proxy.Hostname(), "443")
+	}
+	return net.JoinHostPort(proxy.Hostname(), "80")
+}
+
+// connectTunnel asks the proxy to open a tunnel to addr
+func connectTunnel(ctx context.Context, conn net.Conn, proxy *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("failed to send CONNECT to proxy %s: %w", proxy.Host, err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONNECT response of proxy %s: %w", proxy.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy %s refused the tunnel to %s: %s", proxy.Host, addr, resp.Status)
+	}
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads the bytes buffered while reading the CONNECT response
+// before the connection's
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,79 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// reconnect replaces the forwarder's closed connection, e.g. after a
+// failover. With a multi-host DSN, pgx connects to the first reachable host
+// matching target_session_attrs, so a read-write session follows the new
+// primary. The connection attributes of spans are updated to the new host,
+// the resource of multi-host DSNs having no host specific attributes.
+func (fw *targetForwarder) reconnect(ctx context.Context) error {
+	var conn *pgx.Conn
+	var err error
+	if fw.connector != nil {
+		// Credentials may have expired since the last connection
+		conn, err = fw.connector.connect(ctx)
+	} else {
+		conn, err = pgx.ConnectConfig(ctx, fw.conn.Config())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reconnect: %w", err)
+	}
+	converter, err := newSpanConverter(fw.cfg, conn)
+	if err != nil {
+		conn.Close(ctx)
+		return err
+	}
+	converter.stats = fw.stats
+	// Session level locks are lost with the previous connection
+	if fw.lock != nil {
+		lock, err := newConsumerLock(fw.cfg, conn)
+		if err != nil {
+			conn.Close(ctx)
+			return err
+		}
+		fw.lock = lock
+	}
+	fw.conn = conn
+	fw.converter = converter
+	// Prepared statements are lost with the previous connection
+	if err := fw.query.prepare(ctx, conn); err != nil {
+		fw.log.Printf("Span query is not prepared: %v", err)
+	}
+	if host, port, ok := activeHost(conn); ok {
+		fw.log.Printf("Reconnected to %s:%d", host, port)
+	} else {
+		fw.log.Printf("Reconnected")
+	}
+	return nil
+}
+
+// checkConnection reopens the connection when lost, or when its credentials
+// or client certificates are replaced. A failed reconnection is retried on
+// the next poll.
+func (fw *targetForwarder) checkConnection(ctx context.Context) {
+	if fw.connector != nil && !fw.conn.IsClosed() {
+		expiring, err := fw.connector.renew(ctx)
+		if err != nil {
+			fw.log.Printf("Failed to renew database credentials: %v", err)
+		}
+		switch {
+		case expiring:
+			fw.log.Printf("Database credentials expire soon, reconnecting")
+			fw.conn.Close(ctx)
+		case fw.connector.certsChanged():
+			fw.log.Printf("Client certificates changed, reconnecting")
+			fw.conn.Close(ctx)
+		}
+	}
+	if fw.conn.IsClosed() {
+		if err := fw.reconnect(ctx); err != nil && ctx.Err() == nil {
+			fw.log.Printf("Connection lost: %v", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Relabeling actions, following Prometheus' relabel_config semantics
+const (
+	relabelReplace = "replace"
+	relabelDrop    = "drop"
+	relabelKeep    = "keep"
+)
+
+type relabelRule struct {
+	source      attribute.Key
+	target      attribute.Key
+	regex       *regexp.Regexp
+	replacement string
+	action      string
+	// copyGroup is set when the replacement is the first group alone, the
+	// value keeping its type when the group matches it whole
+	copyGroup bool
+}
+
+func newRelabelRules(cfgs []RelabelConfig) ([]relabelRule, error) {
+	rules := make([]relabelRule, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		rule := relabelRule{
+			source:      attribute.Key(cfg.Source),
+			target:      attribute.Key(cfg.Target),
+			replacement: cfg.Replacement,
+			action:      cfg.Action,
+		}
+		if rule.source == "" {
+			return nil, fmt.Errorf("relabel rule %d: source is required", i)
+		}
+		if rule.action == "" {
+			rule.action = relabelReplace
+		}
+		switch rule.action {
+		case relabelReplace:
+			if rule.target == "" {
+				return nil, fmt.Errorf("relabel rule %d: target is required for replace", i)
+			}
+		case relabelDrop, relabelKeep:
+		default:
+			return nil, fmt.Errorf("relabel rule %d: unknown action %q", i, rule.action)
+		}
+		expr := cfg.Regex
+		if expr == "" {
+			expr = "(.*)"
+		}
+		if rule.replacement == "" {
+			rule.replacement = "$1"
+		}
+		rule.copyGroup = rule.replacement == "$1" || rule.replacement == "${1}"
+		// Like Prometheus, the regex has to match the whole value
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("relabel rule %d: invalid regex: %w", i, err)
+		}
+		rule.regex = re
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func findAttribute(attributes []attribute.KeyValue, key attribute.Key) int {
+	for i, attr := range attributes {
+		if attr.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *relabelRule) apply(attributes []attribute.KeyValue) []attribute.KeyValue {
+	idx := findAttribute(attributes, r.source)
+	if idx < 0 {
+		return attributes
+	}
+	value := attributes[idx].Value.Emit()
+	match := r.regex.FindStringSubmatchIndex(value)
+
+	switch r.action {
+	case relabelReplace:
+		if match == nil {
+			return attributes
+		}
+		var kv attribute.KeyValue
+		if r.copyGroup && len(match) > 3 && match[2] == 0 && match[3] == len(value) {
+			// e.g. an integer pid copied to process.pid stays an integer
+			kv = attribute.KeyValue{Key: r.target, Value: attributes[idx].Value}
+		} else {
+			kv = r.target.String(string(r.regex.ExpandString(nil, r.replacement, value, match)))
+		}
+		if target := findAttribute(attributes, r.target); target >= 0 {
+			attributes[target] = kv
+			return attributes
+		}
+		return append(attributes, kv)
+	case relabelDrop:
+		if match != nil {
+			return append(attributes[:idx], attributes[idx+1:]...)
+		}
+	case relabelKeep:
+		if match == nil {
+			return append(attributes[:idx], attributes[idx+1:]...)
+		}
+	}
+	return attributes
+}
+
+func applyRelabelRules(rules []relabelRule, attributes []attribute.KeyValue) []attribute.KeyValue {
+	for i := range rules {
+		attributes = rules[i].apply(attributes)
+	}
+	return attributes
+}
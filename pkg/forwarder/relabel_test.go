@@ -0,0 +1,89 @@
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestRelabelRules(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		cfgs       []RelabelConfig
+		attributes []attribute.KeyValue
+		want       []attribute.KeyValue
+	}{
+		{
+			name:       "copy keeps the type",
+			cfgs:       []RelabelConfig{{Source: "pid", Target: "process.pid"}},
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 42)},
+			want:       []attribute.KeyValue{attribute.Int64("pid", 42), attribute.Int64("process.pid", 42)},
+		},
+		{
+			name:       "partial group is a string",
+			cfgs:       []RelabelConfig{{Source: "pid", Regex: "(4)2", Target: "digit"}},
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 42)},
+			want:       []attribute.KeyValue{attribute.Int64("pid", 42), attribute.String("digit", "4")},
+		},
+		{
+			name:       "template is a string",
+			cfgs:       []RelabelConfig{{Source: "pid", Target: "process", Replacement: "pid-$1"}},
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 42)},
+			want:       []attribute.KeyValue{attribute.Int64("pid", 42), attribute.String("process", "pid-42")},
+		},
+		{
+			name:       "no match",
+			cfgs:       []RelabelConfig{{Source: "db.name", Regex: "post", Target: "db"}},
+			attributes: []attribute.KeyValue{attribute.String("db.name", "postgres")},
+			want:       []attribute.KeyValue{attribute.String("db.name", "postgres")},
+		},
+		{
+			name: "overwrite target",
+			cfgs: []RelabelConfig{{Source: "db.name", Regex: "(.*)gres", Target: "db.system"}},
+			attributes: []attribute.KeyValue{
+				attribute.String("db.name", "postgres"), attribute.String("db.system", "postgresql"),
+			},
+			want: []attribute.KeyValue{
+				attribute.String("db.name", "postgres"), attribute.String("db.system", "post"),
+			},
+		},
+		{
+			name: "rename",
+			cfgs: []RelabelConfig{
+				{Source: "pid", Target: "process.pid"},
+				{Source: "pid", Action: relabelDrop},
+			},
+			attributes: []attribute.KeyValue{attribute.Int64("pid", 42)},
+			want:       []attribute.KeyValue{attribute.Int64("process.pid", 42)},
+		},
+		{
+			name:       "keep",
+			cfgs:       []RelabelConfig{{Source: "db.user", Regex: "app_.*", Action: relabelKeep}},
+			attributes: []attribute.KeyValue{attribute.String("db.user", "postgres"), attribute.Int64("pid", 42)},
+			want:       []attribute.KeyValue{attribute.Int64("pid", 42)},
+		},
+	} {
+		rules, err := newRelabelRules(tc.cfgs)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got := applyRelabelRules(rules, tc.attributes)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, expected %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRelabelRulesErrors(t *testing.T) {
+	for _, cfg := range []RelabelConfig{
+		{Target: "a"},
+		{Source: "a"},
+		{Source: "a", Action: "rename"},
+		{Source: "a", Target: "b", Regex: "("},
+	} {
+		if _, err := newRelabelRules([]RelabelConfig{cfg}); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
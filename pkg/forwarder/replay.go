@@ -0,0 +1,254 @@
+package forwarder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// maxReplayLine is the longest line accepted in span files
+const maxReplayLine = 64 * 1024 * 1024
+
+func anyValue(v *commonpb.AnyValue) attribute.Value {
+	switch value := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return attribute.StringValue(value.StringValue)
+	case *commonpb.AnyValue_BoolValue:
+		return attribute.BoolValue(value.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return attribute.Int64Value(value.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return attribute.Float64Value(value.DoubleValue)
+	case *commonpb.AnyValue_ArrayValue:
+		var strs []string
+		for _, item := range value.ArrayValue.Values {
+			strs = append(strs, anyValue(item).Emit())
+		}
+		return attribute.StringSliceValue(strs)
+	}
+	return attribute.StringValue(v.String())
+}
+
+func keyValues(kvs []*commonpb.KeyValue) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(kvs))
+	for _, kv := range kvs {
+		attrs = append(attrs, attribute.KeyValue{Key: attribute.Key(kv.Key), Value: anyValue(kv.Value)})
+	}
+	return attrs
+}
+
+func unixNano(ns uint64, offset time.Duration) time.Time {
+	return time.Unix(0, int64(ns)).Add(offset)
+}
+
+func spanContextOfIds(traceId, spanId []byte) trace.SpanContext {
+	var tid trace.TraceID
+	var sid trace.SpanID
+	copy(tid[:], traceId)
+	copy(sid[:], spanId)
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled})
+}
+
+func statusOf(status *tracepb.Status) sdktrace.Status {
+	switch status.GetCode() {
+	case tracepb.Status_STATUS_CODE_OK:
+		return sdktrace.Status{Code: codes.Ok}
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return sdktrace.Status{Code: codes.Error, Description: status.GetMessage()}
+	}
+	return sdktrace.Status{Code: codes.Unset}
+}
+
+// readOnlySpans rebuilds the spans of an export request, shifting their
+// timestamps by offset
+func readOnlySpans(req *collectortracepb.ExportTraceServiceRequest, offset time.Duration) []sdktrace.ReadOnlySpan {
+	var stubs tracetest.SpanStubs
+	for _, rs := range req.ResourceSpans {
+		res := resource.NewWithAttributes(rs.SchemaUrl, keyValues(rs.GetResource().GetAttributes())...)
+		for _, ss := range rs.ScopeSpans {
+			scope := instrumentation.Library{
+				Name:      ss.GetScope().GetName(),
+				Version:   ss.GetScope().GetVersion(),
+				SchemaURL: ss.SchemaUrl,
+			}
+			for _, span := range ss.Spans {
+				stub := tracetest.SpanStub{
+					Name:                   span.Name,
+					SpanContext:            spanContextOfIds(span.TraceId, span.SpanId),
+					SpanKind:               trace.SpanKind(span.Kind),
+					StartTime:              unixNano(span.StartTimeUnixNano, offset),
+					EndTime:                unixNano(span.EndTimeUnixNano, offset),
+					Attributes:             keyValues(span.Attributes),
+					Status:                 statusOf(span.Status),
+					Resource:               res,
+					InstrumentationLibrary: scope,
+				}
+				if len(span.ParentSpanId) > 0 {
+					stub.Parent = spanContextOfIds(span.TraceId, span.ParentSpanId)
+				}
+				for _, event := range span.Events {
+					stub.Events = append(stub.Events, sdktrace.Event{
+						Name:       event.Name,
+						Time:       unixNano(event.TimeUnixNano, offset),
+						Attributes: keyValues(event.Attributes),
+					})
+				}
+				for _, link := range span.Links {
+					stub.Links = append(stub.Links, sdktrace.Link{
+						SpanContext: spanContextOfIds(link.TraceId, link.SpanId),
+						Attributes:  keyValues(link.Attributes),
+					})
+				}
+				stubs = append(stubs, stub)
+			}
+		}
+	}
+	return stubs.Snapshots()
+}
+
+// readSpanFile calls fn with each export request of a span file, which can
+// be gzip compressed
+func readSpanFile(path string, fn func(*collectortracepb.ExportTraceServiceRequest) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open span file: %w", err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", path, err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxReplayLine)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		req, err := unmarshalOtlpJson(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+// earliestStart returns the start of the first span of the files
+func earliestStart(paths []string) (time.Time, error) {
+	var earliest uint64
+	for _, path := range paths {
+		err := readSpanFile(path, func(req *collectortracepb.ExportTraceServiceRequest) error {
+			for _, rs := range req.ResourceSpans {
+				for _, ss := range rs.ScopeSpans {
+					for _, span := range ss.Spans {
+						if earliest == 0 || span.StartTimeUnixNano < earliest {
+							earliest = span.StartTimeUnixNano
+						}
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(0, int64(earliest)), nil
+}
+
+// replayCommand re-exports span files written by the file exporter
+func replayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [options] <file>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "", "Path to the YAML configuration file")
+	exporter := fs.String("exporter", "", "Exporter to use: "+exporterTypesUsage())
+	offset := fs.Duration("time-offset", 0, "Duration added to all timestamps")
+	shiftToNow := fs.Bool("shift-to-now", false, "Shift timestamps so the earliest span starts now")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no span file given")
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *exporter != "" {
+		cfg.Exporter.Type = *exporter
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if *shiftToNow {
+		earliest, err := earliestStart(fs.Args())
+		if err != nil {
+			return err
+		}
+		*offset += time.Since(earliest)
+	}
+
+	ctx := context.Background()
+	traceExporter, err := newTraceExporter(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	exporters := append([]sdktrace.SpanExporter{traceExporter}, newSinkExporters(cfg.Sinks)...)
+	defer func() {
+		for _, e := range exporters {
+			if err := e.Shutdown(ctx); err != nil {
+				log.Printf("Failed to shutdown exporter: %v", err)
+			}
+		}
+	}()
+
+	replayed := 0
+	for _, path := range fs.Args() {
+		err := readSpanFile(path, func(req *collectortracepb.ExportTraceServiceRequest) error {
+			spans := readOnlySpans(req, *offset)
+			for _, e := range exporters {
+				if err := e.ExportSpans(ctx, spans); err != nil {
+					return fmt.Errorf("failed to export spans: %w", err)
+				}
+			}
+			replayed += len(spans)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Replayed %d spans", replayed)
+	return nil
+}
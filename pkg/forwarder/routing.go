@@ -0,0 +1,176 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRoutedTraces bounds the number of remembered routing decisions
+const maxRoutedTraces = 10000
+
+// route sends the traces it matches to its endpoint. All conditions have to
+// match on the same span.
+type route struct {
+	name       string
+	endpoint   string
+	spanName   *regexp.Regexp
+	attributes map[attribute.Key]*regexp.Regexp
+	exporter   sdktrace.SpanExporter
+}
+
+func compileRouteRegex(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func newRoutes(cfgs []RouteConfig) ([]*route, error) {
+	routes := make([]*route, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		r := &route{
+			name:       cfg.Name,
+			endpoint:   cfg.Endpoint,
+			attributes: map[attribute.Key]*regexp.Regexp{},
+		}
+		if r.name == "" {
+			r.name = fmt.Sprintf("%d", i)
+		}
+		if r.endpoint == "" {
+			return nil, fmt.Errorf("route %s: endpoint is required", r.name)
+		}
+		conditions := map[string]string{}
+		for k, v := range cfg.Attributes {
+			conditions[k] = v
+		}
+		if cfg.Database != "" {
+			conditions[string(semconv.DBNameKey)] = cfg.Database
+		}
+		if cfg.SpanName == "" && len(conditions) == 0 {
+			return nil, fmt.Errorf("route %s: at least one of database, span_name or attributes is required", r.name)
+		}
+		if cfg.SpanName != "" {
+			re, err := compileRouteRegex(cfg.SpanName)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid span_name regex: %w", r.name, err)
+			}
+			r.spanName = re
+		}
+		for k, expr := range conditions {
+			re, err := compileRouteRegex(expr)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: invalid regex for %s: %w", r.name, k, err)
+			}
+			r.attributes[attribute.Key(k)] = re
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func (r *route) matches(span sdktrace.ReadOnlySpan) bool {
+	if r.spanName != nil && !r.spanName.MatchString(span.Name()) {
+		return false
+	}
+	for key, re := range r.attributes {
+		idx := findAttribute(span.Attributes(), key)
+		if idx < 0 || !re.MatchString(span.Attributes()[idx].Value.Emit()) {
+			return false
+		}
+	}
+	return true
+}
+
+// routingExporter dispatches spans to the exporter of the first route
+// matching a span of their trace, keeping traces on a single backend.
+type routingExporter struct {
+	routes    []*route
+	fallback  sdktrace.SpanExporter
+	exporters map[string]sdktrace.SpanExporter
+
+	mu sync.Mutex
+	// decisions remembers where traces were sent, so spans of a trace
+	// exported in a later batch follow the same route
+	decisions map[trace.TraceID]sdktrace.SpanExporter
+	order     []trace.TraceID
+}
+
+func newRoutingExporter(routes []*route, fallback sdktrace.SpanExporter, exporters map[string]sdktrace.SpanExporter) *routingExporter {
+	return &routingExporter{
+		routes:    routes,
+		fallback:  fallback,
+		exporters: exporters,
+		decisions: map[trace.TraceID]sdktrace.SpanExporter{},
+	}
+}
+
+func (e *routingExporter) route(spans []sdktrace.ReadOnlySpan) sdktrace.SpanExporter {
+	for _, r := range e.routes {
+		for _, span := range spans {
+			if r.matches(span) {
+				return r.exporter
+			}
+		}
+	}
+	return e.fallback
+}
+
+func (e *routingExporter) remember(traceId trace.TraceID, exporter sdktrace.SpanExporter) {
+	if len(e.order) >= maxRoutedTraces {
+		delete(e.decisions, e.order[0])
+		e.order = e.order[1:]
+	}
+	e.decisions[traceId] = exporter
+	e.order = append(e.order, traceId)
+}
+
+func (e *routingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	var traceIds []trace.TraceID
+	byTrace := map[trace.TraceID][]sdktrace.ReadOnlySpan{}
+	for _, span := range spans {
+		traceId := span.SpanContext().TraceID()
+		if _, ok := byTrace[traceId]; !ok {
+			traceIds = append(traceIds, traceId)
+		}
+		byTrace[traceId] = append(byTrace[traceId], span)
+	}
+
+	var exporterOrder []sdktrace.SpanExporter
+	batches := map[sdktrace.SpanExporter][]sdktrace.ReadOnlySpan{}
+	e.mu.Lock()
+	for _, traceId := range traceIds {
+		exporter, ok := e.decisions[traceId]
+		if !ok {
+			exporter = e.route(byTrace[traceId])
+			e.remember(traceId, exporter)
+		}
+		if _, ok := batches[exporter]; !ok {
+			exporterOrder = append(exporterOrder, exporter)
+		}
+		batches[exporter] = append(batches[exporter], byTrace[traceId]...)
+	}
+	e.mu.Unlock()
+
+	var errs []error
+	for _, exporter := range exporterOrder {
+		if err := exporter.ExportSpans(ctx, batches[exporter]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *routingExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, exporter := range e.exporters {
+		if err := exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
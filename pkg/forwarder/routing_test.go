@@ -0,0 +1,103 @@
+package forwarder
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func routingTestSpan(traceId, spanId int64, name string, attributes ...attribute.KeyValue) tracetest.SpanStub {
+	return tracetest.SpanStub{
+		Name: name,
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceIdOf(traceId, 0),
+			SpanID:  spanIdOf(spanId),
+		}),
+		Attributes: attributes,
+	}
+}
+
+func TestRoutingExporter(t *testing.T) {
+	routes, err := newRoutes([]RouteConfig{
+		{Name: "billing", Endpoint: "billing:4317", Database: "billing"},
+		{Name: "slow", Endpoint: "slow:4317", SpanName: "(?i)select .*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	billing, slow, fallback := tracetest.NewInMemoryExporter(), tracetest.NewInMemoryExporter(), tracetest.NewInMemoryExporter()
+	routes[0].exporter = billing
+	routes[1].exporter = slow
+	exporter := newRoutingExporter(routes, fallback, map[string]sdktrace.SpanExporter{
+		"billing": billing, "slow": slow, "fallback": fallback,
+	})
+
+	ctx := context.Background()
+	// The first route matching any span of the trace wins
+	err = exporter.ExportSpans(ctx, tracetest.SpanStubs{
+		routingTestSpan(1, 1, "select 1;", attribute.String("db.name", "billing")),
+		routingTestSpan(1, 2, "ExecutorRun"),
+		routingTestSpan(2, 3, "SELECT now();"),
+		routingTestSpan(3, 4, "insert into t values (1);"),
+	}.Snapshots())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Later spans of a routed trace follow it
+	err = exporter.ExportSpans(ctx, tracetest.SpanStubs{routingTestSpan(1, 5, "ExecutorEnd")}.Snapshots())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		exporter *tracetest.InMemoryExporter
+		want     []trace.SpanID
+	}{
+		{"billing", billing, []trace.SpanID{spanIdOf(1), spanIdOf(2), spanIdOf(5)}},
+		{"slow", slow, []trace.SpanID{spanIdOf(3)}},
+		{"fallback", fallback, []trace.SpanID{spanIdOf(4)}},
+	} {
+		spans := tc.exporter.GetSpans()
+		if len(spans) != len(tc.want) {
+			t.Errorf("%s: got %d spans, expected %d", tc.name, len(spans), len(tc.want))
+			continue
+		}
+		for i, span := range spans {
+			if span.SpanContext.SpanID() != tc.want[i] {
+				t.Errorf("%s: span %d is %s, expected %s", tc.name, i, span.SpanContext.SpanID(), tc.want[i])
+			}
+		}
+	}
+}
+
+func TestRoutingDecisionsBounded(t *testing.T) {
+	fallback := tracetest.NewInMemoryExporter()
+	exporter := newRoutingExporter(nil, fallback, nil)
+	for i := 0; i < maxRoutedTraces+10; i++ {
+		exporter.remember(traceIdOf(int64(i), 0), fallback)
+	}
+	if len(exporter.decisions) != maxRoutedTraces || len(exporter.order) != maxRoutedTraces {
+		t.Fatalf("%d decisions remembered, expected %d", len(exporter.decisions), maxRoutedTraces)
+	}
+	if _, ok := exporter.decisions[traceIdOf(0, 0)]; ok {
+		t.Fatal("oldest decision not evicted")
+	}
+}
+
+func TestNewRoutesErrors(t *testing.T) {
+	for _, cfg := range []RouteConfig{
+		{Database: "app"},
+		{Endpoint: "otel:4317"},
+		{Endpoint: "otel:4317", SpanName: "("},
+		{Endpoint: "otel:4317", Attributes: map[string]string{"db.user": "("}},
+	} {
+		if _, err := newRoutes([]RouteConfig{cfg}); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
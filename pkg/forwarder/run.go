@@ -0,0 +1,211 @@
+package forwarder
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runCommand consumes and exports spans, once or until interrupted
+func runCommand(args []string, once bool) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to the YAML configuration file")
+	serviceName := fs.String("service-name", "", "Template for service.name, e.g. postgres-{cluster_name}-{database}")
+	exporter := fs.String("exporter", "", "Exporter to use: "+exporterTypesUsage())
+	dryRun := fs.Bool("dry-run", false, "Peek spans without consuming them and print what would be exported")
+	detectors := fs.String("resource-detectors", "", "Comma separated list of resource detectors: "+resourceDetectorNames())
+	resourceAttrs := keyValueFlag{}
+	fs.Var(resourceAttrs, "resource-attr", "Extra resource attribute as key=value, can be repeated")
+	fs.BoolVar(&once, "once", once, "Consume and export the available spans, then exit")
+	daemon := fs.Bool("daemon", false, "Keep consuming spans until interrupted, the default of the run subcommand")
+	interval := fs.Duration("interval", 0, "Delay between two span fetches, overrides poll_interval")
+	maxQueueSize := fs.Int("max-queue-size", 0, "Spans queued for export before dropping them, overrides exporter.batch.max_queue_size")
+	maxExportBatchSize := fs.Int("max-export-batch-size", 0, "Spans of an export, overrides exporter.batch.max_export_batch_size")
+	batchTimeout := fs.Duration("batch-timeout", 0, "Delay before exporting an incomplete batch, overrides exporter.batch.batch_timeout")
+	exportTimeout := fs.Duration("export-timeout", 0, "Timeout of an export, overrides exporter.batch.export_timeout")
+	logLevel := fs.String("log-level", "", "Log level, info or debug to log the fetched spans, overrides log_level")
+	conversionWorkers := fs.Int("conversion-workers", 0, "Goroutines converting spans, overrides conversion_workers")
+	sslMode := fs.String("sslmode", "", "Postgres SSL mode: "+strings.Join(sslModes, ", "))
+	sslRootCert := fs.String("sslrootcert", "", "CA file verifying the Postgres server")
+	sslCert := fs.String("sslcert", "", "Client certificate file for Postgres")
+	sslKey := fs.String("sslkey", "", "Client certificate key file for Postgres")
+	bootstrap := fs.Bool("bootstrap", false, "Create the pg_tracing extension and the --bootstrap-role role on startup")
+	bootstrapRole := fs.String("bootstrap-role", defaultBootstrapRole, "Role created by --bootstrap")
+	fs.Parse(args)
+	if *daemon {
+		if once && isFlagSet(fs, "once") {
+			return fmt.Errorf("--once and --daemon are exclusive")
+		}
+		once = false
+	}
+
+	// The command line overrides are applied again on reload
+	loadRunConfig := func() (*Config, error) {
+		cfg, err := LoadConfig(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Resource.Attributes == nil {
+			cfg.Resource.Attributes = map[string]string{}
+		}
+		for k, v := range resourceAttrs {
+			cfg.Resource.Attributes[k] = v
+		}
+		if *detectors != "" {
+			cfg.Resource.Detectors = strings.Split(*detectors, ",")
+		}
+		if *serviceName != "" {
+			cfg.Resource.ServiceName = *serviceName
+		}
+		if *exporter != "" {
+			cfg.Exporter.Type = *exporter
+		}
+		if *interval != 0 {
+			cfg.PollInterval = *interval
+		}
+		if *maxQueueSize != 0 {
+			cfg.Exporter.Batch.MaxQueueSize = *maxQueueSize
+		}
+		if *maxExportBatchSize != 0 {
+			cfg.Exporter.Batch.MaxExportBatchSize = *maxExportBatchSize
+		}
+		if *batchTimeout != 0 {
+			cfg.Exporter.Batch.BatchTimeout = *batchTimeout
+		}
+		if *exportTimeout != 0 {
+			cfg.Exporter.Batch.ExportTimeout = *exportTimeout
+		}
+		if *logLevel != "" {
+			cfg.LogLevel = *logLevel
+		}
+		if *conversionWorkers != 0 {
+			cfg.ConversionWorkers = *conversionWorkers
+		}
+		for _, override := range []struct{ flag, setting *string }{
+			{sslMode, &cfg.Connection.SSL.Mode},
+			{sslRootCert, &cfg.Connection.SSL.RootCert},
+			{sslCert, &cfg.Connection.SSL.Cert},
+			{sslKey, &cfg.Connection.SSL.Key},
+		} {
+			if *override.flag != "" {
+				*override.setting = *override.flag
+			}
+		}
+		if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+		if *bootstrap {
+			if err := validateBootstrapRole(*bootstrapRole); err != nil {
+				return nil, err
+			}
+			cfg.BootstrapRole = *bootstrapRole
+		}
+		if *dryRun {
+			// Print the spans instead of exporting them anywhere
+			cfg.DryRun = true
+			cfg.Exporter.Type = exporterConsole
+			cfg.Routes = nil
+			cfg.Sinks = SinksConfig{}
+			cfg.Metrics.Endpoint = ""
+			cfg.Logs.Endpoint = ""
+		}
+		return cfg, nil
+	}
+	cfg, err := loadRunConfig()
+	if err != nil {
+		return err
+	}
+
+	opts := []Option{WithSignals(), WithReload(*configPath, loadRunConfig)}
+	if once {
+		opts = []Option{WithOnce()}
+	}
+	fw, err := New(*cfg, opts...)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := fw.Run(ctx); err != nil {
+		return err
+	}
+	log.Printf("Done!")
+	return nil
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// run fetches spans every interval until ctx is cancelled, logging a summary
+// every summaryInterval if set. Admin requests and, with signals, SIGUSR1
+// stats dumps are handled between fetches.
+func (fw *targetForwarder) run(ctx context.Context, interval, summaryInterval time.Duration, signals bool) {
+	defer close(fw.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var summaries <-chan time.Time
+	if summaryInterval > 0 {
+		summaryTicker := time.NewTicker(summaryInterval)
+		defer summaryTicker.Stop()
+		summaries = summaryTicker.C
+	}
+	summary := &summaryLogger{logger: fw.log, stats: fw.stats}
+	dumps := make(chan os.Signal, 1)
+	if signals {
+		signal.Notify(dumps, syscall.SIGUSR1)
+		defer signal.Stop(dumps)
+	}
+	for {
+		fw.checkConnection(ctx)
+		// Nothing is consumed while paused
+		if !fw.paused.Load() && !fw.conn.IsClosed() && !fw.backpressured() {
+			if err := fw.fetchSpans(ctx); err != nil && ctx.Err() == nil {
+				fw.log.Printf("Failed to fetch spans: %v", err)
+			}
+		}
+		for waiting := true; waiting; {
+			select {
+			case <-ctx.Done():
+				return
+			case req := <-fw.admin:
+				req.done <- fw.handleAdmin(ctx, req)
+			case <-dumps:
+				fw.log.Print(fw.dumpStats(time.Now()))
+			case <-summaries:
+				summary.log(summaryInterval, fw.assembler.Len())
+			case <-ticker.C:
+				waiting = false
+			}
+		}
+	}
+}
+
+// summaryLogger logs the counters' increase since the previous summary
+type summaryLogger struct {
+	logger                     *log.Logger
+	stats                      *forwarderStats
+	fetched, exported, dropped int64
+}
+
+func (l *summaryLogger) log(interval time.Duration, backlog int) {
+	fetched := l.stats.spansFetched.Load()
+	exported := l.stats.spansExported.Load()
+	dropped := l.stats.spansDropped()
+	l.logger.Printf("summary interval=%s fetched=%d exported=%d dropped=%d export_p95=%s backlog=%d",
+		interval, fetched-l.fetched, exported-l.exported, dropped-l.dropped,
+		l.stats.takeExportLatencyP95(), backlog)
+	l.fetched, l.exported, l.dropped = fetched, exported, dropped
+}
@@ -0,0 +1,29 @@
+package forwarder
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummaryLoggerDropped(t *testing.T) {
+	var logged bytes.Buffer
+	stats := &forwarderStats{}
+	summary := &summaryLogger{logger: log.New(&logged, "", 0), stats: stats}
+	for i, r := range stats.dropReasons() {
+		r.counter.Add(int64(i + 1))
+	}
+	summary.log(time.Minute, 0)
+	// Each drop reason is counted
+	if !strings.Contains(logged.String(), " dropped=15 ") {
+		t.Fatalf("unexpected summary %q", logged.String())
+	}
+	logged.Reset()
+	stats.spansBufferDropped.Add(2)
+	summary.log(time.Minute, 0)
+	if !strings.Contains(logged.String(), " dropped=2 ") {
+		t.Fatalf("unexpected summary %q", logged.String())
+	}
+}
@@ -0,0 +1,212 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// selftestTimeout bounds the wait for the sample query's spans, in
+// pg_tracing's buffer and in the receiver
+const selftestTimeout = 10 * time.Second
+
+// selftestReceiver is an OTLP trace receiver passing the received spans
+// to a channel
+type selftestReceiver struct {
+	collectortracepb.UnimplementedTraceServiceServer
+	spans chan *tracepb.Span
+}
+
+func (r *selftestReceiver) Export(ctx context.Context, req *collectortracepb.ExportTraceServiceRequest) (*collectortracepb.ExportTraceServiceResponse, error) {
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				select {
+				case r.spans <- span:
+				default:
+				}
+			}
+		}
+	}
+	return &collectortracepb.ExportTraceServiceResponse{}, nil
+}
+
+// startSelftestReceiver listens on a loopback port, returning the receiver's
+// endpoint
+func startSelftestReceiver(receiver *selftestReceiver) (*grpc.Server, string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen for the OTLP receiver: %w", err)
+	}
+	server := grpc.NewServer()
+	collectortracepb.RegisterTraceServiceServer(server, receiver)
+	go server.Serve(listener)
+	return server, listener.Addr().String(), nil
+}
+
+// runSampleQuery runs a query traced by pg_tracing, forcing its sampling
+// for the session. The marker is the query's column name, kept by the
+// query normalization.
+func runSampleQuery(ctx context.Context, conn *pgx.Conn, marker string) error {
+	if _, err := conn.Exec(ctx, "set pg_tracing.sample_rate = 1"); err != nil {
+		return fmt.Errorf("failed to force pg_tracing sampling: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "select 1 as "+marker); err != nil {
+		return fmt.Errorf("failed to run the sample query: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "reset pg_tracing.sample_rate"); err != nil {
+		return fmt.Errorf("failed to reset pg_tracing sampling: %w", err)
+	}
+	return nil
+}
+
+// sampleTraceRows waits for the spans of the sample query's trace, peeked so
+// the spans of other sessions are left to the forwarder
+func sampleTraceRows(ctx context.Context, conn *pgx.Conn, marker string) ([]*spanRow, error) {
+	columns, err := detectSpanColumns(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	query := newSpanQuery(columns, "pg_tracing_peek_spans", "", FetchConfig{})
+	deadline := time.Now().Add(selftestTimeout)
+	for {
+		rows, err := fetchSpanRows(ctx, conn, query)
+		if err != nil {
+			return nil, err
+		}
+		var traceId trace.TraceID
+		for _, r := range rows {
+			if isTopSpan(r.spanType) && strings.Contains(r.spanOperation, marker) {
+				traceId = r.traceID()
+			}
+		}
+		if traceId.IsValid() {
+			var traceRows []*spanRow
+			for _, r := range rows {
+				if r.traceID() == traceId {
+					traceRows = append(traceRows, r)
+				}
+			}
+			return traceRows, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("no span of the sample query after %s, check pg_tracing's buffer isn't full", selftestTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// exportSampleTrace exports the trace to the receiver and waits for all its
+// spans to be received
+func exportSampleTrace(ctx context.Context, cfg *Config, endpoint string, receiver *selftestReceiver, rows []*spanRow) error {
+	converter, err := newSpanConverter(cfg, nil)
+	if err != nil {
+		return err
+	}
+	exporter, err := newOtlpExporter(ctx, DefaultConfig().Collector, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	idGenerator := &FixedIdGenerator{}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("pg-tracing-selftest"))),
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithIDGenerator(idGenerator),
+	)
+	defer tp.Shutdown(ctx)
+	converter.exportSpans(ctx, tp.Tracer("pg-tracing-selftest"), idGenerator, [][]*spanRow{rows})
+
+	traceId := rows[0].traceID()
+	timeout := time.After(selftestTimeout)
+	for received := 0; received < len(rows); {
+		select {
+		case span := <-receiver.spans:
+			if bytes.Equal(span.TraceId, traceId[:]) {
+				received++
+			}
+		case <-timeout:
+			return fmt.Errorf("received %d of %d spans after %s", received, len(rows), selftestTimeout)
+		}
+	}
+	return nil
+}
+
+// selftestCommand traces a sample query and checks its spans go through the
+// conversion and export pipeline, to an in-process OTLP receiver
+func selftestCommand(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to the YAML configuration file")
+	target := fs.String("target", "", "Name of the target to test, the first one by default")
+	fs.Parse(args)
+
+	report := &validationReport{}
+	cfg, err := LoadConfig(*configPath)
+	if !report.check("configuration is valid", err) {
+		return fmt.Errorf("invalid configuration")
+	}
+	targets := cfg.targets()
+	t := targets[0]
+	if *target != "" {
+		found := false
+		for _, tc := range targets {
+			if tc.Name == *target {
+				t, found = tc, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown target %q", *target)
+		}
+	}
+	cfg = cfg.forTarget(t)
+
+	ctx := context.Background()
+	connector, err := newConnector(cfg.Connection, t.DSN)
+	if err != nil {
+		return err
+	}
+	defer connector.close()
+	conn, err := connector.connect(ctx)
+	if !report.check("database connection", err) {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+	defer conn.Close(ctx)
+	_, err = checkPgTracing(ctx, conn)
+	if !report.check("pg_tracing installed", err) {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+
+	marker := fmt.Sprintf("pg_tracing_selftest_%d", time.Now().UnixNano())
+	if !report.check("sample query traced", runSampleQuery(ctx, conn, marker)) {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+	rows, err := sampleTraceRows(ctx, conn, marker)
+	if !report.check("spans of the sample query read", err) {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+	fmt.Printf("       %d spans in trace %s\n", len(rows), rows[0].traceID())
+
+	receiver := &selftestReceiver{spans: make(chan *tracepb.Span, len(rows))}
+	server, endpoint, err := startSelftestReceiver(receiver)
+	if err != nil {
+		return err
+	}
+	defer server.Stop()
+	if !report.check("spans received by the OTLP receiver", exportSampleTrace(ctx, cfg, endpoint, receiver, rows)) {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const defaultServiceName = "PostgreSQL-server"
+
+// ServerInfo identifies the instance producing the spans
+type ServerInfo struct {
+	Version          string
+	VersionNum       int64
+	ClusterName      string
+	SystemIdentifier string
+	Database         string
+	Host             string
+}
+
+func fetchServerInfo(ctx context.Context, conn *pgx.Conn) (*ServerInfo, error) {
+	info := &ServerInfo{Database: conn.Config().Database}
+	var versionNum string
+	err := conn.QueryRow(ctx, `select version(),
+		current_setting('server_version_num'),
+		current_setting('cluster_name'),
+		current_database()`).Scan(&info.Version, &versionNum, &info.ClusterName, &info.Database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch server information: %w", err)
+	}
+	info.VersionNum, _ = strconv.ParseInt(versionNum, 10, 64)
+	if multiHost(conn.Config()) {
+		// The resource isn't updated when reconnecting to another host
+		log.Printf("The DSN lists several hosts, the host, cluster name and system identifier aren't part of the resource")
+		info.ClusterName = ""
+		return info, nil
+	}
+	if host, _, ok := activeHost(conn); ok {
+		info.Host = host
+	}
+
+	// The system identifier is stable across restarts and unique per cluster.
+	// pg_control_system is restricted to superusers unless granted.
+	err = conn.QueryRow(ctx, "select system_identifier::text from pg_control_system()").Scan(&info.SystemIdentifier)
+	if err != nil {
+		log.Printf("Couldn't read the system identifier, service.instance.id won't be set: %v", err)
+	}
+	return info, nil
+}
+
+// multiHost returns whether the DSN lists several hosts, the connection
+// following the one matching target_session_attrs
+func multiHost(cfg *pgx.ConnConfig) bool {
+	for _, fallback := range cfg.Fallbacks {
+		// TLS modes like prefer add fallbacks to the same host
+		if fallback.Host != cfg.Host || fallback.Port != cfg.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourceAttributes returns the resource attributes describing the server
+func (s *ServerInfo) ResourceAttributes() []attribute.KeyValue {
+	attributes := []attribute.KeyValue{attribute.String("db.version", s.Version)}
+	if s.VersionNum != 0 {
+		attributes = append(attributes, attribute.Int64("postgresql.server_version_num", s.VersionNum))
+	}
+	if s.ClusterName != "" {
+		attributes = append(attributes, attribute.String("postgresql.cluster_name", s.ClusterName))
+	}
+	if s.SystemIdentifier != "" {
+		attributes = append(attributes, semconv.ServiceInstanceID(s.SystemIdentifier))
+	}
+	return attributes
+}
+
+var serviceNamePlaceholder = regexp.MustCompile(`\{[a-z_]*\}`)
+
+var serviceNameFields = map[string]bool{
+	"{cluster_name}":      true,
+	"{database}":          true,
+	"{host}":              true,
+	"{system_identifier}": true,
+}
+
+func validateServiceNameTemplate(template string) error {
+	for _, placeholder := range serviceNamePlaceholder.FindAllString(template, -1) {
+		if !serviceNameFields[placeholder] {
+			return fmt.Errorf("unknown placeholder %s in service name template %q", placeholder, template)
+		}
+	}
+	return nil
+}
+
+// ServiceName renders the service name template with the server's
+// information. Separators left by empty fields are trimmed.
+func (s *ServerInfo) ServiceName(template string) string {
+	if template == "" {
+		return defaultServiceName
+	}
+	r := strings.NewReplacer(
+		"{cluster_name}", s.ClusterName,
+		"{database}", s.Database,
+		"{host}", s.Host,
+		"{system_identifier}", s.SystemIdentifier,
+	)
+	name := strings.Trim(r.Replace(template), "-_. ")
+	for _, sep := range []string{"--", "__", ".."} {
+		for strings.Contains(name, sep) {
+			name = strings.ReplaceAll(name, sep, sep[:1])
+		}
+	}
+	if name == "" {
+		return defaultServiceName
+	}
+	return name
+}
+
+// userResourceAttributes converts the configured resource attributes, sorted
+// by key
+func userResourceAttributes(cfg ResourceConfig) []attribute.KeyValue {
+	keys := make([]string, 0, len(cfg.Attributes))
+	for k := range cfg.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attributes := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		attributes = append(attributes, attribute.String(k, cfg.Attributes[k]))
+	}
+	return attributes
+}
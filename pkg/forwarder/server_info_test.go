@@ -0,0 +1,40 @@
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestMultiHost(t *testing.T) {
+	for _, tc := range []struct {
+		dsn   string
+		multi bool
+	}{
+		{"postgres://pg-1:5432/app?sslmode=disable", false},
+		// prefer falls back to a plain connection to the same host
+		{"postgres://pg-1:5432/app?sslmode=prefer", false},
+		{"postgres://pg-1:5432,pg-2:5432/app?sslmode=disable", true},
+		{"postgres://pg-1:5432,pg-1:5433/app?sslmode=disable", true},
+	} {
+		cfg, err := pgx.ParseConfig(tc.dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if multi := multiHost(cfg); multi != tc.multi {
+			t.Errorf("%s: multi-host %v, expected %v", tc.dsn, multi, tc.multi)
+		}
+	}
+}
+
+func TestServiceNameWithoutHost(t *testing.T) {
+	info := &ServerInfo{Database: "app"}
+	if name := info.ServiceName("postgres-{host}-{cluster_name}-{database}"); name != "postgres-app" {
+		t.Fatalf("unexpected service name %q", name)
+	}
+	for _, attr := range info.ResourceAttributes() {
+		if attr.Key == "postgresql.cluster_name" || attr.Key == "service.instance.id" {
+			t.Errorf("unexpected resource attribute %s", attr.Key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var pgTracingSettingName = regexp.MustCompile(`^pg_tracing\.[a-z_]+$`)
+
+func validatePgTracingSettings(settings map[string]string) error {
+	for name := range settings {
+		if !pgTracingSettingName.MatchString(name) {
+			return fmt.Errorf("invalid pg_tracing setting %q, expected pg_tracing.<name>", name)
+		}
+	}
+	return nil
+}
+
+// settingEqual compares a configured value with pg_settings', which
+// normalizes numbers and booleans
+func settingEqual(configured, current string) bool {
+	if strings.EqualFold(configured, current) {
+		return true
+	}
+	switch strings.ToLower(configured) {
+	case "true", "yes":
+		return current == "on"
+	case "false", "no":
+		return current == "off"
+	}
+	a, errA := strconv.ParseFloat(configured, 64)
+	b, errB := strconv.ParseFloat(current, 64)
+	return errA == nil && errB == nil && a == b
+}
+
+// checkSettings compares the pg_tracing settings with the configured ones,
+// setting the drifted ones with ALTER SYSTEM and reloading the configuration.
+// Backends, including the forwarder's, pick the new values after the reload.
+func (fw *targetForwarder) checkSettings(ctx context.Context) error {
+	settings := fw.cfg.PgTracingSettings
+	if len(settings) == 0 || fw.cfg.DryRun {
+		return nil
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows, err := fw.conn.Query(ctx, "select name, setting from pg_settings where name = any($1)", names)
+	if err != nil {
+		return fmt.Errorf("failed to read pg_tracing settings: %w", err)
+	}
+	current := make(map[string]string, len(names))
+	for rows.Next() {
+		var name, setting string
+		if err := rows.Scan(&name, &setting); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read pg_tracing settings: %w", err)
+		}
+		current[name] = setting
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read pg_tracing settings: %w", err)
+	}
+
+	var changed []string
+	for _, name := range names {
+		setting, ok := current[name]
+		if !ok {
+			return fmt.Errorf("unknown setting %s, is pg_tracing in shared_preload_libraries?", name)
+		}
+		if settingEqual(settings[name], setting) {
+			continue
+		}
+		// ALTER SYSTEM doesn't accept parameters
+		value := "'" + strings.ReplaceAll(settings[name], "'", "''") + "'"
+		if _, err := fw.conn.Exec(ctx, "alter system set "+name+" = "+value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+		changed = append(changed, fmt.Sprintf("%s=%s (was %s)", name, settings[name], setting))
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	if _, err := fw.conn.Exec(ctx, "select pg_reload_conf()"); err != nil {
+		return fmt.Errorf("failed to reload the configuration: %w", err)
+	}
+	fw.log.Printf("Set pg_tracing settings: %s", strings.Join(changed, ", "))
+	return nil
+}
@@ -0,0 +1,49 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+)
+
+func validateShardConfig(c *Config) error {
+	if c.Shard.Count < 0 {
+		return fmt.Errorf("shard count can't be negative")
+	}
+	if c.Shard.Count <= 1 {
+		return nil
+	}
+	if c.Shard.Index < 0 || c.Shard.Index >= c.Shard.Count {
+		return fmt.Errorf("shard index must be between 0 and %d", c.Shard.Count-1)
+	}
+	// Peeked spans are read again on each poll until dropped by pg_tracing
+	if c.Dedup.Size <= 0 {
+		return fmt.Errorf("sharded consumption requires dedup")
+	}
+	if c.HA.Mode != "" && c.HA.Mode != haNone {
+		return fmt.Errorf("sharded consumption can't be used with an ha mode")
+	}
+	return nil
+}
+
+// shardFilter returns the condition selecting the spans of the shard, by
+// trace so traces aren't split across forwarders
+func shardFilter(cfg ShardConfig) string {
+	if cfg.Count <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("(hashtext(trace_id::text) & 2147483647) %% %d = %d", cfg.Count, cfg.Index)
+}
+
+// checkBufferMode warns when pg_tracing keeps its spans once its buffer is
+// full, as peeked spans would never be cleared
+func (fw *targetForwarder) checkBufferMode(ctx context.Context) {
+	var mode *string
+	err := fw.conn.QueryRow(ctx, "select current_setting('pg_tracing.buffer_mode', true)").Scan(&mode)
+	if err != nil {
+		fw.log.Printf("Failed to read pg_tracing.buffer_mode: %v", err)
+		return
+	}
+	if mode == nil || *mode != "drop_on_full" {
+		fw.log.Printf("Warning: sharded consumption peeks spans without consuming them, pg_tracing.buffer_mode should be drop_on_full for pg_tracing to clear its buffer")
+	}
+}
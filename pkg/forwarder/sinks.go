@@ -0,0 +1,44 @@
+package forwarder
+
+import (
+	"log"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanSink receives the raw span rows of exported traces, for sinks
+// needing more than what's carried by OTel spans
+type spanSink interface {
+	Write(rows []*spanRow) error
+	Close() error
+}
+
+func newSpanSinks(cfg SinksConfig) ([]spanSink, error) {
+	var sinks []spanSink
+	if cfg.Parquet.Directory != "" {
+		sink, err := newParquetSink(cfg.Parquet)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+func closeSpanSinks(sinks []spanSink) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("Failed to close span sink: %v", err)
+		}
+	}
+}
+
+// newSinkExporters creates the sinks receiving the converted spans, in
+// addition to the exporter
+func newSinkExporters(cfg SinksConfig) []sdktrace.SpanExporter {
+	var exporters []sdktrace.SpanExporter
+	if cfg.ClickHouse.Endpoint != "" {
+		exporters = append(exporters, newClickHouseExporter(cfg.ClickHouse))
+	}
+	return exporters
+}
@@ -0,0 +1,377 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanConverter holds the settings used to turn pg_tracing rows into spans
+type spanConverter struct {
+	filter       *AttributeFilter
+	limits       LimitsConfig
+	spanNames    *SpanNameTemplates
+	spanKinds    map[string]trace.SpanKind
+	relabelRules []relabelRule
+	statements   []*OttlStatement
+	dbAttributes []attribute.KeyValue
+	orphanMode   string
+	subxactMode  string
+	// workers is the number of goroutines converting spans
+	workers      int
+	transformers []SpanTransformer
+	// columns are the mapped columns exported as attributes
+	columns []columnMapping
+	// stats counts the failed statements, not set outside of a forwarder
+	stats *forwarderStats
+}
+
+const metricStatementErrors = "pg_tracing.forwarder.statement_errors"
+
+// initStatementMetric reports the transform statements failing on a span
+func (fw *targetForwarder) initStatementMetric(meter metric.Meter) error {
+	_, err := meter.Int64ObservableCounter(metricStatementErrors,
+		metric.WithDescription("Transform statements failing on a span"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			o.Observe(fw.stats.statementsFailed.Load())
+			return nil
+		}))
+	if err != nil {
+		return fmt.Errorf("failed to create statement errors counter: %w", err)
+	}
+	return nil
+}
+
+// spanData is the in-progress representation of a span, before it's started
+type spanData struct {
+	name          string
+	kind          trace.SpanKind
+	attributes    []attribute.KeyValue
+	statusCode    codes.Code
+	statusMessage string
+	events        []spanEvent
+	links         []trace.Link
+}
+
+// spanAttributesCap is the initial capacity of the attribute slices, enough
+// for a span with all attribute families
+const spanAttributesCap = 64
+
+// spanDataPool reuses the spans' representations and their attribute slices
+// once the spans are started, the SDK copying the attributes
+var spanDataPool = sync.Pool{
+	New: func() any {
+		return &spanData{attributes: make([]attribute.KeyValue, 0, spanAttributesCap)}
+	},
+}
+
+func newSpanData() *spanData {
+	return spanDataPool.Get().(*spanData)
+}
+
+// release returns the span data to the pool, it can't be used afterwards
+func (d *spanData) release() {
+	clear(d.attributes)
+	*d = spanData{attributes: d.attributes[:0]}
+	spanDataPool.Put(d)
+}
+
+func traceIdOf(high, low int64) trace.TraceID {
+	var traceId trace.TraceID
+	binary.BigEndian.PutUint64(traceId[0:8], uint64(high))
+	binary.BigEndian.PutUint64(traceId[8:16], uint64(low))
+	return traceId
+}
+
+// traceID returns the row's full trace id, identifying its trace
+func (r *spanRow) traceID() trace.TraceID {
+	return traceIdOf(r.traceId, r.traceIdLow)
+}
+
+func spanIdOf(id int64) trace.SpanID {
+	var spanId trace.SpanID
+	binary.BigEndian.PutUint64(spanId[0:8], uint64(id))
+	return spanId
+}
+
+type spanEvent struct {
+	name       string
+	timestamp  time.Time
+	attributes []attribute.KeyValue
+}
+
+func newSpanConverter(cfg *Config, conn *pgx.Conn) (*spanConverter, error) {
+	filter, err := newAttributeFilter(cfg.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	spanNames, err := newSpanNameTemplates(cfg.SpanNames)
+	if err != nil {
+		return nil, err
+	}
+	spanKinds, err := parseSpanKinds(cfg.SpanKinds)
+	if err != nil {
+		return nil, err
+	}
+	relabelRules, err := newRelabelRules(cfg.Relabel)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := newColumnMappings(cfg.Columns)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := newOttlStatements(cfg.Transform.Statements)
+	if err != nil {
+		return nil, err
+	}
+	wasm, err := wasmSpanTransformers(cfg.Transform.Wasm)
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := luaSpanTransformers(cfg.Transform.Lua)
+	if err != nil {
+		return nil, err
+	}
+	plugins, err := pluginTransformers(cfg.Plugins)
+	if err != nil {
+		return nil, err
+	}
+	// WASM modules and Lua scripts run first, followed by the transformers
+	// registered through the library and by plugins
+	registered := append(append(append(wasm, scripts...), cfg.SpanTransformers...), plugins...)
+	transformers, err := newSpanTransformers(cfg.Transform.Transformers, registered)
+	if err != nil {
+		return nil, err
+	}
+	// Spans are converted without connection by the bench subcommand
+	dbAttributes := []attribute.KeyValue{semconv.DBSystemPostgreSQL}
+	if conn != nil {
+		dbAttributes = connectionAttributes(conn)
+	}
+	return &spanConverter{
+		filter:       filter,
+		limits:       cfg.Limits,
+		spanNames:    spanNames,
+		spanKinds:    spanKinds,
+		relabelRules: relabelRules,
+		statements:   statements,
+		dbAttributes: dbAttributes,
+		orphanMode:   cfg.Orphans,
+		subxactMode:  cfg.Subtransactions,
+		workers:      cfg.ConversionWorkers,
+		transformers: transformers,
+		columns:      columns,
+	}, nil
+}
+
+// spanBatch is a set of spans consumed together
+type spanBatch struct {
+	rows     []*spanRow
+	spanIds  map[int64]bool
+	bySpanId map[int64]*spanRow
+	// synthetic holds the placeholder spans created for missing parents
+	synthetic map[int64]bool
+	// subxactEvents holds the subtransaction boundaries per parent span
+	subxactEvents map[int64][]spanEvent
+	// links holds the links to parallel worker spans per gather span
+	links map[int64][]trace.Link
+}
+
+func newSpanBatch(rows []*spanRow) *spanBatch {
+	b := &spanBatch{
+		rows:          rows,
+		spanIds:       make(map[int64]bool, len(rows)),
+		bySpanId:      make(map[int64]*spanRow, len(rows)),
+		synthetic:     make(map[int64]bool),
+		subxactEvents: make(map[int64][]spanEvent),
+		links:         make(map[int64][]trace.Link),
+	}
+	for _, r := range rows {
+		b.spanIds[r.spanId] = true
+		b.bySpanId[r.spanId] = r
+	}
+	return b
+}
+
+// hasRemoteParent returns true if the span's parent wasn't produced by
+// pg_tracing: it's an application span propagated with traceparent.
+func (b *spanBatch) hasRemoteParent(r *spanRow) bool {
+	return r.parentId != 0 && !b.spanIds[r.parentId]
+}
+
+// buildAttributes appends the span's attributes to attributes
+func (c *spanConverter) buildAttributes(attributes []attribute.KeyValue, r *spanRow, batch *spanBatch) []attribute.KeyValue {
+	attributes = append(attributes, c.dbAttributes...)
+	if r.dbName != "" {
+		attributes = append(attributes, semconv.DBName(r.dbName))
+	}
+	if r.userName != "" {
+		attributes = append(attributes, semconv.DBUser(r.userName))
+	}
+	if isTopSpan(r.spanType) {
+		attributes = append(attributes, semconv.DBStatement(r.spanOperation))
+	}
+	if r.statementStats != nil {
+		attributes = r.statementStats.appendAttributes(attributes)
+	}
+	if r.deparseInfo.Valid && r.deparseInfo.String != "" {
+		attributes = append(attributes, attribute.String("db.postgresql.deparse_info", r.deparseInfo.String))
+	}
+	attributes = c.appendColumnAttributes(attributes, r)
+	if c.filter.Enabled(familyProcess) {
+		attributes = append(attributes, attribute.Int("pid", int(r.pid)))
+		attributes = append(attributes, attribute.Int("subxact_count", int(r.subxactCount)))
+	}
+	if c.filter.Enabled(familyPlan) {
+		attributes = append(attributes, batch.planNodeAttributes(r)...)
+	}
+
+	malformed := r.malformed
+	if c.filter.Enabled(familyParameters) && r.parameters.Valid {
+		var ok bool
+		if attributes, ok = parameterAttributes(attributes, r.parameters.String); !ok {
+			malformed = append(malformed[:len(malformed):len(malformed)], "parameters")
+		}
+	}
+	if len(malformed) > 0 {
+		attributes = append(attributes, attribute.StringSlice(malformedKey, malformed))
+	}
+
+	if isSqlError(r.sqlErrorCode) {
+		attributes = append(attributes, attribute.String("db.response.status_code", r.sqlErrorCode))
+	}
+	for _, column := range r.extra {
+		if isMapped(c.columns, column.name) {
+			continue
+		}
+		if kv, ok := column.attribute(); ok {
+			attributes = append(attributes, kv)
+		}
+	}
+	return attributes
+}
+
+// convert builds the span representation of a row, running the relabeling,
+// transform and truncation stages. It returns nil when a transformer drops
+// the span.
+func (c *spanConverter) convert(r *spanRow, batch *spanBatch) *spanData {
+	data := newSpanData()
+	data.name = c.spanNames.Name(r.spanType, r.spanOperation, r.deparseInfo.String)
+	data.kind = c.spanKind(r.spanType, batch.hasRemoteParent(r))
+	data.attributes = applyRelabelRules(c.relabelRules, c.buildAttributes(data.attributes, r, batch))
+	data.links = batch.links[r.spanId]
+	if c.orphanMode != orphanNone && (batch.isOrphan(r) || batch.synthetic[r.parentId]) {
+		data.attributes = append(data.attributes, attribute.Bool(orphanKey, true))
+	}
+	if isSqlError(r.sqlErrorCode) {
+		data.statusCode = codes.Error
+		data.statusMessage = sqlStateMessage(r.sqlErrorCode)
+	}
+	if r.startup.Valid && r.startup.Int64 > 0 {
+		data.events = append(data.events, spanEvent{
+			name:      "first tuple",
+			timestamp: r.startTime().Add(time.Duration(r.startup.Int64)),
+		})
+	}
+	switch c.subxactMode {
+	case subxactEvents:
+		data.events = append(data.events, batch.subxactEvents[r.spanId]...)
+	case subxactAttributes:
+		if action, savepoint, ok := subxactBoundary(r); ok {
+			data.attributes = append(data.attributes, savepointAttributes(action, savepoint)...)
+		}
+	}
+	for _, stmt := range c.statements {
+		if err := stmt.Execute(data); err != nil && c.stats != nil {
+			c.stats.statementsFailed.Add(1)
+		}
+	}
+	if !transform(c.transformers, r, data) {
+		data.release()
+		return nil
+	}
+	data.name, data.attributes = c.limits.apply(data.name, data.attributes)
+	return data
+}
+
+func (c *spanConverter) exportSpan(ctx context.Context, tracer trace.Tracer, f *FixedIdGenerator, r *spanRow, batch *spanBatch, data *spanData) {
+	startOptions := make([]trace.SpanStartOption, 0, 5)
+	startOptions = append(startOptions,
+		trace.WithTimestamp(r.startTime()),
+		trace.WithAttributes(data.attributes...),
+		trace.WithSpanKind(data.kind),
+		trace.WithLinks(data.links...),
+	)
+
+	psc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    r.traceID(),
+		SpanID:     spanIdOf(r.parentId),
+		TraceFlags: trace.FlagsSampled,
+		Remote:     batch.hasRemoteParent(r),
+	})
+	switch {
+	case r.parentId == 0:
+		// No parent, the span is a local root and its trace id comes
+		// from the generator
+		startOptions = append(startOptions, trace.WithNewRoot())
+	case psc.IsRemote():
+		// The parent is an application span propagated through traceparent
+		ctx = trace.ContextWithRemoteSpanContext(ctx, psc)
+	default:
+		ctx = trace.ContextWithSpanContext(ctx, psc)
+	}
+
+	// Modify the fixed IDs generator before starting the span
+	f.FixedTraceID = r.traceID()
+	f.FixedSpanID = spanIdOf(r.spanId)
+	_, span := tracer.Start(ctx, data.name, startOptions...)
+	if data.statusCode != codes.Unset {
+		span.SetStatus(data.statusCode, data.statusMessage)
+	}
+	for _, event := range data.events {
+		span.AddEvent(event.name, trace.WithTimestamp(event.timestamp), trace.WithAttributes(event.attributes...))
+	}
+	// End the span
+	span.End(trace.WithTimestamp(r.endTime()))
+	data.release()
+}
+
+// prepareBatch builds the batch of a trace's rows, starting the synthetic
+// spans of missing parents
+func (c *spanConverter) prepareBatch(ctx context.Context, tracer trace.Tracer, f *FixedIdGenerator, rows []*spanRow) *spanBatch {
+	batch := newSpanBatch(rows)
+	c.handleOrphans(ctx, tracer, f, batch)
+	if c.subxactMode == subxactEvents {
+		batch.collectSubxactEvents()
+	}
+	batch.collectWorkerLinks()
+	return batch
+}
+
+// exportSpans converts the traces' spans concurrently, then starts them
+// trace by trace in order. Spans are started sequentially as the id
+// generator is shared.
+func (c *spanConverter) exportSpans(ctx context.Context, tracer trace.Tracer, f *FixedIdGenerator, traces [][]*spanRow) {
+	batches := make([]*spanBatch, len(traces))
+	for i, rows := range traces {
+		batches[i] = c.prepareBatch(ctx, tracer, f, rows)
+	}
+	converted := c.convertBatches(batches)
+	for i, batch := range batches {
+		for j, r := range batch.rows {
+			if converted[i][j] != nil {
+				c.exportSpan(ctx, tracer, f, r, batch, converted[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+)
+
+func BenchmarkConvert(b *testing.B) {
+	converter, err := newSpanConverter(DefaultConfig(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rows := benchTrace(1, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	batch := newSpanBatch(rows)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range rows {
+			if data := converter.convert(r, batch); data != nil {
+				data.release()
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*len(rows))/b.Elapsed().Seconds(), "spans/s")
+}
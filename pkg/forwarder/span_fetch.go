@@ -0,0 +1,608 @@
+package forwarder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type BlockStats struct {
+	hit     sql.NullInt64
+	read    sql.NullInt64
+	written sql.NullInt64
+	dirtied sql.NullInt64
+}
+
+type BlockTime struct {
+	readTime  sql.NullFloat64
+	writeTime sql.NullFloat64
+}
+
+// spanRow is a span as returned by pg_tracing
+type spanRow struct {
+	// traceId holds the high 64 bits of the trace id and traceIdLow the
+	// low ones, only set by 128-bit hex trace ids. Traces are identified
+	// by both, see traceID.
+	traceId    int64
+	traceIdLow int64
+	parentId   int64
+	spanId     int64
+
+	spanType      string
+	spanOperation string
+	deparseInfo   sql.NullString
+	parameters    sql.NullString
+	spanStart     time.Time
+	// Older pg_tracing versions provide a start offset and a duration
+	// instead of span_end
+	spanStartNs sql.NullInt32
+	duration    sql.NullInt64
+	spanEnd     *time.Time
+
+	startup      sql.NullInt64
+	pid          int32
+	subxactCount int32
+	sqlErrorCode string
+	rows         sql.NullInt64
+
+	planStartupCost sql.NullFloat64
+	planTotalCost   sql.NullFloat64
+	planRows        sql.NullFloat64
+	planWidth       sql.NullInt64
+
+	sharedBlks  BlockStats
+	localBlks   BlockStats
+	blkTime     BlockTime
+	tempBlks    BlockStats
+	tempBlkTime BlockTime
+
+	walRecords sql.NullInt64
+	walFpi     sql.NullInt64
+	walBytes   sql.NullInt64
+
+	jitFunctions        sql.NullInt64
+	jitGenerationTime   sql.NullFloat64
+	jitInliningTime     sql.NullFloat64
+	jitOptimizationTime sql.NullFloat64
+	jitEmissionTime     sql.NullFloat64
+
+	// Optional columns, depending on the pg_tracing version
+	queryId sql.NullInt64
+	dbId    *uint32
+	userId  *uint32
+
+	// Names resolved from the OIDs
+	dbName   string
+	userName string
+
+	// Filled from pg_stat_statements when enabled
+	statementStats *statementStats
+	// extra holds the columns selected by a configured fetch query
+	extra []extraColumn
+	// malformed lists the columns whose value couldn't be read
+	malformed []string
+}
+
+// durationUnit is the unit of the duration column of the pg_tracing
+// versions without span_end
+const durationUnit = time.Microsecond
+
+// startTime adds the span_start_ns offset, in nanoseconds, of the
+// pg_tracing versions providing it
+func (r *spanRow) startTime() time.Time {
+	return r.spanStart.Add(time.Duration(r.spanStartNs.Int32) * time.Nanosecond)
+}
+
+// endTime uses span_end when available, and otherwise adds the duration to
+// the start. Timestamps have pg_tracing's microsecond precision.
+func (r *spanRow) endTime() time.Time {
+	if r.spanEnd != nil {
+		return *r.spanEnd
+	}
+	return r.startTime().Add(time.Duration(r.duration.Int64) * durationUnit)
+}
+
+// spanIdColumns are selected first, with the expressions of their types
+const spanIdColumns = "trace_id, parent_id, span_id"
+
+var spanIdColumnNames = []string{"trace_id", "parent_id", "span_id"}
+
+const spanColumns = `
+		` + spanIdColumns + `,
+
+		span_type, span_operation, deparse_info, parameters,
+		span_start,
+
+		startup,
+		pid, subxact_count,
+		sql_error_code,
+		rows,
+
+		plan_startup_cost, plan_total_cost, plan_rows, plan_width,
+
+		shared_blks_hit, shared_blks_read, shared_blks_dirtied, shared_blks_written,
+		local_blks_hit, local_blks_read, local_blks_dirtied, local_blks_written,
+		blk_read_time, blk_write_time,
+		temp_blks_read, temp_blks_written, temp_blk_read_time, temp_blk_write_time,
+
+		wal_records, wal_fpi, wal_bytes,
+		jit_functions, jit_generation_time, jit_inlining_time, jit_optimization_time, jit_emission_time`
+
+// optionalColumn is a column only selected when the installed pg_tracing
+// provides it
+type optionalColumn struct {
+	name   string
+	target func(r *spanRow) any
+}
+
+var optionalColumns = []optionalColumn{
+	{"span_end", func(r *spanRow) any { return &r.spanEnd }},
+	{"span_start_ns", func(r *spanRow) any { return &r.spanStartNs }},
+	{"duration", func(r *spanRow) any { return &r.duration }},
+	{"query_id", func(r *spanRow) any { return &r.queryId }},
+	{"dbid", func(r *spanRow) any { return &r.dbId }},
+	{"userid", func(r *spanRow) any { return &r.userId }},
+}
+
+// spanQuery is the consume query, built from the available columns
+type spanQuery struct {
+	sql      string
+	optional []optionalColumn
+	// statement is the name of the prepared query, empty when not prepared
+	statement string
+	// selectAll selects all the columns, scanned by name
+	selectAll bool
+	// logInterval logs one fetched span out of logInterval, and the query,
+	// at debug level. Nothing is logged when zero.
+	logInterval int
+	logged      int
+}
+
+// detectSpanColumns returns the types of the columns returned by
+// pg_tracing_consume_spans, from the catalog so no span is consumed
+func detectSpanColumns(ctx context.Context, conn *pgx.Conn) (map[string]string, error) {
+	rows, err := conn.Query(ctx, `select attname::text, format_type(atttypid, null) from pg_attribute
+		where attrelid = to_regclass('pg_tracing_consume_spans') and attnum > 0 and not attisdropped
+		union
+		select u.name, format_type(u.type, null) from pg_proc p, unnest(p.proargnames, p.proargmodes, p.proallargtypes) as u(name, mode, type)
+		where p.proname = 'pg_tracing_consume_spans' and u.mode in ('o', 't')`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect pg_tracing columns: %w", err)
+	}
+	res := make(map[string]string)
+	var name, typ string
+	_, err = pgx.ForEachRow(rows, []any{&name, &typ}, func() error {
+		res[name] = typ
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect pg_tracing columns: %w", err)
+	}
+	return res, nil
+}
+
+// newSpanQuery builds the query reading spans from source, either
+// pg_tracing_consume_spans or pg_tracing_peek_spans, with an optional filter.
+// A configured query template replaces the default query.
+func newSpanQuery(columns map[string]string, source string, filter string, fetch FetchConfig) *spanQuery {
+	q := &spanQuery{selectAll: fetch.SelectAll}
+	ids := make([]string, len(spanIdColumnNames))
+	for i, column := range spanIdColumnNames {
+		ids[i] = idExpression(column, columns[column])
+	}
+	selected := strings.Replace(spanColumns, spanIdColumns, strings.Join(ids, ", "), 1)
+	for _, column := range optionalColumns {
+		if columns[column.name] != "" {
+			q.optional = append(q.optional, column)
+			selected += ",\n\t\t" + column.name
+		}
+	}
+	if q.selectAll {
+		selected = "*"
+	}
+	if template := fetch.Query; template != "" {
+		q.sql = renderFetchQuery(template, selected, source, filter)
+		return q
+	}
+	q.sql = "select " + selected + "\n\n\t\tfrom " + source
+	if filter != "" {
+		q.sql += " where " + filter
+	}
+	q.sql += " order by span_start;"
+	return q
+}
+
+// spanStatement is the name of the prepared span query
+const spanStatement = "pg_tracing_spans"
+
+// prepare creates the span query's prepared statement on the connection,
+// so it's parsed and planned once and its rows are sent in binary format
+func (q *spanQuery) prepare(ctx context.Context, conn *pgx.Conn) error {
+	q.statement = ""
+	if _, err := conn.Prepare(ctx, spanStatement, q.sql); err != nil {
+		return fmt.Errorf("failed to prepare the span query: %w", err)
+	}
+	q.statement = spanStatement
+	return nil
+}
+
+func (q *spanQuery) hasColumn(name string) bool {
+	for _, column := range q.optional {
+		if column.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *spanQuery) scanSpanRow(rows pgx.Rows) (*spanRow, error) {
+	r := &spanRow{}
+	targets := []any{r.traceIdTarget(), r.idTarget("parent_id", &r.parentId), r.idTarget("span_id", &r.spanId),
+		&r.spanType, &r.spanOperation, &r.deparseInfo, &r.parameters,
+		&r.spanStart,
+		&r.startup, &r.pid, &r.subxactCount, &r.sqlErrorCode, &r.rows,
+		&r.planStartupCost, &r.planTotalCost, &r.planRows, &r.planWidth,
+		&r.sharedBlks.hit, &r.sharedBlks.read, &r.sharedBlks.dirtied, &r.sharedBlks.written,
+		&r.localBlks.hit, &r.localBlks.read, &r.localBlks.dirtied, &r.localBlks.written,
+		&r.blkTime.readTime, &r.blkTime.writeTime,
+
+		&r.tempBlks.read, &r.tempBlks.written,
+		&r.tempBlkTime.readTime, &r.tempBlkTime.writeTime,
+
+		&r.walRecords, &r.walFpi, &r.walBytes,
+		&r.jitFunctions, &r.jitGenerationTime, &r.jitInliningTime, &r.jitOptimizationTime, &r.jitEmissionTime}
+	for _, column := range q.optional {
+		targets = append(targets, column.target(r))
+	}
+	// Columns selected after the scanned ones by a configured query
+	fields := rows.FieldDescriptions()
+	scanned := len(targets)
+	for i := scanned; i < len(fields); i++ {
+		targets = append(targets, new(any))
+	}
+	if err := rows.Scan(targets...); err != nil {
+		return r, err
+	}
+	for i := scanned; i < len(targets); i++ {
+		r.extra = append(r.extra, extraColumn{name: fields[i].Name, value: *targets[i].(*any)})
+	}
+	return r, nil
+}
+
+func fetchSpanRows(ctx context.Context, conn *pgx.Conn, q *spanQuery) ([]*spanRow, error) {
+	if q.logInterval > 0 {
+		log.Printf("Query: %s", q.sql)
+	}
+	query := q.sql
+	if q.statement != "" {
+		query = q.statement
+	}
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume spans: %w", err)
+	}
+	return q.collectSpanRows(rows)
+}
+
+func (q *spanQuery) collectSpanRows(rows pgx.Rows) ([]*spanRow, error) {
+	defer rows.Close()
+	var spanRows []*spanRow
+	var targets []func(r *spanRow) any
+	if q.selectAll {
+		var err error
+		if targets, err = genericTargets(rows.FieldDescriptions()); err != nil {
+			return nil, err
+		}
+	}
+	for rows.Next() {
+		var r *spanRow
+		var err error
+		if q.selectAll {
+			r, err = scanGenericRow(rows, targets)
+		} else {
+			r, err = q.scanSpanRow(rows)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan span: %w", err)
+		}
+		if q.logInterval > 0 && q.logged%q.logInterval == 0 {
+			log.Printf("traceId: %s, parentId: %d, spanId: %d, span_operation: %s, start: %s, end: %s",
+				r.traceID(), r.parentId, r.spanId, r.spanOperation, r.startTime(), r.endTime())
+		}
+		q.logged++
+		spanRows = append(spanRows, r)
+	}
+	return spanRows, rows.Err()
+}
+
+// streamSpanRows reads the spans through a server-side cursor, passing them
+// to handle by chunks of chunkSize rows, so a large backlog isn't held in
+// memory at once. Each chunk is handled in a savepoint rolled back
+// afterwards: a failed query of handle doesn't abort the cursor.
+func streamSpanRows(ctx context.Context, conn *pgx.Conn, q *spanQuery, chunkSize int, handle func(spanRows []*spanRow)) error {
+	if q.logInterval > 0 {
+		log.Printf("Query: %s", q.sql)
+	}
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start the span cursor transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "declare spans no scroll cursor for "+strings.TrimSuffix(q.sql, ";")); err != nil {
+		return fmt.Errorf("failed to consume spans: %w", err)
+	}
+	fetch := fmt.Sprintf("fetch forward %d from spans", chunkSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return fmt.Errorf("failed to fetch spans from cursor: %w", err)
+		}
+		spanRows, err := q.collectSpanRows(rows)
+		if err != nil {
+			return err
+		}
+		if len(spanRows) == 0 {
+			break
+		}
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create savepoint: %w", err)
+		}
+		handle(spanRows)
+		if err := savepoint.Rollback(ctx); err != nil {
+			return fmt.Errorf("failed to roll back savepoint: %w", err)
+		}
+		if len(spanRows) < chunkSize {
+			break
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to close the span cursor: %w", err)
+	}
+	return nil
+}
+
+// targetForwarder consumes spans from pg_tracing and exports them
+type targetForwarder struct {
+	// name is the polled target's, empty for the DATABASE_URL instance
+	name        string
+	log         *log.Logger
+	conn        *pgx.Conn
+	tracer      trace.Tracer
+	idGenerator *FixedIdGenerator
+	converter   *spanConverter
+	assembler   *traceAssembler
+	dedup       *dedupCache
+	query       *spanQuery
+	clock       ClockConfig
+	clockLog    clockDropLog
+	stats       *forwarderStats
+	metrics     *forwarderMetrics
+	// tracingInfo is set when pg_tracing_info is available
+	tracingInfo *tracingInfoMetrics
+	// pgStatStatements is set when spans are enriched from pg_stat_statements
+	pgStatStatements bool
+	databases        *oidNameCache
+	roles            *oidNameCache
+	sinks            []spanSink
+	// recent keeps the last exported traces for the web UI
+	recent  *traceStore
+	started time.Time
+	// cfg is the applied configuration, replaced on reload
+	cfg *Config
+	// paused stops consumption until resumed through the admin API
+	paused atomic.Bool
+	admin  chan adminRequest
+	// stopped is closed when the run loop returns
+	stopped chan struct{}
+	// lastPoll is the time of the last span fetch
+	lastPoll time.Time
+	// lock is set when replicas elect the one consuming spans
+	lock        consumerLock
+	lockChecked bool
+	leader      atomic.Bool
+	// throttled is set while backpressure pauses consumption
+	throttled bool
+	// connector reopens the connection when lost, reusing the DSN's
+	// configuration when not set
+	connector *connector
+}
+
+func newForwarder(ctx context.Context, cfg *Config, conn *pgx.Conn, tracer trace.Tracer, meter metric.Meter, idGenerator *FixedIdGenerator, stats *forwarderStats) (*targetForwarder, error) {
+	converter, err := newSpanConverter(cfg, conn)
+	if err != nil {
+		return nil, err
+	}
+	converter.stats = stats
+	metrics, err := newForwarderMetrics(meter, cfg.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	logger := targetLogger(cfg.Target)
+	columns, adapter, err := spanSchema(ctx, conn, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Printf("Reading spans with the %s", describeAdapter(adapter))
+	sinks, err := newSpanSinks(cfg.Sinks)
+	if err != nil {
+		return nil, err
+	}
+	source := "pg_tracing_consume_spans"
+	// Consuming would drop the spans of the other shards
+	if cfg.DryRun || cfg.Shard.Count > 1 {
+		source = "pg_tracing_peek_spans"
+	}
+	fw := &targetForwarder{
+		name:        cfg.Target,
+		log:         logger,
+		conn:        conn,
+		tracer:      tracer,
+		idGenerator: idGenerator,
+		converter:   converter,
+		assembler:   newTraceAssembler(cfg.TraceAssembly.Window, cfg.Buffer),
+		query:       newSpanQuery(columns, source, shardFilter(cfg.Shard), cfg.Fetch),
+		clock:       cfg.Clock,
+		stats:       stats,
+		metrics:     metrics,
+		databases:   newOidNameCache("select oid, datname::text from pg_database", cfg.OidCache.RefreshInterval, false),
+		roles:       newOidNameCache("select oid, rolname::text from pg_roles", cfg.OidCache.RefreshInterval, true),
+		sinks:       sinks,
+		recent:      newTraceStore(webUITraces),
+		started:     time.Now(),
+		cfg:         cfg,
+		admin:       make(chan adminRequest),
+		stopped:     make(chan struct{}),
+	}
+	fw.query.logInterval = spanLogInterval(cfg)
+	if err := fw.query.prepare(ctx, conn); err != nil {
+		fw.log.Printf("Span query is not prepared: %v", err)
+	}
+	if cfg.PgStatStatements {
+		if fw.query.hasColumn("query_id") {
+			fw.pgStatStatements = true
+		} else {
+			fw.log.Printf("pg_tracing doesn't expose query_id, pg_stat_statements correlation is disabled")
+		}
+	}
+	if cfg.Dedup.Size > 0 {
+		fw.dedup = newDedupCache(cfg.Dedup.Size, cfg.Dedup.TTL)
+	}
+	// Peeking spans doesn't conflict with the consuming replica
+	if !cfg.DryRun {
+		if fw.lock, err = newConsumerLock(cfg, conn); err != nil {
+			return nil, err
+		}
+	}
+	if fw.lock != nil {
+		if err := fw.initLeaderMetric(meter); err != nil {
+			return nil, err
+		}
+	}
+	if err := fw.initDropMetric(meter); err != nil {
+		return nil, err
+	}
+	if err := fw.initStatementMetric(meter); err != nil {
+		return nil, err
+	}
+	if cfg.Shard.Count > 1 && !cfg.DryRun {
+		fw.checkBufferMode(ctx)
+	}
+	if err := fw.initTracingInfo(ctx, meter); err != nil {
+		fw.log.Printf("pg_tracing statistics and dropped span detection are disabled: %v", err)
+	}
+	return fw, nil
+}
+
+func (fw *targetForwarder) export(ctx context.Context, traces [][]*spanRow) {
+	now := time.Now()
+	fw.converter.exportSpans(ctx, fw.tracer, fw.idGenerator, traces)
+	for _, traceRows := range traces {
+		fw.metrics.record(ctx, traceRows, now)
+		fw.stats.spansExported.Add(int64(len(traceRows)))
+		for _, r := range traceRows {
+			if isSqlError(r.sqlErrorCode) {
+				fw.stats.spansErrored.Add(1)
+			}
+		}
+		fw.recent.add(traceRows, now)
+		for _, sink := range fw.sinks {
+			if err := sink.Write(traceRows); err != nil {
+				fw.log.Printf("Failed to write spans to sink: %v", err)
+			}
+		}
+	}
+}
+
+// fetchSpans consumes available spans and exports the traces ready for
+// export. Nothing is consumed by standby replicas.
+func (fw *targetForwarder) fetchSpans(ctx context.Context) error {
+	if !fw.holdsLock(ctx) {
+		return nil
+	}
+	if err := fw.checkSettings(ctx); err != nil {
+		fw.log.Printf("Failed to check pg_tracing settings: %v", err)
+	}
+	fw.lastPoll = time.Now()
+	if chunkSize := fw.cfg.Fetch.ChunkSize; chunkSize > 0 {
+		fetched := 0
+		err := streamSpanRows(ctx, fw.conn, fw.query, chunkSize, func(spanRows []*spanRow) {
+			fetched += len(spanRows)
+			fw.addSpans(ctx, spanRows)
+			// Traces completed earlier in the stream are exported without
+			// waiting for the end of the backlog
+			fw.export(ctx, fw.assembler.ReadyBefore(spanRows[len(spanRows)-1].startTime()))
+		})
+		if err != nil {
+			return err
+		}
+		fw.updateTracingInfo(ctx, fetched)
+		fw.export(ctx, fw.assembler.Ready(time.Now()))
+		return nil
+	}
+	spanRows, err := fetchSpanRows(ctx, fw.conn, fw.query)
+	if err != nil {
+		return err
+	}
+	fw.addSpans(ctx, spanRows)
+	fw.updateTracingInfo(ctx, len(spanRows))
+	fw.export(ctx, fw.assembler.Ready(time.Now()))
+	return nil
+}
+
+// addSpans enriches and filters fetched spans, then buffers them for trace
+// assembly
+func (fw *targetForwarder) addSpans(ctx context.Context, spanRows []*spanRow) {
+	if fw.pgStatStatements {
+		addStatementStats(ctx, fw.conn, spanRows)
+	}
+	fw.resolveNames(ctx, spanRows)
+	fw.stats.spansFetched.Add(int64(len(spanRows)))
+	spanRows = fw.dropMalformed(spanRows)
+	now := time.Now()
+	fetched := len(spanRows)
+	spanRows = filterClock(fw.clock, spanRows, now, fw.stats)
+	fw.clockLog.add(fw.log, fetched-len(spanRows), now)
+	spanRows = fw.dedup.Filter(spanRows, now, fw.stats)
+	if dropped := fw.assembler.Add(spanRows, now); dropped > 0 {
+		fw.stats.spansBufferDropped.Add(int64(dropped))
+		fw.log.Printf("Assembly buffer is full, dropped %d spans", dropped)
+	}
+}
+
+// resolveNames sets the database and user names of spans from their OIDs
+func (fw *targetForwarder) resolveNames(ctx context.Context, spanRows []*spanRow) {
+	var err error
+	for _, r := range spanRows {
+		if r.dbId != nil {
+			if r.dbName, err = fw.databases.Lookup(ctx, fw.conn, *r.dbId); err != nil {
+				fw.log.Printf("Failed to resolve database names: %v", err)
+				return
+			}
+		}
+		if r.userId != nil {
+			if r.userName, err = fw.roles.Lookup(ctx, fw.conn, *r.userId); err != nil {
+				fw.log.Printf("Failed to resolve role names: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// flush exports all buffered traces, regardless of the assembly window
+func (fw *targetForwarder) flush(ctx context.Context) {
+	fw.export(ctx, fw.assembler.Flush())
+}
+
+// close flushes and releases the span sinks
+func (fw *targetForwarder) close() {
+	closeSpanSinks(fw.sinks)
+}
@@ -0,0 +1,94 @@
+package forwarder
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpanRowTimes(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	end := time.Date(2024, 3, 1, 12, 0, 0, 125457000, time.UTC)
+	for _, tc := range []struct {
+		name       string
+		row        spanRow
+		start, end time.Time
+	}{
+		{
+			name:  "span_end",
+			row:   spanRow{spanStart: start, spanEnd: &end},
+			start: start,
+			end:   end,
+		},
+		{
+			name:  "span_end ignores duration",
+			row:   spanRow{spanStart: start, spanEnd: &end, duration: sql.NullInt64{Int64: 1, Valid: true}},
+			start: start,
+			end:   end,
+		},
+		{
+			name:  "duration in microseconds",
+			row:   spanRow{spanStart: start, duration: sql.NullInt64{Int64: 2001, Valid: true}},
+			start: start,
+			end:   end,
+		},
+		{
+			name:  "one microsecond duration",
+			row:   spanRow{spanStart: start, duration: sql.NullInt64{Int64: 1, Valid: true}},
+			start: start,
+			end:   start.Add(time.Microsecond),
+		},
+		{
+			name: "start offset and duration",
+			row: spanRow{spanStart: start, spanStartNs: sql.NullInt32{Int32: 1000, Valid: true},
+				duration: sql.NullInt64{Int64: 2000, Valid: true}},
+			start: start.Add(time.Microsecond),
+			end:   end,
+		},
+		{
+			name:  "null duration",
+			row:   spanRow{spanStart: start},
+			start: start,
+			end:   start,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.row.startTime(); !got.Equal(tc.start) {
+				t.Errorf("start %s, expected %s", got.Format(time.RFC3339Nano), tc.start.Format(time.RFC3339Nano))
+			}
+			if got := tc.row.endTime(); !got.Equal(tc.end) {
+				t.Errorf("end %s, expected %s", got.Format(time.RFC3339Nano), tc.end.Format(time.RFC3339Nano))
+			}
+			if got := tc.row.endTime().Sub(tc.row.startTime()); got%time.Microsecond != 0 {
+				t.Errorf("duration %s isn't a whole number of microseconds", got)
+			}
+		})
+	}
+}
+
+// BenchmarkScanSpanRow compares the decoding of a span row sent in text
+// format, as for an unnamed query, and in binary format, as for the
+// prepared span query
+func BenchmarkScanSpanRow(b *testing.B) {
+	fixture, columns := readSchemaFixture(b, filepath.Join("testdata", "schemas", "oids.json"))
+	selected, _ := resolveSchema(columns, fixture.Version, log.New(io.Discard, "", 0))
+	q := newSpanQuery(selected, "pg_tracing_consume_spans", "", FetchConfig{})
+	for _, format := range []string{"text", "binary"} {
+		b.Run(format, func(b *testing.B) {
+			rows := newFixtureRows(b, fixture, q)
+			if format == "binary" {
+				rows.binary(b)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := q.scanSpanRow(rows); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
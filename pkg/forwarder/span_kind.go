@@ -0,0 +1,43 @@
+package forwarder
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+var spanKindNames = map[string]trace.SpanKind{
+	"internal": trace.SpanKindInternal,
+	"server":   trace.SpanKindServer,
+	"client":   trace.SpanKindClient,
+	"producer": trace.SpanKindProducer,
+	"consumer": trace.SpanKindConsumer,
+}
+
+func parseSpanKinds(cfg map[string]string) (map[string]trace.SpanKind, error) {
+	kinds := make(map[string]trace.SpanKind, len(cfg))
+	for spanType, name := range cfg {
+		kind, ok := spanKindNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown span kind %q for span type %q", name, spanType)
+		}
+		kinds[spanType] = kind
+	}
+	return kinds, nil
+}
+
+// spanKind returns the configured kind for the span type. By default,
+// top-level statement spans are SERVER spans, or CLIENT spans when their
+// parent is an application span, and planner/executor spans are INTERNAL.
+func (c *spanConverter) spanKind(spanType string, hasRemoteParent bool) trace.SpanKind {
+	if kind, ok := c.spanKinds[spanType]; ok {
+		return kind
+	}
+	if !isTopSpan(spanType) {
+		return trace.SpanKindInternal
+	}
+	if hasRemoteParent {
+		return trace.SpanKindClient
+	}
+	return trace.SpanKindServer
+}
@@ -0,0 +1,66 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	metricSpanCalls    = "pg_tracing.span_metrics.calls"
+	metricSpanDuration = "pg_tracing.span_metrics.duration"
+)
+
+// spanDurationBuckets are the boundaries, in milliseconds, of the span
+// duration histogram. They match the collector's spanmetrics connector.
+var spanDurationBuckets = []float64{2, 4, 6, 8, 10, 50, 100, 200, 400, 800, 1000, 1400, 2000, 5000, 10000, 15000}
+
+// operationFingerprint identifies a span operation regardless of its
+// whitespaces
+func operationFingerprint(operation string) string {
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(strings.Fields(operation), " ")))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// spanMetrics aggregates consumed spans into request, error and duration
+// metrics, like the collector's spanmetrics connector
+type spanMetrics struct {
+	calls    metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func newSpanMetrics(meter metric.Meter) (*spanMetrics, error) {
+	calls, err := meter.Int64Counter(metricSpanCalls,
+		metric.WithDescription("Spans consumed per operation, database and status"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span calls counter: %w", err)
+	}
+	duration, err := meter.Float64Histogram(metricSpanDuration,
+		metric.WithUnit("ms"),
+		metric.WithDescription("Duration of consumed spans per operation, database and status"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span duration histogram: %w", err)
+	}
+	return &spanMetrics{calls: calls, duration: duration}, nil
+}
+
+func (m *spanMetrics) record(ctx context.Context, r *spanRow) {
+	status := "STATUS_CODE_UNSET"
+	if isSqlError(r.sqlErrorCode) {
+		status = "STATUS_CODE_ERROR"
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("span.type", r.spanType),
+		attribute.String("db.operation.fingerprint", operationFingerprint(r.spanOperation)),
+		semconv.DBName(r.dbName),
+		attribute.String("status.code", status),
+	)
+	m.calls.Add(ctx, 1, attrs)
+	m.duration.Record(ctx, float64(r.endTime().Sub(r.startTime()).Microseconds())/1000, attrs)
+}
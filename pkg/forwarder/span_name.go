@@ -0,0 +1,102 @@
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const defaultSpanNameTemplate = "{operation} {deparse_info}"
+
+var spanNamePlaceholder = regexp.MustCompile(`\{[a-z_]*\}`)
+
+var spanNameFields = map[string]bool{
+	"{span_type}":    true,
+	"{operation}":    true,
+	"{deparse_info}": true,
+}
+
+// SpanNameTemplates builds span names from the templates configured per span type
+type SpanNameTemplates struct {
+	defaultTemplate    spanNameTemplate
+	bySpanType         map[string]spanNameTemplate
+	excludeDeparseInfo bool
+}
+
+// spanNameTemplate is a parsed template, alternating literal text and
+// placeholders
+type spanNameTemplate []spanNamePart
+
+// spanNamePart is either literal text or a placeholder
+type spanNamePart struct {
+	literal     string
+	placeholder string
+}
+
+func parseSpanNameTemplate(template string) (spanNameTemplate, error) {
+	var parts spanNameTemplate
+	last := 0
+	for _, loc := range spanNamePlaceholder.FindAllStringIndex(template, -1) {
+		placeholder := template[loc[0]:loc[1]]
+		if !spanNameFields[placeholder] {
+			return nil, fmt.Errorf("unknown placeholder %s in span name template %q", placeholder, template)
+		}
+		if loc[0] > last {
+			parts = append(parts, spanNamePart{literal: template[last:loc[0]]})
+		}
+		parts = append(parts, spanNamePart{placeholder: placeholder})
+		last = loc[1]
+	}
+	if last < len(template) {
+		parts = append(parts, spanNamePart{literal: template[last:]})
+	}
+	return parts, nil
+}
+
+func newSpanNameTemplates(cfg SpanNamesConfig) (*SpanNameTemplates, error) {
+	defaultTemplate := defaultSpanNameTemplate
+	if cfg.Default != "" {
+		defaultTemplate = cfg.Default
+	}
+	parsed, err := parseSpanNameTemplate(defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	t := &SpanNameTemplates{
+		defaultTemplate:    parsed,
+		bySpanType:         make(map[string]spanNameTemplate, len(cfg.BySpanType)),
+		excludeDeparseInfo: cfg.ExcludeDeparseInfo,
+	}
+	for spanType, template := range cfg.BySpanType {
+		if t.bySpanType[spanType], err = parseSpanNameTemplate(template); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Name renders the template matching spanType. Whitespace left at the edges
+// by empty fields is trimmed, the fields' own whitespace is kept.
+func (t *SpanNameTemplates) Name(spanType, operation, deparseInfo string) string {
+	template, ok := t.bySpanType[spanType]
+	if !ok {
+		template = t.defaultTemplate
+	}
+	if t.excludeDeparseInfo {
+		deparseInfo = ""
+	}
+	var sb strings.Builder
+	for _, part := range template {
+		switch part.placeholder {
+		case "":
+			sb.WriteString(part.literal)
+		case "{span_type}":
+			sb.WriteString(spanType)
+		case "{operation}":
+			sb.WriteString(operation)
+		case "{deparse_info}":
+			sb.WriteString(deparseInfo)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
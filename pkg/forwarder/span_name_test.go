@@ -0,0 +1,61 @@
+package forwarder
+
+import "testing"
+
+func TestSpanNameTemplates(t *testing.T) {
+	templates, err := newSpanNameTemplates(SpanNamesConfig{
+		BySpanType: map[string]string{
+			"Planner": "plan: {operation}",
+			"SeqScan": "{span_type} {deparse_info} {operation}",
+			"Hash":    "hash",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		spanType, operation, deparseInfo string
+		want                             string
+	}{
+		{"Select query", "select 1;", "", "select 1;"},
+		{"Select query", "select\n  *  from t;", "", "select\n  *  from t;"},
+		{"IndexScan", "IndexScan using t_pkey on t", "Index Cond: (id = 1)", "IndexScan using t_pkey on t Index Cond: (id = 1)"},
+		{"Planner", "Planner", "", "plan: Planner"},
+		{"SeqScan", "SeqScan on t", "", "SeqScan  SeqScan on t"},
+		{"Hash", "Hash", "", "hash"},
+	} {
+		if got := templates.Name(tc.spanType, tc.operation, tc.deparseInfo); got != tc.want {
+			t.Errorf("%s: got %q, expected %q", tc.spanType, got, tc.want)
+		}
+	}
+
+	excluded, err := newSpanNameTemplates(SpanNamesConfig{ExcludeDeparseInfo: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := excluded.Name("IndexScan", "IndexScan on t", "Index Cond: (id = 1)"); got != "IndexScan on t" {
+		t.Errorf("deparse info not excluded: %q", got)
+	}
+}
+
+func TestSpanNameTemplateInvalid(t *testing.T) {
+	for _, cfg := range []SpanNamesConfig{
+		{Default: "{query}"},
+		{BySpanType: map[string]string{"Planner": "{operation} {pid}"}},
+	} {
+		if _, err := newSpanNameTemplates(cfg); err == nil {
+			t.Errorf("%+v: invalid template accepted", cfg)
+		}
+	}
+}
+
+func BenchmarkSpanName(b *testing.B) {
+	templates, err := newSpanNameTemplates(SpanNamesConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		templates.Name("IndexScan", "IndexScan using users_pkey on users", "Index Cond: (id = 42)")
+	}
+}
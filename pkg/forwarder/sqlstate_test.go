@@ -0,0 +1,40 @@
+package forwarder
+
+import "testing"
+
+func TestSqlStateMessage(t *testing.T) {
+	for _, tc := range []struct {
+		code string
+		want string
+	}{
+		{"23505", "unique violation"},
+		{"57014", "query canceled"},
+		// Unknown codes fall back to their class
+		{"23999", "integrity constraint violation"},
+		{"ZZ000", "unknown error ZZ000"},
+		{"23", "unknown error 23"},
+	} {
+		if got := sqlStateMessage(tc.code); got != tc.want {
+			t.Errorf("%s: got %q, expected %q", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestIsSqlError(t *testing.T) {
+	for _, tc := range []struct {
+		code string
+		want bool
+	}{
+		{"00000", false},
+		{"01000", false},
+		{"02000", false},
+		{"22012", true},
+		{"XX000", true},
+		{"", false},
+		{"4", false},
+	} {
+		if got := isSqlError(tc.code); got != tc.want {
+			t.Errorf("%q: got %v, expected %v", tc.code, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// params returns the DSN parameters of the configured settings
+func (c SSLConfig) params() map[string]string {
+	params := map[string]string{}
+	for k, v := range map[string]string{"sslmode": c.Mode, "sslrootcert": c.RootCert, "sslcert": c.Cert, "sslkey": c.Key} {
+		if v != "" {
+			params[k] = v
+		}
+	}
+	return params
+}
+
+// validateSSLConfig reports the common misconfigurations, before they fail
+// every connection
+func validateSSLConfig(c SSLConfig) error {
+	if c.Mode != "" && !slices.Contains(sslModes, c.Mode) {
+		return fmt.Errorf("unknown ssl mode %q, expected one of: %s", c.Mode, strings.Join(sslModes, ", "))
+	}
+	if c.Mode == "disable" && (c.RootCert != "" || c.Cert != "") {
+		return fmt.Errorf("ssl certificates are set while ssl mode is disable")
+	}
+	if (c.Cert == "") != (c.Key == "") {
+		return fmt.Errorf("ssl client certificate requires both a cert and a key")
+	}
+	if c.RootCert != "" && c.Mode != "" && c.Mode != "verify-ca" && c.Mode != "verify-full" {
+		return fmt.Errorf("ssl root_cert is only used to verify the server with the verify-ca or verify-full modes, not %s", c.Mode)
+	}
+	for _, path := range []string{c.RootCert, c.Cert, c.Key} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("ssl file: %w", err)
+		}
+	}
+	if c.Cert != "" {
+		if _, err := tls.LoadX509KeyPair(c.Cert, c.Key); err != nil {
+			return fmt.Errorf("invalid ssl client certificate, is the key the certificate's? %w", err)
+		}
+		if info, err := os.Stat(c.Key); err == nil && info.Mode().Perm()&0o077 != 0 {
+			// pgx accepts the key, but libpq based tools reject it
+			log.Printf("The ssl key %s is readable by other users than its owner", c.Key)
+		}
+	}
+	return nil
+}
+
+// withDSNParams adds the params not already set by a URL or keyword/value
+// DSN
+func withDSNParams(dsn string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return dsn, nil
+	}
+	current, err := dsnParams(dsn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse dsn: %w", err)
+	}
+	isURL := strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+	var u *url.URL
+	var query url.Values
+	if isURL {
+		u, _ = url.Parse(dsn)
+		query = u.Query()
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := params[k]
+		if _, ok := current[k]; ok {
+			continue
+		}
+		if isURL {
+			query.Set(k, v)
+		} else {
+			dsn += " " + k + "='" + strings.ReplaceAll(v, "'", `\'`) + "'"
+		}
+	}
+	if isURL {
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	return dsn, nil
+}
@@ -0,0 +1,78 @@
+package forwarder
+
+import (
+	"context"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// statementStats are pg_stat_statements' cumulative statistics for a query id
+type statementStats struct {
+	query         string
+	calls         int64
+	totalExecTime float64
+	meanExecTime  float64
+	rows          int64
+}
+
+func (s *statementStats) appendAttributes(attributes []attribute.KeyValue) []attribute.KeyValue {
+	return append(attributes,
+		attribute.String("db.postgresql.statement.query", s.query),
+		attribute.Int64("db.postgresql.statement.calls", s.calls),
+		attribute.Float64("db.postgresql.statement.total_exec_time", s.totalExecTime),
+		attribute.Float64("db.postgresql.statement.mean_exec_time", s.meanExecTime),
+		attribute.Int64("db.postgresql.statement.rows", s.rows),
+	)
+}
+
+// addStatementStats looks up the spans' query ids in pg_stat_statements.
+// Failures are logged and leave the spans untouched.
+func addStatementStats(ctx context.Context, conn *pgx.Conn, spanRows []*spanRow) {
+	seen := make(map[int64]bool)
+	var queryIds []int64
+	for _, r := range spanRows {
+		if r.queryId.Valid && r.queryId.Int64 != 0 && !seen[r.queryId.Int64] {
+			seen[r.queryId.Int64] = true
+			queryIds = append(queryIds, r.queryId.Int64)
+		}
+	}
+	if len(queryIds) == 0 {
+		return
+	}
+
+	// Entries are per user and database, aggregate them per query id
+	rows, err := conn.Query(ctx, `select queryid, min(query), sum(calls)::bigint,
+		sum(total_exec_time), sum(total_exec_time) / nullif(sum(calls), 0), sum(rows)::bigint
+		from pg_stat_statements where queryid = any($1) group by queryid`, queryIds)
+	if err != nil {
+		log.Printf("Failed to query pg_stat_statements: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	stats := make(map[int64]*statementStats, len(queryIds))
+	for rows.Next() {
+		var queryId int64
+		var meanExecTime *float64
+		s := &statementStats{}
+		if err := rows.Scan(&queryId, &s.query, &s.calls, &s.totalExecTime, &meanExecTime, &s.rows); err != nil {
+			log.Printf("Failed to scan pg_stat_statements: %v", err)
+			return
+		}
+		if meanExecTime != nil {
+			s.meanExecTime = *meanExecTime
+		}
+		stats[queryId] = s
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Failed to query pg_stat_statements: %v", err)
+		return
+	}
+	for _, r := range spanRows {
+		if r.queryId.Valid {
+			r.statementStats = stats[r.queryId.Int64]
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package forwarder
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// maxLatencySamples bounds the export latencies kept between two summaries
+const maxLatencySamples = 10000
+
+// forwarderStats holds the forwarder's internal counters
+type forwarderStats struct {
+	spansFetched      atomic.Int64
+	spansExported     atomic.Int64
+	spansErrored      atomic.Int64
+	spansDuplicated   atomic.Int64
+	spansClockClamped atomic.Int64
+	spansClockDropped atomic.Int64
+	spansExportFailed atomic.Int64
+	// spansBufferDropped counts the spans dropped by the full assembly buffer
+	spansBufferDropped atomic.Int64
+	// spansMalformedDropped counts the spans without valid trace or span id
+	spansMalformedDropped atomic.Int64
+	// pgTracingDropped counts the spans pg_tracing dropped while running
+	pgTracingDropped atomic.Int64
+	// spansQueued and spansDequeued count the spans entering and leaving
+	// the export queue
+	spansQueued   atomic.Int64
+	spansDequeued atomic.Int64
+	// statementsFailed counts the transform statements failing on a span
+	statementsFailed atomic.Int64
+
+	mu              sync.Mutex
+	exportLatencies []time.Duration
+}
+
+func (s *forwarderStats) recordExportLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.exportLatencies) < maxLatencySamples {
+		s.exportLatencies = append(s.exportLatencies, d)
+	}
+}
+
+// takeExportLatencyP95 returns the 95th percentile of the export latencies
+// recorded since the last call
+func (s *forwarderStats) takeExportLatencyP95() time.Duration {
+	s.mu.Lock()
+	latencies := s.exportLatencies
+	s.exportLatencies = nil
+	s.mu.Unlock()
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[(len(latencies)*95-1)/100]
+}
+
+// statsExporter records the latency and failures of an exporter's exports
+type statsExporter struct {
+	sdktrace.SpanExporter
+	stats *forwarderStats
+}
+
+func (e *statsExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.stats.recordExportLatency(time.Since(start))
+	e.stats.spansDequeued.Add(int64(len(spans)))
+	if err != nil {
+		e.stats.spansExportFailed.Add(int64(len(spans)))
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "<redacted>"
+
+// redactedConfig returns a copy of cfg without its secrets. DSNs and
+// headers may hold credentials.
+func redactedConfig(cfg *Config) Config {
+	c := *cfg
+	redact := func(s *string) {
+		if *s != "" {
+			*s = redacted
+		}
+	}
+	redact(&c.Exporter.Kafka.Auth.Password)
+	redact(&c.Exporter.Jaeger.Password)
+	redact(&c.Exporter.Datadog.APIKey)
+	redact(&c.Sinks.ClickHouse.Password)
+	redact(&c.Discovery.SQL.DSN)
+	redact(&c.Collector.Proxy)
+	redactMap := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		res := make(map[string]string, len(m))
+		for k := range m {
+			res[k] = redacted
+		}
+		return res
+	}
+	c.Exporter.Headers = redactMap(c.Exporter.Headers)
+	c.Targets = nil
+	for _, t := range cfg.Targets {
+		redact(&t.DSN)
+		t.Headers = redactMap(t.Headers)
+		c.Targets = append(c.Targets, t)
+	}
+	return c
+}
+
+// dumpStats describes the forwarder's counters, buffers and configuration
+func (fw *targetForwarder) dumpStats(now time.Time) string {
+	var b strings.Builder
+	line := func(name string, value any) {
+		fmt.Fprintf(&b, "  %-20s %v\n", name+":", value)
+	}
+	b.WriteString("Stats dump\n")
+	line("uptime", now.Sub(fw.started).Round(time.Second))
+	if fw.lastPoll.IsZero() {
+		line("last_poll", "never")
+	} else {
+		line("last_poll", fmt.Sprintf("%s (%s ago)", fw.lastPoll.Format(time.RFC3339Nano), now.Sub(fw.lastPoll).Round(time.Millisecond)))
+	}
+	line("paused", fw.paused.Load())
+	if fw.lock != nil {
+		line("consumer_lock", fw.leader.Load())
+	}
+	line("spans_fetched", fw.stats.spansFetched.Load())
+	line("spans_exported", fw.stats.spansExported.Load())
+	line("spans_errored", fw.stats.spansErrored.Load())
+	line("spans_duplicated", fw.stats.spansDuplicated.Load())
+	line("spans_clock_clamped", fw.stats.spansClockClamped.Load())
+	line("spans_clock_dropped", fw.stats.spansClockDropped.Load())
+	line("spans_export_failed", fw.stats.spansExportFailed.Load())
+	line("spans_buffer_dropped", fw.stats.spansBufferDropped.Load())
+	line("spans_malformed_dropped", fw.stats.spansMalformedDropped.Load())
+	line("pg_tracing_dropped", fw.stats.pgTracingDropped.Load())
+	line("export_queue", fw.stats.exportQueueDepth())
+	line("backpressured", fw.throttled)
+	line("assembly_spans", fw.assembler.Len())
+	line("assembly_traces", fw.assembler.Traces())
+	line("dedup_entries", fw.dedup.Len())
+	line("sinks", len(fw.sinks))
+
+	b.WriteString("Config\n")
+	cfg := redactedConfig(fw.cfg)
+	content, err := yaml.Marshal(&cfg)
+	if err != nil {
+		fmt.Fprintf(&b, "  failed to marshal config: %v\n", err)
+		return b.String()
+	}
+	for _, l := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		b.WriteString("  " + l + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Subtransaction representation modes
+const (
+	subxactNone       = "none"
+	subxactEvents     = "events"
+	subxactAttributes = "attributes"
+)
+
+const (
+	subxactActionKey    = "db.postgresql.subtransaction.action"
+	subxactSavepointKey = "db.postgresql.subtransaction.savepoint"
+)
+
+var savepointStatement = regexp.MustCompile(`(?i)^\s*(SAVEPOINT|RELEASE(?:\s+SAVEPOINT)?|ROLLBACK(?:\s+(?:WORK|TRANSACTION))?\s+TO(?:\s+SAVEPOINT)?)\s+("[^"]+"|[^\s;]+)`)
+
+func validateSubxactMode(mode string) error {
+	switch mode {
+	case "", subxactNone, subxactEvents, subxactAttributes:
+		return nil
+	}
+	return fmt.Errorf("unknown subtransactions mode %q, expected one of: none, events, attributes", mode)
+}
+
+// subxactBoundary returns the subtransaction action (begin, release or
+// rollback) and savepoint name of a savepoint statement span
+func subxactBoundary(r *spanRow) (string, string, bool) {
+	if !isTopSpan(r.spanType) {
+		return "", "", false
+	}
+	match := savepointStatement.FindStringSubmatch(r.spanOperation)
+	if match == nil {
+		return "", "", false
+	}
+	keyword := strings.ToUpper(match[1])
+	action := "begin"
+	switch {
+	case strings.HasPrefix(keyword, "RELEASE"):
+		action = "release"
+	case strings.HasPrefix(keyword, "ROLLBACK"):
+		action = "rollback"
+	}
+	return action, strings.Trim(match[2], `"`), true
+}
+
+func savepointAttributes(action, savepoint string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String(subxactActionKey, action),
+		attribute.String(subxactSavepointKey, savepoint),
+	}
+}
+
+// collectSubxactEvents turns savepoint statements into events on their parent
+// span, marking the subtransaction boundaries
+func (b *spanBatch) collectSubxactEvents() {
+	for _, r := range b.rows {
+		action, savepoint, ok := subxactBoundary(r)
+		if !ok || !b.spanIds[r.parentId] {
+			continue
+		}
+		b.subxactEvents[r.parentId] = append(b.subxactEvents[r.parentId], spanEvent{
+			name:       "subtransaction " + action,
+			timestamp:  r.startTime(),
+			attributes: savepointAttributes(action, savepoint),
+		})
+	}
+}
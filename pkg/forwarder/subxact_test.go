@@ -0,0 +1,52 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubxactBoundary(t *testing.T) {
+	for _, tc := range []struct {
+		spanType, operation string
+		action, savepoint   string
+		ok                  bool
+	}{
+		{"Utility query", "SAVEPOINT sp1;", "begin", "sp1", true},
+		{"Utility query", `savepoint "my sp"`, "begin", "my sp", true},
+		{"Utility query", "RELEASE SAVEPOINT sp1", "release", "sp1", true},
+		{"Utility query", "release sp1", "release", "sp1", true},
+		{"Utility query", "ROLLBACK TO SAVEPOINT sp1", "rollback", "sp1", true},
+		{"Utility query", "rollback work to sp1;", "rollback", "sp1", true},
+		{"Utility query", "ROLLBACK", "", "", false},
+		{"Select query", "select 'SAVEPOINT sp1'", "", "", false},
+		{"ProcessUtility", "SAVEPOINT sp1", "", "", false},
+	} {
+		r := testRow(10, 1, tc.spanType, tc.operation, 0, time.Millisecond).spanRow()
+		action, savepoint, ok := subxactBoundary(r)
+		if action != tc.action || savepoint != tc.savepoint || ok != tc.ok {
+			t.Errorf("%s: got %q %q %v", tc.operation, action, savepoint, ok)
+		}
+	}
+}
+
+func TestCollectSubxactEvents(t *testing.T) {
+	rows := []*spanRow{
+		testRow(10, 0, "Utility query", "BEGIN", 0, 10*time.Millisecond).spanRow(),
+		testRow(11, 10, "Utility query", "SAVEPOINT sp1", time.Millisecond, time.Millisecond).spanRow(),
+		testRow(12, 10, "Utility query", "ROLLBACK TO SAVEPOINT sp1", 5*time.Millisecond, time.Millisecond).spanRow(),
+		// The parent isn't in the batch
+		testRow(13, 99, "Utility query", "RELEASE sp2", 6*time.Millisecond, time.Millisecond).spanRow(),
+	}
+	batch := newSpanBatch(rows)
+	batch.collectSubxactEvents()
+	events := batch.subxactEvents[10]
+	if len(events) != 2 || events[0].name != "subtransaction begin" || events[1].name != "subtransaction rollback" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if !events[1].timestamp.Equal(rows[2].startTime()) {
+		t.Fatalf("rollback event at %s", events[1].timestamp)
+	}
+	if len(batch.subxactEvents) != 1 {
+		t.Fatalf("events added to missing parents: %+v", batch.subxactEvents)
+	}
+}
@@ -0,0 +1,144 @@
+package forwarder
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tailSeenSpans bounds the number of spans remembered to print each span once
+const tailSeenSpans = 100000
+
+// tailFilter selects the spans printed by tail
+type tailFilter struct {
+	traceId     trace.TraceID
+	hasTraceId  bool
+	spanType    *regexp.Regexp
+	minDuration time.Duration
+}
+
+// parseTraceId accepts pg_tracing's decimal trace ids, their hex form or
+// the 32 digits of the exported trace id
+func parseTraceId(s string) (trace.TraceID, error) {
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return traceIdOf(id, 0), nil
+	}
+	high, low, err := scanTraceId(s)
+	if err != nil {
+		return trace.TraceID{}, fmt.Errorf("invalid trace id %q", s)
+	}
+	return traceIdOf(high, low), nil
+}
+
+func (f *tailFilter) match(r *spanRow) bool {
+	if f.hasTraceId && r.traceID() != f.traceId {
+		return false
+	}
+	if f.spanType != nil && !f.spanType.MatchString(r.spanType) {
+		return false
+	}
+	return r.endTime().Sub(r.startTime()) >= f.minDuration
+}
+
+func formatTailSpan(r *spanRow) string {
+	var b strings.Builder
+	duration := r.endTime().Sub(r.startTime())
+	fmt.Fprintf(&b, "%s trace=%s span=%016x parent=%016x pid=%d %10.3fms %s",
+		r.startTime().UTC().Format("2006-01-02T15:04:05.000000Z"),
+		r.traceID(), uint64(r.spanId), uint64(r.parentId), r.pid,
+		float64(duration)/float64(time.Millisecond), r.spanType)
+	if r.spanOperation != "" {
+		b.WriteString(": " + strings.Join(strings.Fields(r.spanOperation), " "))
+	}
+	if r.deparseInfo.Valid && r.deparseInfo.String != "" {
+		b.WriteString(" " + r.deparseInfo.String)
+	}
+	if isSqlError(r.sqlErrorCode) {
+		fmt.Fprintf(&b, " [ERROR %s %s]", r.sqlErrorCode, sqlStateMessage(r.sqlErrorCode))
+	}
+	return b.String()
+}
+
+// tailCommand prints new spans as they appear in pg_tracing's buffer,
+// without consuming them
+func tailCommand(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	traceId := fs.String("trace-id", "", "Only print spans of this trace, as a decimal or hex id")
+	spanType := fs.String("span-type", "", "Only print spans whose type matches this regex, e.g. 'Select query|SeqScan'")
+	minDuration := fs.Duration("min-duration", 0, "Only print spans lasting at least this duration")
+	interval := fs.Duration("interval", time.Second, "Delay between two peeks")
+	fs.Parse(args)
+
+	filter := &tailFilter{minDuration: *minDuration}
+	if *traceId != "" {
+		id, err := parseTraceId(*traceId)
+		if err != nil {
+			return err
+		}
+		filter.traceId, filter.hasTraceId = id, true
+	}
+	if *spanType != "" {
+		re, err := regexp.Compile("^(?:" + *spanType + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid span type regex: %w", err)
+		}
+		filter.spanType = re
+	}
+
+	seen := newDedupCache(tailSeenSpans, 0)
+	return peekSpans(*interval, func(rows []*spanRow, now time.Time) {
+		for _, r := range rows {
+			if !seen.isDuplicate(r, now) && filter.match(r) {
+				fmt.Println(formatTailSpan(r))
+			}
+		}
+	})
+}
+
+// peekSpans calls fn with the content of pg_tracing's buffer every interval,
+// until interrupted
+func peekSpans(interval time.Duration, fn func(rows []*spanRow, now time.Time)) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	columns, err := detectSpanColumns(ctx, conn)
+	if err != nil {
+		return err
+	}
+	query := newSpanQuery(columns, "pg_tracing_peek_spans", "", FetchConfig{})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		rows, err := fetchSpanRows(ctx, conn, query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		fn(rows, time.Now())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package forwarder
+
+import "testing"
+
+func TestParseTraceId(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{s: "42", want: "000000000000002a0000000000000000"},
+		{s: "0x2a", want: "000000000000002a0000000000000000"},
+		{s: "000000000000002a0000000000000000", want: "000000000000002a0000000000000000"},
+		{s: "0000000000000000a3ce929d0e0e4736", want: "0000000000000000a3ce929d0e0e4736"},
+	} {
+		id, err := parseTraceId(tc.s)
+		if err != nil {
+			t.Errorf("%q: %v", tc.s, err)
+		} else if id.String() != tc.want {
+			t.Errorf("%q parsed as %s, expected %s", tc.s, id, tc.want)
+		}
+	}
+	if _, err := parseTraceId("not an id"); err == nil {
+		t.Error("invalid id accepted")
+	}
+
+	f := tailFilter{hasTraceId: true}
+	f.traceId, _ = parseTraceId("0000000000000000a3ce929d0e0e4736")
+	if !f.match(idRow(0, -0x5c316d62f1f1b8ca, 10, 0)) || f.match(idRow(0, 1, 10, 0)) {
+		t.Error("trace id filter doesn't match on the full id")
+	}
+}
@@ -0,0 +1,496 @@
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// targets returns the polled instances, the DATABASE_URL one when none is
+// configured
+func (c *Config) targets() []TargetConfig {
+	if len(c.Targets) == 0 {
+		return []TargetConfig{{DSN: os.Getenv("DATABASE_URL")}}
+	}
+	return c.Targets
+}
+
+// forTarget returns the configuration of a target's worker, with the
+// target's resource and headers added to the common ones
+func (c *Config) forTarget(t TargetConfig) *Config {
+	cfg := *c
+	cfg.Target = t.Name
+	if t.Resource.ServiceName != "" {
+		cfg.Resource.ServiceName = t.Resource.ServiceName
+	}
+	cfg.Resource.Attributes = mergeMaps(c.Resource.Attributes, t.Resource.Attributes)
+	if len(t.Headers) > 0 {
+		cfg.Exporter.Headers = mergeMaps(c.Exporter.Headers, t.Headers)
+	}
+	if t.PasswordFile != "" {
+		cfg.Connection.PasswordFile = t.PasswordFile
+	}
+	if t.VaultRole != "" {
+		cfg.Connection.Auth.Vault.Role = t.VaultRole
+	}
+	return &cfg
+}
+
+// mergeMaps returns a copy of base with the entries of overrides
+func mergeMaps(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+func validateTargets(c *Config) error {
+	names := map[string]bool{}
+	for _, t := range c.Targets {
+		if t.Name == "" {
+			return fmt.Errorf("targets require a name")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate target %q", t.Name)
+		}
+		names[t.Name] = true
+		if t.DSN == "" {
+			return fmt.Errorf("target %s requires a dsn", t.Name)
+		}
+		if err := validateServiceNameTemplate(t.Resource.ServiceName); err != nil {
+			return fmt.Errorf("target %s: %w", t.Name, err)
+		}
+		if len(t.Headers) > 0 && c.Exporter.Type != exporterOtlp {
+			return fmt.Errorf("target %s: headers require the otlp exporter", t.Name)
+		}
+		if t.PasswordFile != "" && c.Connection.Auth.Type != "" && c.Connection.Auth.Type != authPassword {
+			return fmt.Errorf("target %s: password_file can't be combined with %s authentication", t.Name, c.Connection.Auth.Type)
+		}
+		if t.VaultRole != "" && c.Connection.Auth.Type != authVault {
+			return fmt.Errorf("target %s: vault_role requires vault authentication", t.Name)
+		}
+	}
+	// Each worker has its own exporter and sinks, which can't write to the
+	// same files
+	if (len(c.Targets) > 1 || c.Discovery.enabled()) && (c.Exporter.Type == exporterFile || c.Sinks.Parquet.Directory != "") {
+		return fmt.Errorf("the file exporter and parquet sink can't be used with multiple or discovered targets")
+	}
+	return nil
+}
+
+// targetLogger prefixes the log lines of a target with its name
+func targetLogger(name string) *log.Logger {
+	if name == "" {
+		return log.Default()
+	}
+	return log.New(log.Writer(), "["+name+"] ", log.Flags()|log.Lmsgprefix)
+}
+
+// targetError adds the target's name to err
+func targetError(name string, err error) error {
+	if name == "" || err == nil {
+		return err
+	}
+	return fmt.Errorf("target %s: %w", name, err)
+}
+
+// target is a polled Postgres instance, with its own connection, providers
+// and forwarder
+type target struct {
+	name     string
+	config   TargetConfig
+	fw       *targetForwarder
+	provider *sdktrace.TracerProvider
+	// registry holds the target's Prometheus metrics
+	registry *prometheus.Registry
+	// closers release the target's resources, in reverse order
+	closers []func(context.Context)
+}
+
+func (t *target) onClose(fn func(context.Context)) {
+	t.closers = append(t.closers, fn)
+}
+
+func (t *target) close(ctx context.Context) {
+	for i := len(t.closers) - 1; i >= 0; i-- {
+		t.closers[i](ctx)
+	}
+	t.closers = nil
+}
+
+// openTarget connects to a target and creates its providers and forwarder.
+// The target's resources are released with close, ctx being used for the
+// connection and startup only.
+func openTarget(ctx context.Context, cfg *Config, tc TargetConfig) (_ *target, err error) {
+	tg := &target{name: tc.Name, config: tc, registry: prometheus.NewRegistry()}
+	defer func() {
+		if err != nil {
+			tg.close(context.Background())
+			err = targetError(tc.Name, err)
+		}
+	}()
+	cfg = cfg.forTarget(tc)
+	logger := targetLogger(tc.Name)
+
+	logger.Printf("Waiting for connection...")
+	connector, err := newConnector(cfg.Connection, tc.DSN)
+	if err != nil {
+		return nil, err
+	}
+	tg.onClose(func(ctx context.Context) { connector.close() })
+	conn, err := connector.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tg.onClose(func(ctx context.Context) {
+		// The forwarder replaces its connection when reconnecting
+		if tg.fw != nil {
+			conn = tg.fw.conn
+		}
+		conn.Close(ctx)
+	})
+
+	if cfg.BootstrapRole != "" {
+		if err := bootstrap(ctx, conn, cfg.BootstrapRole, logger); err != nil {
+			return nil, err
+		}
+	}
+	if err := waitForExtension(ctx, conn, logger); err != nil {
+		return nil, err
+	}
+	if err := checkExtensionVersion(ctx, conn, cfg.UnsupportedVersions, logger); err != nil {
+		return nil, err
+	}
+	serverInfo, err := fetchServerInfo(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	fixedGenerator := &FixedIdGenerator{}
+	stats := &forwarderStats{}
+	res, err := newResource(ctx, cfg, serverInfo)
+	if err != nil {
+		return nil, err
+	}
+	var processors []sdktrace.SpanProcessor
+	if cfg.Logs.Endpoint != "" {
+		loggerProvider, err := initLoggerProvider(ctx, cfg.Logs, cfg.Collector, res)
+		if err != nil {
+			return nil, err
+		}
+		// Shutdown after the TracerProvider, flushing the records of the last spans
+		tg.onClose(func(ctx context.Context) {
+			if err := loggerProvider.Shutdown(ctx); err != nil {
+				logger.Printf("Failed to shutdown LoggerProvider: %v", err)
+			}
+		})
+		processors = append(processors, newErrorLogProcessor(loggerProvider))
+	}
+	processors = append(processors, cfg.SpanProcessors...)
+	tg.provider, err = initProvider(fixedGenerator, cfg, res, stats, processors...)
+	if err != nil {
+		return nil, err
+	}
+	tg.onClose(func(ctx context.Context) {
+		if err := tg.provider.Shutdown(ctx); err != nil {
+			logger.Printf("Failed to shutdown TracerProvider: %v", err)
+		}
+	})
+
+	var meterProvider metric.MeterProvider = otel.GetMeterProvider()
+	if metricsEnabled(cfg.Metrics) {
+		// The metrics of the targets are told apart by a target label in
+		// Prometheus, and by their resource in OTLP
+		var registerer prometheus.Registerer = tg.registry
+		if tc.Name != "" {
+			registerer = prometheus.WrapRegistererWith(prometheus.Labels{"target": tc.Name}, registerer)
+		}
+		sdkMeterProvider, err := initMeterProvider(ctx, cfg.Metrics, cfg.Collector, res, registerer)
+		if err != nil {
+			return nil, err
+		}
+		tg.onClose(func(ctx context.Context) {
+			if err := sdkMeterProvider.Shutdown(ctx); err != nil {
+				logger.Printf("Failed to shutdown MeterProvider: %v", err)
+			}
+		})
+		meterProvider = sdkMeterProvider
+	}
+
+	tracer := tg.provider.Tracer("pgtracing-tracer")
+	tg.fw, err = newForwarder(ctx, cfg, conn, tracer, meterProvider.Meter(meterName), fixedGenerator, stats)
+	if err != nil {
+		return nil, err
+	}
+	tg.fw.connector = connector
+	tg.onClose(func(ctx context.Context) { tg.fw.close() })
+	return tg, nil
+}
+
+// configWatchInterval is the delay between two checks of the configuration
+// file's modification time
+const configWatchInterval = 5 * time.Second
+
+// targetPool runs a worker per target, polling its instance until stopped
+type targetPool struct {
+	once bool
+	// signals enables the SIGHUP reloads and SIGUSR1 stats dumps
+	signals bool
+	// shutdownCtx is used to flush and close the targets of stopped workers
+	shutdownCtx context.Context
+	// reconcileMu serializes the reconciles of discoveries and reloads
+	reconcileMu sync.Mutex
+
+	mu sync.Mutex
+	// cfg is the configuration of new workers, replaced on reload
+	cfg     *Config
+	workers map[string]*worker
+	// errs are the errors of the workers' single fetch
+	errs []error
+	wg   sync.WaitGroup
+}
+
+type worker struct {
+	target *target
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newTargetPool(cfg *Config, once, signals bool, shutdownCtx context.Context) *targetPool {
+	return &targetPool{cfg: cfg, once: once, signals: signals, shutdownCtx: shutdownCtx, workers: map[string]*worker{}}
+}
+
+func (p *targetPool) config() *Config {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cfg
+}
+
+// start opens all targets then starts their workers, failing if a target
+// can't be opened
+func (p *targetPool) start(ctx context.Context, targets []TargetConfig) error {
+	var opened []*target
+	for _, tc := range targets {
+		tg, err := openTarget(ctx, p.config(), tc)
+		if err != nil {
+			for _, t := range opened {
+				t.close(p.shutdownCtx)
+			}
+			return err
+		}
+		opened = append(opened, tg)
+	}
+	for _, tg := range opened {
+		p.startWorker(ctx, tg)
+	}
+	return nil
+}
+
+func (p *targetPool) startWorker(ctx context.Context, tg *target) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &worker{target: tg, cancel: cancel, done: make(chan struct{})}
+	p.mu.Lock()
+	p.workers[tg.name] = w
+	cfg := p.cfg
+	p.mu.Unlock()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(w.done)
+		if p.once {
+			if err := tg.fw.fetchSpans(ctx); err != nil {
+				p.mu.Lock()
+				p.errs = append(p.errs, targetError(tg.name, err))
+				p.mu.Unlock()
+			}
+		} else {
+			tg.fw.run(ctx, cfg.PollInterval, cfg.SummaryInterval, p.signals)
+		}
+		tg.fw.flush(p.shutdownCtx)
+		tg.close(p.shutdownCtx)
+	}()
+}
+
+// reconcile stops the workers of removed and changed targets, then starts
+// the workers of new targets. Other workers keep running. Targets failing to
+// open are retried on the next reconcile.
+func (p *targetPool) reconcile(ctx context.Context, targets []TargetConfig) {
+	p.reconcileMu.Lock()
+	defer p.reconcileMu.Unlock()
+	wanted := make(map[string]TargetConfig, len(targets))
+	for _, tc := range targets {
+		wanted[tc.Name] = tc
+	}
+	var stopped []*worker
+	p.mu.Lock()
+	for name, w := range p.workers {
+		if tc, ok := wanted[name]; !ok || !reflect.DeepEqual(tc, w.target.config) {
+			delete(p.workers, name)
+			stopped = append(stopped, w)
+		}
+	}
+	p.mu.Unlock()
+	// Stopped workers flush their buffered spans
+	for _, w := range stopped {
+		log.Printf("Stopping target %s", w.target.name)
+		w.cancel()
+		<-w.done
+	}
+
+	for _, tc := range targets {
+		p.mu.Lock()
+		_, running := p.workers[tc.Name]
+		p.mu.Unlock()
+		if running {
+			continue
+		}
+		log.Printf("Starting target %s", tc.Name)
+		tg, err := openTarget(ctx, p.config(), tc)
+		if err != nil {
+			log.Printf("Failed to start target: %v", err)
+			continue
+		}
+		p.startWorker(ctx, tg)
+	}
+}
+
+// reload reconciles the workers with the targets of cfg, then applies the
+// reloadable settings to the running workers
+func (p *targetPool) reload(ctx context.Context, cfg *Config) error {
+	targets, err := discoverTargets(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.cfg = cfg
+	p.mu.Unlock()
+	p.reconcile(ctx, targets)
+	for _, t := range p.targets() {
+		if err := t.fw.submit(ctx, adminRequest{action: adminReload, cfg: cfg.forTarget(t.config)}); err != nil {
+			return targetError(t.name, err)
+		}
+	}
+	return nil
+}
+
+// startWatching reconciles the workers with the discovered targets every
+// discovery interval, and reloads the configuration on SIGHUP if enabled or
+// when the file at path changes, until ctx is cancelled. load returns the reloaded
+// configuration.
+func (p *targetPool) startWatching(ctx context.Context, path string, load func() (*Config, error)) {
+	// Keep wait blocked even if no target is left
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		p.discover(ctx)
+	}()
+	go func() {
+		defer p.wg.Done()
+		p.watchConfig(ctx, path, load)
+	}()
+}
+
+func (p *targetPool) discover(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.config().Discovery.Interval):
+		}
+		// Discovery can be enabled by a reload
+		cfg := p.config()
+		if !cfg.Discovery.enabled() {
+			continue
+		}
+		targets, err := discoverTargets(ctx, cfg)
+		if err != nil {
+			log.Printf("Failed to discover targets: %v", err)
+			continue
+		}
+		p.reconcile(ctx, targets)
+	}
+}
+
+// fileModTime returns the modification time of path, zero if it can't be
+// read
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (p *targetPool) watchConfig(ctx context.Context, path string, load func() (*Config, error)) {
+	hangups := make(chan os.Signal, 1)
+	if p.signals {
+		signal.Notify(hangups, syscall.SIGHUP)
+		defer signal.Stop(hangups)
+	}
+	var checks <-chan time.Time
+	if path != "" {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		checks = ticker.C
+	}
+	modTime := fileModTime(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangups:
+			log.Printf("Reloading the configuration on SIGHUP")
+		case <-checks:
+			current := fileModTime(path)
+			if current.Equal(modTime) {
+				continue
+			}
+			modTime = current
+			log.Printf("Reloading the changed configuration file %s", path)
+		}
+		cfg, err := load()
+		if err == nil {
+			err = p.reload(ctx, cfg)
+		}
+		if err != nil {
+			log.Printf("Failed to reload the configuration: %v", err)
+		}
+	}
+}
+
+// targets returns the targets of the running workers, sorted by name
+func (p *targetPool) targets() []*target {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	targets := make([]*target, 0, len(p.workers))
+	for _, w := range p.workers {
+		targets = append(targets, w.target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].name < targets[j].name })
+	return targets
+}
+
+// wait waits for all workers to stop and returns their errors
+func (p *targetPool) wait() error {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Join(p.errs...)
+}
@@ -0,0 +1,131 @@
+package forwarder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileWatcher tracks the modification time of files
+type fileWatcher struct {
+	paths    []string
+	modTimes map[string]time.Time
+}
+
+func newFileWatcher(paths ...string) *fileWatcher {
+	w := &fileWatcher{modTimes: map[string]time.Time{}}
+	for _, path := range paths {
+		if path != "" {
+			w.paths = append(w.paths, path)
+		}
+	}
+	w.changed()
+	return w
+}
+
+// changed returns whether a file was modified since the last call. Files
+// being replaced are reported on a later call.
+func (w *fileWatcher) changed() bool {
+	changed := false
+	for _, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(w.modTimes[path]) {
+			w.modTimes[path] = info.ModTime()
+			changed = true
+		}
+	}
+	return changed
+}
+
+// certReloader serves a client certificate and CA loaded from files, loading
+// them again when modified, e.g. when rotated by cert-manager. They're
+// checked on each TLS handshake.
+type certReloader struct {
+	cfg     TLSConfig
+	mu      sync.Mutex
+	watcher *fileWatcher
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+func newCertReloader(cfg TLSConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg, watcher: newFileWatcher(cfg.CertFile, cfg.KeyFile, cfg.CAFile)}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) load() error {
+	cert := &tls.Certificate{}
+	if r.cfg.CertFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &loaded
+	}
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		ca, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return fmt.Errorf("no certificate found in CA file %s", r.cfg.CAFile)
+		}
+	}
+	r.cert, r.pool = cert, pool
+	return nil
+}
+
+// current returns the loaded certificates, keeping the previous ones when
+// the modified files can't be loaded, e.g. while being written
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watcher.changed() {
+		if err := r.load(); err != nil {
+			log.Printf("Keeping the previous TLS certificates: %v", err)
+		}
+	}
+	return r.cert, r.pool
+}
+
+// tlsConfig returns a client TLS configuration using the current
+// certificates on each handshake
+func (r *certReloader) tlsConfig() *tls.Config {
+	cfg := &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+	}
+	if r.cfg.CAFile == "" {
+		return cfg
+	}
+	// The server certificate is verified against the current CA instead of
+	// the one loaded with the configuration
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return fmt.Errorf("no server certificate")
+		}
+		_, pool := r.current()
+		opts := x509.VerifyOptions{Roots: pool, DNSName: cs.ServerName, Intermediates: x509.NewCertPool()}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return cfg
+}
@@ -0,0 +1,137 @@
+package forwarder
+
+import (
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// assemblingTrace holds the spans received for a trace
+type assemblingTrace struct {
+	traceId  trace.TraceID
+	rows     []*spanRow
+	lastSeen time.Time
+	// lastEnd is the latest end of the trace's spans
+	lastEnd time.Time
+}
+
+// traceAssembler buffers spans grouped by trace id, so a trace's spans are
+// exported together and in order once no new span of the trace was received
+// during the assembly window
+type traceAssembler struct {
+	window time.Duration
+	traces map[trace.TraceID]*assemblingTrace
+	// spans is the number of buffered spans, bounded by maxSpans when set
+	spans      int
+	maxSpans   int
+	dropOldest bool
+}
+
+func newTraceAssembler(window time.Duration, buffer BufferConfig) *traceAssembler {
+	return &traceAssembler{
+		window:     window,
+		traces:     make(map[trace.TraceID]*assemblingTrace),
+		maxSpans:   buffer.MaxSpans,
+		dropOldest: buffer.DropPolicy == dropOldest,
+	}
+}
+
+// Add buffers rows and returns the number of spans dropped to stay within
+// maxSpans: the new ones, or the oldest traces with dropOldest
+func (a *traceAssembler) Add(rows []*spanRow, now time.Time) int {
+	dropped := 0
+	for _, r := range rows {
+		if a.maxSpans > 0 && a.spans >= a.maxSpans {
+			if !a.dropOldest {
+				dropped++
+				continue
+			}
+			dropped += a.dropOldestTrace()
+		}
+		traceId := r.traceID()
+		t, ok := a.traces[traceId]
+		if !ok {
+			t = &assemblingTrace{traceId: traceId}
+			a.traces[traceId] = t
+		}
+		t.rows = append(t.rows, r)
+		t.lastSeen = now
+		if end := r.endTime(); end.After(t.lastEnd) {
+			t.lastEnd = end
+		}
+		a.spans++
+	}
+	return dropped
+}
+
+// dropOldestTrace removes the least recently updated trace, returning its
+// number of spans
+func (a *traceAssembler) dropOldestTrace() int {
+	var oldest *assemblingTrace
+	for _, t := range a.traces {
+		if oldest == nil || t.lastSeen.Before(oldest.lastSeen) {
+			oldest = t
+		}
+	}
+	if oldest == nil {
+		return 0
+	}
+	delete(a.traces, oldest.traceId)
+	a.spans -= len(oldest.rows)
+	return len(oldest.rows)
+}
+
+// Len returns the number of buffered spans
+func (a *traceAssembler) Len() int {
+	return a.spans
+}
+
+// Traces returns the number of buffered traces
+func (a *traceAssembler) Traces() int {
+	return len(a.traces)
+}
+
+// Ready removes and returns the traces whose window elapsed
+func (a *traceAssembler) Ready(now time.Time) [][]*spanRow {
+	return a.take(func(t *assemblingTrace) bool {
+		return now.Sub(t.lastSeen) >= a.window
+	})
+}
+
+// ReadyBefore removes and returns the traces whose spans all ended at least
+// the assembly window before start. Spans being streamed in start order, no
+// span of those traces is expected later in the stream.
+func (a *traceAssembler) ReadyBefore(start time.Time) [][]*spanRow {
+	return a.take(func(t *assemblingTrace) bool {
+		return start.Sub(t.lastEnd) >= a.window
+	})
+}
+
+// Flush removes and returns all buffered traces
+func (a *traceAssembler) Flush() [][]*spanRow {
+	return a.take(func(t *assemblingTrace) bool { return true })
+}
+
+func (a *traceAssembler) take(ready func(t *assemblingTrace) bool) [][]*spanRow {
+	var traces []*assemblingTrace
+	for id, t := range a.traces {
+		if ready(t) {
+			traces = append(traces, t)
+			delete(a.traces, id)
+			a.spans -= len(t.rows)
+		}
+	}
+	// Export traces in order of their first span, and spans in start order
+	res := make([][]*spanRow, 0, len(traces))
+	for _, t := range traces {
+		sort.SliceStable(t.rows, func(i, j int) bool {
+			return t.rows[i].startTime().Before(t.rows[j].startTime())
+		})
+		res = append(res, t.rows)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i][0].startTime().Before(res[j][0].startTime())
+	})
+	return res
+}
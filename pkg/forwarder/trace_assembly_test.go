@@ -0,0 +1,45 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+)
+
+// idRow returns a span of the trace with the given id halves, starting
+// offset after testStart
+func idRow(high, low, spanId int64, offset time.Duration) *spanRow {
+	end := testStart.Add(offset + time.Millisecond)
+	return &spanRow{
+		traceId:    high,
+		traceIdLow: low,
+		spanId:     spanId,
+		spanType:   "Select query",
+		spanStart:  testStart.Add(offset),
+		spanEnd:    &end,
+	}
+}
+
+func TestTraceAssemblerTraceIds(t *testing.T) {
+	a := newTraceAssembler(time.Second, BufferConfig{})
+	// Propagated 64-bit W3C ids have zero high bits
+	a.Add([]*spanRow{
+		idRow(0, 1, 10, 0),
+		idRow(0, 2, 20, time.Millisecond),
+		idRow(0, 1, 11, 2*time.Millisecond),
+		idRow(1, 0, 30, 3*time.Millisecond),
+	}, testStart)
+	if a.Traces() != 3 {
+		t.Fatalf("%d traces assembled, expected 3", a.Traces())
+	}
+	traces := a.Flush()
+	if len(traces) != 3 || len(traces[0]) != 2 || traces[0][1].spanId != 11 {
+		t.Fatalf("unexpected traces %v", traces)
+	}
+	for _, rows := range traces {
+		for _, r := range rows {
+			if r.traceID() != rows[0].traceID() {
+				t.Fatalf("span %d of trace %s assembled in trace %s", r.spanId, r.traceID(), rows[0].traceID())
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// tracingInfoCounters maps the counters of pg_tracing_info to metrics.
+// Counters missing from the installed pg_tracing version are skipped.
+var tracingInfoCounters = []struct {
+	column      string
+	metric      string
+	description string
+}{
+	{"processed_traces", "pg_tracing.traces.processed", "Traces processed by pg_tracing"},
+	{"processed_spans", "pg_tracing.spans.processed", "Spans generated by pg_tracing"},
+	{"dropped_traces", "pg_tracing.traces.dropped", "Traces dropped by pg_tracing"},
+	{"dropped_spans", "pg_tracing.spans.dropped", "Spans dropped by pg_tracing, e.g. when its buffer is full"},
+}
+
+const (
+	metricBufferUsage     = "pg_tracing.buffer.usage"
+	metricDroppedDetected = "pg_tracing.forwarder.detected_dropped_spans"
+)
+
+// fetchTracingInfo returns the integer columns of pg_tracing_info
+func fetchTracingInfo(ctx context.Context, conn *pgx.Conn) (map[string]int64, error) {
+	rows, err := conn.Query(ctx, "select * from pg_tracing_info()")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_tracing_info: %w", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query pg_tracing_info: %w", err)
+		}
+		return nil, fmt.Errorf("pg_tracing_info returned no row")
+	}
+	values, err := rows.Values()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_tracing_info: %w", err)
+	}
+	info := map[string]int64{}
+	for i, field := range rows.FieldDescriptions() {
+		switch v := values[i].(type) {
+		case int64:
+			info[field.Name] = v
+		case int32:
+			info[field.Name] = int64(v)
+		}
+	}
+	return info, rows.Err()
+}
+
+// fetchMaxSpan returns pg_tracing.max_span, the size of pg_tracing's span
+// buffer, or 0 if unknown
+func fetchMaxSpan(ctx context.Context, conn *pgx.Conn) (int64, error) {
+	var setting string
+	err := conn.QueryRow(ctx, "select coalesce(current_setting('pg_tracing.max_span', true), '')").Scan(&setting)
+	if err != nil || setting == "" {
+		return 0, err
+	}
+	return strconv.ParseInt(setting, 10, 64)
+}
+
+// tracingInfoMetrics exposes the last pg_tracing_info statistics as metrics
+type tracingInfoMetrics struct {
+	maxSpan int64
+	// dropped counts the spans dropped by pg_tracing between two polls
+	dropped metric.Int64Counter
+
+	mu          sync.Mutex
+	info        map[string]int64
+	bufferUsage float64
+	fetched     bool
+}
+
+func newTracingInfoMetrics(meter metric.Meter, maxSpan int64) (*tracingInfoMetrics, error) {
+	m := &tracingInfoMetrics{maxSpan: maxSpan}
+	var err error
+	m.dropped, err = meter.Int64Counter(metricDroppedDetected,
+		metric.WithDescription("Spans dropped by pg_tracing, detected between two polls"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dropped spans counter: %w", err)
+	}
+	var observables []metric.Observable
+	counters := map[string]metric.Int64ObservableCounter{}
+	for _, c := range tracingInfoCounters {
+		counter, err := meter.Int64ObservableCounter(c.metric, metric.WithDescription(c.description))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s counter: %w", c.metric, err)
+		}
+		counters[c.column] = counter
+		observables = append(observables, counter)
+	}
+	bufferUsage, err := meter.Float64ObservableGauge(metricBufferUsage,
+		metric.WithUnit("1"),
+		metric.WithDescription("Share of pg_tracing's span buffer used when spans were consumed"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buffer usage gauge: %w", err)
+	}
+	observables = append(observables, bufferUsage)
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if !m.fetched {
+			return nil
+		}
+		for column, counter := range counters {
+			if v, ok := m.info[column]; ok {
+				o.ObserveInt64(counter, v)
+			}
+		}
+		if m.maxSpan > 0 {
+			o.ObserveFloat64(bufferUsage, m.bufferUsage)
+		}
+		return nil
+	}, observables...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register pg_tracing_info callback: %w", err)
+	}
+	return m, nil
+}
+
+// update records the statistics read after consuming buffered spans and
+// returns the spans and traces dropped since the previous update
+func (m *tracingInfoMetrics) update(info map[string]int64, buffered int) (spans, traces int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fetched {
+		spans = counterIncrease(m.info, info, "dropped_spans")
+		traces = counterIncrease(m.info, info, "dropped_traces")
+	}
+	m.info = info
+	m.fetched = true
+	if m.maxSpan > 0 {
+		m.bufferUsage = float64(buffered) / float64(m.maxSpan)
+	}
+	return spans, traces
+}
+
+// counterIncrease returns the increase of a counter, 0 if it was reset
+func counterIncrease(previous, current map[string]int64, column string) int64 {
+	return max(current[column]-previous[column], 0)
+}
+
+func (fw *targetForwarder) initTracingInfo(ctx context.Context, meter metric.Meter) error {
+	if _, err := fetchTracingInfo(ctx, fw.conn); err != nil {
+		return err
+	}
+	maxSpan, err := fetchMaxSpan(ctx, fw.conn)
+	if err != nil {
+		fw.log.Printf("Failed to read pg_tracing.max_span, buffer usage is disabled: %v", err)
+	}
+	fw.tracingInfo, err = newTracingInfoMetrics(meter, maxSpan)
+	return err
+}
+
+// updateTracingInfo reads pg_tracing_info after consuming fetched spans
+func (fw *targetForwarder) updateTracingInfo(ctx context.Context, fetched int) {
+	if fw.tracingInfo == nil {
+		return
+	}
+	info, err := fetchTracingInfo(ctx, fw.conn)
+	if err != nil {
+		fw.log.Printf("Failed to read pg_tracing statistics: %v", err)
+		return
+	}
+	spans, traces := fw.tracingInfo.update(info, fetched)
+	if spans == 0 && traces == 0 {
+		return
+	}
+	fw.stats.pgTracingDropped.Add(spans)
+	fw.tracingInfo.dropped.Add(ctx, spans)
+	hint := "consider increasing pg_tracing.max_span or lowering poll_interval"
+	if fw.tracingInfo.maxSpan > 0 {
+		hint = fmt.Sprintf("consider increasing pg_tracing.max_span (currently %d) or lowering poll_interval", fw.tracingInfo.maxSpan)
+	}
+	fw.log.Printf("Warning: pg_tracing dropped %d spans and %d traces since the last poll, %s", spans, traces, hint)
+}
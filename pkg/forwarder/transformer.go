@@ -0,0 +1,209 @@
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Row is a span as read from pg_tracing. Unset numeric columns are zero.
+type Row struct {
+	// TraceId is the high 64 bits of the trace id, TraceIdLow the low ones
+	// of 128-bit trace ids
+	TraceId       int64
+	TraceIdLow    int64
+	ParentId      int64
+	SpanId        int64
+	SpanType      string
+	SpanOperation string
+	DeparseInfo   string
+	Parameters    string
+	Start         time.Time
+	End           time.Time
+	// Startup is the time to the first tuple
+	Startup      time.Duration
+	Pid          int32
+	SubxactCount int32
+	SqlErrorCode string
+	Rows         int64
+	QueryId      int64
+	DatabaseName string
+	UserName     string
+
+	PlanStartupCost float64
+	PlanTotalCost   float64
+	PlanRows        float64
+	PlanWidth       int64
+
+	SharedBlocks  BlockCounts
+	LocalBlocks   BlockCounts
+	BlockTime     BlockTimings
+	TempBlocks    BlockCounts
+	TempBlockTime BlockTimings
+
+	WalRecords int64
+	WalFpi     int64
+	WalBytes   int64
+
+	JitFunctions        int64
+	JitGenerationTime   float64
+	JitInliningTime     float64
+	JitOptimizationTime float64
+	JitEmissionTime     float64
+}
+
+// BlockCounts are the block counters of a row
+type BlockCounts struct {
+	Hit     int64
+	Read    int64
+	Dirtied int64
+	Written int64
+}
+
+// BlockTimings are the block I/O timings of a row, in milliseconds
+type BlockTimings struct {
+	Read  float64
+	Write float64
+}
+
+func newRow(r *spanRow) Row {
+	return Row{
+		TraceId:       r.traceId,
+		TraceIdLow:    r.traceIdLow,
+		ParentId:      r.parentId,
+		SpanId:        r.spanId,
+		SpanType:      r.spanType,
+		SpanOperation: r.spanOperation,
+		DeparseInfo:   r.deparseInfo.String,
+		Parameters:    r.parameters.String,
+		Start:         r.startTime(),
+		End:           r.endTime(),
+		Startup:       time.Duration(r.startup.Int64),
+		Pid:           r.pid,
+		SubxactCount:  r.subxactCount,
+		SqlErrorCode:  r.sqlErrorCode,
+		Rows:          r.rows.Int64,
+		QueryId:       r.queryId.Int64,
+		DatabaseName:  r.dbName,
+		UserName:      r.userName,
+
+		PlanStartupCost: r.planStartupCost.Float64,
+		PlanTotalCost:   r.planTotalCost.Float64,
+		PlanRows:        r.planRows.Float64,
+		PlanWidth:       r.planWidth.Int64,
+
+		SharedBlocks:  newBlockCounts(r.sharedBlks),
+		LocalBlocks:   newBlockCounts(r.localBlks),
+		BlockTime:     newBlockTimings(r.blkTime),
+		TempBlocks:    newBlockCounts(r.tempBlks),
+		TempBlockTime: newBlockTimings(r.tempBlkTime),
+
+		WalRecords: r.walRecords.Int64,
+		WalFpi:     r.walFpi.Int64,
+		WalBytes:   r.walBytes.Int64,
+
+		JitFunctions:        r.jitFunctions.Int64,
+		JitGenerationTime:   r.jitGenerationTime.Float64,
+		JitInliningTime:     r.jitInliningTime.Float64,
+		JitOptimizationTime: r.jitOptimizationTime.Float64,
+		JitEmissionTime:     r.jitEmissionTime.Float64,
+	}
+}
+
+func newBlockCounts(b BlockStats) BlockCounts {
+	return BlockCounts{Hit: b.hit.Int64, Read: b.read.Int64, Dirtied: b.dirtied.Int64, Written: b.written.Int64}
+}
+
+func newBlockTimings(b BlockTime) BlockTimings {
+	return BlockTimings{Read: b.readTime.Float64, Write: b.writeTime.Float64}
+}
+
+// Span is the in-progress span of a row, before it's started. The
+// Attributes slice is pooled and reused once the span is exported.
+type Span struct {
+	Name          string
+	Kind          trace.SpanKind
+	Attributes    []attribute.KeyValue
+	StatusCode    codes.Code
+	StatusMessage string
+}
+
+// SpanTransformer mutates the in-progress span of a row, returning false to
+// drop it. Transformers run after the transform statements and before the
+// truncation, concurrently with conversion_workers. The children of a
+// dropped span keep it as parent. The span and its attributes must not be
+// retained after Transform returns, copy them to keep them.
+type SpanTransformer interface {
+	Transform(row Row, span *Span) bool
+}
+
+// scriptTimeout bounds a WASM module's or Lua script's run on a span
+const scriptTimeout = 100 * time.Millisecond
+
+// SpanTransformerFunc adapts a function to a SpanTransformer
+type SpanTransformerFunc func(row Row, span *Span) bool
+
+func (f SpanTransformerFunc) Transform(row Row, span *Span) bool {
+	return f(row, span)
+}
+
+// builtinTransformers are the transformers named in transform.transformers
+var builtinTransformers = map[string]SpanTransformer{
+	// drop_planner drops the planning spans
+	"drop_planner": SpanTransformerFunc(func(row Row, span *Span) bool {
+		return row.SpanType != "Planner"
+	}),
+	// redact_parameters removes the query parameter attributes
+	"redact_parameters": SpanTransformerFunc(func(row Row, span *Span) bool {
+		attributes := span.Attributes[:0]
+		for _, attr := range span.Attributes {
+			if !strings.HasPrefix(string(attr.Key), parameterKeyPrefix) {
+				attributes = append(attributes, attr)
+			}
+		}
+		span.Attributes = attributes
+		return true
+	}),
+}
+
+// newSpanTransformers returns the built-in transformers of names, followed
+// by the ones registered through the library or by plugins
+func newSpanTransformers(names []string, registered []SpanTransformer) ([]SpanTransformer, error) {
+	var transformers []SpanTransformer
+	for _, name := range names {
+		transformer, ok := builtinTransformers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown span transformer %q", name)
+		}
+		transformers = append(transformers, transformer)
+	}
+	return append(transformers, registered...), nil
+}
+
+// transform runs the transformers on the span data, returning false when
+// one drops the span
+func transform(transformers []SpanTransformer, r *spanRow, data *spanData) bool {
+	if len(transformers) == 0 {
+		return true
+	}
+	row := newRow(r)
+	span := Span{
+		Name:          data.name,
+		Kind:          data.kind,
+		Attributes:    data.attributes,
+		StatusCode:    data.statusCode,
+		StatusMessage: data.statusMessage,
+	}
+	for _, transformer := range transformers {
+		if !transformer.Transform(row, &span) {
+			return false
+		}
+	}
+	data.name, data.kind, data.attributes = span.Name, span.Kind, span.Attributes
+	data.statusCode, data.statusMessage = span.StatusCode, span.StatusMessage
+	return true
+}
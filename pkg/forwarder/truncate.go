@@ -0,0 +1,57 @@
+package forwarder
+
+import (
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	ellipsis = "..."
+
+	truncatedKey = "otel.truncated"
+)
+
+// truncateString cuts s to at most max bytes, ending with an ellipsis and
+// without splitting a multi-byte character.
+func truncateString(s string, max int) (string, bool) {
+	if max <= 0 || len(s) <= max {
+		return s, false
+	}
+	cut := max - len(ellipsis)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	if max < len(ellipsis) {
+		return s[:cut], true
+	}
+	return s[:cut] + ellipsis, true
+}
+
+// apply truncates the span name and string attributes according to the
+// configured limits. When anything was cut, otel.truncated=true is added.
+func (l LimitsConfig) apply(spanName string, attributes []attribute.KeyValue) (string, []attribute.KeyValue) {
+	spanName, truncated := truncateString(spanName, l.MaxSpanNameLength)
+	for i, attr := range attributes {
+		if attr.Value.Type() != attribute.STRING {
+			continue
+		}
+		max := l.MaxAttributeLength
+		if attr.Key == semconv.DBStatementKey && l.MaxStatementLength > 0 {
+			max = l.MaxStatementLength
+		}
+		value, cut := truncateString(attr.Value.AsString(), max)
+		if cut {
+			attributes[i] = attr.Key.String(value)
+			truncated = true
+		}
+	}
+	if truncated {
+		attributes = append(attributes, attribute.Bool(truncatedKey, true))
+	}
+	return spanName, attributes
+}
@@ -0,0 +1,242 @@
+package forwarder
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/term"
+)
+
+const (
+	ansiClear = "\x1b[H\x1b[2J"
+	ansiRed   = "\x1b[31m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiReset = "\x1b[0m"
+)
+
+// tuiTrace holds the spans received for a trace
+type tuiTrace struct {
+	traceId trace.TraceID
+	rows    []*spanRow
+	start   time.Time
+	end     time.Time
+	errors  int
+}
+
+func (t *tuiTrace) add(r *spanRow) {
+	if len(t.rows) == 0 || r.startTime().Before(t.start) {
+		t.start = r.startTime()
+	}
+	if r.endTime().After(t.end) {
+		t.end = r.endTime()
+	}
+	if isSqlError(r.sqlErrorCode) {
+		t.errors++
+	}
+	t.rows = append(t.rows, r)
+}
+
+// traceStore keeps the most recent traces
+type traceStore struct {
+	maxTraces int
+
+	mu     sync.Mutex
+	seen   *dedupCache
+	traces map[trace.TraceID]*tuiTrace
+}
+
+func newTraceStore(maxTraces int) *traceStore {
+	return &traceStore{
+		maxTraces: maxTraces,
+		seen:      newDedupCache(tailSeenSpans, 0),
+		traces:    map[trace.TraceID]*tuiTrace{},
+	}
+}
+
+func (s *traceStore) add(rows []*spanRow, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range rows {
+		if s.seen.isDuplicate(r, now) {
+			continue
+		}
+		traceId := r.traceID()
+		t, ok := s.traces[traceId]
+		if !ok {
+			t = &tuiTrace{traceId: traceId}
+			s.traces[traceId] = t
+		}
+		t.add(r)
+	}
+	recent := s.sorted()
+	for _, t := range recent[min(len(recent), s.maxTraces):] {
+		delete(s.traces, t.traceId)
+	}
+}
+
+// recent returns the traces, most recent first. Traces can't be modified
+// once returned.
+func (s *traceStore) recent() []*tuiTrace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	traces := s.sorted()
+	for i, t := range traces {
+		copied := *t
+		copied.rows = append([]*spanRow(nil), t.rows...)
+		traces[i] = &copied
+	}
+	return traces
+}
+
+func (s *traceStore) sorted() []*tuiTrace {
+	traces := make([]*tuiTrace, 0, len(s.traces))
+	for _, t := range s.traces {
+		traces = append(traces, t)
+	}
+	sort.Slice(traces, func(i, j int) bool {
+		return traces[i].start.After(traces[j].start)
+	})
+	return traces
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+}
+
+func tuiSpanLabel(r *spanRow) string {
+	label := r.spanType
+	if r.spanOperation != "" {
+		label += ": " + strings.Join(strings.Fields(r.spanOperation), " ")
+	}
+	if r.deparseInfo.Valid && r.deparseInfo.String != "" {
+		label += " " + r.deparseInfo.String
+	}
+	return label
+}
+
+// renderTrace appends the lines of a trace's span tree, with a header line if
+// colors are enabled. Spans whose parent isn't in the trace are rendered as
+// roots.
+func renderTrace(lines []string, t *tuiTrace, width int, colors bool) []string {
+	if colors {
+		status := ""
+		if t.errors > 0 {
+			status = fmt.Sprintf(" %s%d errors%s", ansiRed, t.errors, ansiReset)
+		}
+		lines = append(lines, fmt.Sprintf("%strace %s%s  %s  %d spans  %s%s%s",
+			ansiBold, t.traceId, ansiReset, formatDuration(t.end.Sub(t.start)), len(t.rows),
+			ansiDim, t.start.Local().Format("15:04:05.000"), ansiReset)+status)
+	}
+
+	spanIds := make(map[int64]bool, len(t.rows))
+	children := map[int64][]*spanRow{}
+	for _, r := range t.rows {
+		spanIds[r.spanId] = true
+	}
+	var roots []*spanRow
+	for _, r := range t.rows {
+		if spanIds[r.parentId] {
+			children[r.parentId] = append(children[r.parentId], r)
+		} else {
+			roots = append(roots, r)
+		}
+	}
+	byStart := func(rows []*spanRow) {
+		sort.Slice(rows, func(i, j int) bool { return rows[i].startTime().Before(rows[j].startTime()) })
+	}
+
+	var walk func(r *spanRow, prefix string, last bool, depth int)
+	walk = func(r *spanRow, prefix string, last bool, depth int) {
+		branch, next := "├─ ", "│  "
+		if last {
+			branch, next = "└─ ", "   "
+		}
+		duration := formatDuration(r.endTime().Sub(r.startTime()))
+		label := tuiSpanLabel(r)
+		// Keep the duration visible, truncating the label
+		if avail := width - len([]rune(prefix+branch)) - len(duration) - 2; avail > 3 {
+			label, _ = truncateString(label, avail)
+		}
+		line := prefix + branch + label
+		padding := width - len([]rune(line)) - len(duration)
+		line += strings.Repeat(" ", max(padding, 1)) + duration
+		if isSqlError(r.sqlErrorCode) {
+			line += " " + r.sqlErrorCode
+			if colors {
+				line = ansiRed + line + ansiReset
+			}
+		}
+		lines = append(lines, line)
+		// Bound the depth in case of an id cycle
+		if depth > len(t.rows) {
+			return
+		}
+		kids := children[r.spanId]
+		byStart(kids)
+		for i, child := range kids {
+			walk(child, prefix+next, i == len(kids)-1, depth+1)
+		}
+	}
+	byStart(roots)
+	for i, r := range roots {
+		walk(r, "", i == len(roots)-1, 0)
+	}
+	if !colors {
+		return lines
+	}
+	return append(lines, "")
+}
+
+func renderTraces(s *traceStore, now time.Time) string {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 120, 40
+	}
+	traces := s.recent()
+	spans := 0
+	for _, t := range traces {
+		spans += len(t.rows)
+	}
+	lines := []string{
+		fmt.Sprintf("%spg_tracing live traces%s  %d traces, %d spans  refreshed %s  (Ctrl-C to quit)",
+			ansiBold, ansiReset, len(traces), spans, now.Format("15:04:05")),
+		"",
+	}
+	for _, t := range traces {
+		if len(lines) >= height {
+			break
+		}
+		lines = renderTrace(lines, t, width, true)
+	}
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	return ansiClear + strings.Join(lines, "\n")
+}
+
+// tuiCommand renders the traces in pg_tracing's buffer as trees, refreshed
+// in real time. Spans aren't consumed.
+func tuiCommand(args []string) error {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	interval := fs.Duration("interval", time.Second, "Delay between two refreshes")
+	maxTraces := fs.Int("max-traces", 100, "Number of recent traces kept")
+	fs.Parse(args)
+	if *maxTraces <= 0 {
+		return fmt.Errorf("max-traces must be positive")
+	}
+
+	store := newTraceStore(*maxTraces)
+	err := peekSpans(*interval, func(rows []*spanRow, now time.Time) {
+		store.add(rows, now)
+		fmt.Print(renderTraces(store, now))
+	})
+	fmt.Println()
+	return err
+}
@@ -0,0 +1,27 @@
+package forwarder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTraceStoreTraceIds(t *testing.T) {
+	s := newTraceStore(10)
+	s.add([]*spanRow{idRow(0, 1, 10, 0), idRow(0, 2, 20, 0)}, testStart)
+	traces := s.recent()
+	if len(traces) != 2 {
+		t.Fatalf("%d traces, expected 2", len(traces))
+	}
+	ids := map[string]bool{}
+	for _, tr := range traces {
+		ids[tr.traceId.String()] = true
+	}
+	for _, id := range []string{"00000000000000000000000000000001", "00000000000000000000000000000002"} {
+		if !ids[id] {
+			t.Errorf("trace %s missing from %v", id, ids)
+		}
+	}
+	if header := renderTrace(nil, traces[0], 120, true)[0]; !strings.Contains(header, traces[0].traceId.String()) {
+		t.Errorf("header %q doesn't show the full trace id", header)
+	}
+}
@@ -0,0 +1,253 @@
+package forwarder
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/connectivity"
+)
+
+const validateTimeout = 5 * time.Second
+
+// requiredSpanColumns lists the columns of spanColumns
+func requiredSpanColumns() []string {
+	var columns []string
+	for _, column := range strings.Split(spanColumns, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// validationReport prints the result of each check
+type validationReport struct {
+	failed int
+}
+
+func (r *validationReport) check(name string, err error) bool {
+	if err != nil {
+		r.failed++
+		fmt.Printf("[FAIL] %s: %v\n", name, err)
+		return false
+	}
+	fmt.Printf("[ OK ] %s\n", name)
+	return true
+}
+
+func (r *validationReport) skip(name string, reason string) {
+	fmt.Printf("[SKIP] %s: %s\n", name, reason)
+}
+
+func checkPgTracing(ctx context.Context, conn *pgx.Conn) (string, error) {
+	var version string
+	err := conn.QueryRow(ctx, "select extversion from pg_extension where extname = 'pg_tracing'").Scan(&version)
+	if err == pgx.ErrNoRows {
+		return "", fmt.Errorf("pg_tracing extension isn't installed in database %s", conn.Config().Database)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read pg_tracing version: %w", err)
+	}
+	return version, nil
+}
+
+func checkSpanColumns(ctx context.Context, conn *pgx.Conn) error {
+	columns, err := detectSpanColumns(ctx, conn)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, column := range requiredSpanColumns() {
+		if columns[column] == "" {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkTcp checks an address accepts connections
+func checkTcp(address string) error {
+	conn, err := net.DialTimeout("tcp", address, validateTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// urlAddress returns the host:port of an URL, with the scheme's default port
+func urlAddress(rawUrl string) (string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return "", err
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443"), nil
+	}
+	return net.JoinHostPort(u.Hostname(), "80"), nil
+}
+
+func checkUrl(rawUrl string) error {
+	address, err := urlAddress(rawUrl)
+	if err != nil {
+		return err
+	}
+	return checkTcp(address)
+}
+
+// checkCollector waits for the connection to an OTLP endpoint, dialed in
+// the background, to be ready
+func checkCollector(ctx context.Context, cfg CollectorConfig, endpoint string) error {
+	conn, err := dialCollector(ctx, cfg, endpoint)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(ctx, validateTimeout)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("failed to connect to collector %s: %w", endpoint, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// checkExporter checks the endpoints of the configured exporter and sinks
+// accept connections
+func checkExporter(ctx context.Context, cfg *Config, report *validationReport) {
+	switch cfg.Exporter.Type {
+	case exporterOtlp:
+		endpoints := []string{cfg.Exporter.Endpoint}
+		for _, r := range cfg.Routes {
+			endpoints = append(endpoints, r.Endpoint)
+		}
+		for _, endpoint := range endpoints {
+			report.check("collector "+endpoint+" reachable", checkCollector(ctx, cfg.Collector, endpoint))
+		}
+	case exporterFile:
+		file, err := os.OpenFile(cfg.Exporter.File.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err == nil {
+			err = file.Close()
+		}
+		report.check("span file "+cfg.Exporter.File.Path+" writable", err)
+	case exporterKafka:
+		for _, broker := range cfg.Exporter.Kafka.Brokers {
+			report.check("kafka broker "+broker+" reachable", checkTcp(broker))
+		}
+	case exporterJaeger:
+		if cfg.Exporter.Jaeger.Agent != "" {
+			report.skip("jaeger agent "+cfg.Exporter.Jaeger.Agent+" reachable", "agents are reached over UDP")
+			break
+		}
+		endpoint := cfg.Exporter.Jaeger.Endpoint
+		if endpoint == "" {
+			endpoint = defaultJaegerEndpoint
+		}
+		report.check("jaeger collector "+endpoint+" reachable", checkUrl(endpoint))
+	case exporterDatadog:
+		agent := cfg.Exporter.Datadog.Agent
+		if agent == "" {
+			agent = defaultDatadogAgent
+		}
+		report.check("datadog agent "+agent+" reachable", checkUrl(agent))
+	case exporterXRay:
+		report.skip("xray daemon reachable", "the daemon is reached over UDP")
+	}
+	if cfg.Metrics.Endpoint != "" {
+		report.check("metrics collector "+cfg.Metrics.Endpoint+" reachable", checkCollector(ctx, cfg.Collector, cfg.Metrics.Endpoint))
+	}
+	if cfg.Logs.Endpoint != "" {
+		report.check("logs collector "+cfg.Logs.Endpoint+" reachable", checkCollector(ctx, cfg.Collector, cfg.Logs.Endpoint))
+	}
+	if cfg.Sinks.ClickHouse.Endpoint != "" {
+		report.check("clickhouse "+cfg.Sinks.ClickHouse.Endpoint+" reachable", checkUrl(cfg.Sinks.ClickHouse.Endpoint))
+	}
+}
+
+// checkDatabase checks the target's connection and pg_tracing installation
+func checkDatabase(cfg ConnectionConfig, t TargetConfig, report *validationReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	suffix := ""
+	if t.Name != "" {
+		suffix = " (" + t.Name + ")"
+	}
+	connector, err := newConnector(cfg, t.DSN)
+	var conn *pgx.Conn
+	if err == nil {
+		defer connector.close()
+		conn, err = connector.connect(ctx)
+	}
+	if !report.check("database connection"+suffix, err) {
+		report.skip("pg_tracing installed"+suffix, "no database connection")
+		return
+	}
+	defer conn.Close(ctx)
+	version, err := checkPgTracing(ctx, conn)
+	if !report.check("pg_tracing installed"+suffix, err) {
+		report.skip("pg_tracing provides the required columns"+suffix, "pg_tracing isn't installed")
+		return
+	}
+	fmt.Printf("       pg_tracing version %s, read with the %s\n", version, describeAdapter(adapterForVersion(version)))
+	report.check("pg_tracing provides the required columns"+suffix, checkSpanColumns(ctx, conn))
+}
+
+// validateCommand checks the forwarder can run with the given configuration
+func validateCommand(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to the YAML configuration file")
+	exporter := fs.String("exporter", "", "Exporter to use: "+exporterTypesUsage())
+	fs.Parse(args)
+
+	report := &validationReport{}
+	cfg, err := LoadConfig(*configPath)
+	if err == nil && *exporter != "" {
+		cfg.Exporter.Type = *exporter
+		err = cfg.validate()
+	}
+	configOk := report.check("configuration is valid", err)
+
+	targets := []TargetConfig{{DSN: os.Getenv("DATABASE_URL")}}
+	if configOk && cfg.Discovery.enabled() {
+		discovered, err := discoverTargets(context.Background(), cfg)
+		if report.check("target discovery", err) {
+			targets = discovered
+		} else {
+			targets = cfg.Targets
+		}
+	} else if configOk {
+		targets = cfg.targets()
+	}
+	connection := DefaultConfig().Connection
+	if configOk {
+		connection = cfg.Connection
+	}
+	for _, t := range targets {
+		checkDatabase(connection, t, report)
+	}
+
+	if configOk {
+		checkExporter(context.Background(), cfg, report)
+	} else {
+		report.skip("exporter reachable", "invalid configuration")
+	}
+
+	if report.failed > 0 {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+	return nil
+}
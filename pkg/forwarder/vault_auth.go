@@ -0,0 +1,198 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// vaultCredentials fetches short-lived credentials from a Vault database
+// secrets engine. Their lease is renewed from half its duration, and new
+// credentials are fetched once the remaining third can't be extended, e.g.
+// when reaching the max TTL.
+type vaultCredentials struct {
+	cfg    VaultAuthConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	user     string
+	password string
+	leaseId  string
+	duration time.Duration
+	expires  time.Time
+	renewAt  time.Time
+}
+
+// vaultSecret is the response of a credential read, a lease renewal or a
+// login
+type vaultSecret struct {
+	LeaseId       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	Data          struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"data"`
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func validateVaultAuthConfig(c VaultAuthConfig) error {
+	if c.Role == "" {
+		return fmt.Errorf("vault authentication requires a role")
+	}
+	if c.TokenFile != "" && c.Kubernetes.Role != "" {
+		return fmt.Errorf("vault token_file and kubernetes role are exclusive")
+	}
+	return nil
+}
+
+func newVaultCredentials(cfg VaultAuthConfig) *vaultCredentials {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "database"
+	}
+	if cfg.Kubernetes.Role != "" && cfg.Kubernetes.Mount == "" {
+		cfg.Kubernetes.Mount = "kubernetes"
+	}
+	return &vaultCredentials{cfg: cfg, client: &http.Client{Timeout: vaultTimeout}}
+}
+
+// valid returns whether the cached credentials can be used for a new
+// connection
+func (v *vaultCredentials) valid(now time.Time) bool {
+	return v.user != "" && v.expires.Sub(now) > v.duration/3
+}
+
+func (v *vaultCredentials) credentials(ctx context.Context) (string, string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	if v.valid(now) {
+		return v.user, v.password, nil
+	}
+	var secret vaultSecret
+	if err := v.do(ctx, http.MethodGet, fmt.Sprintf("/v1/%s/creds/%s", v.cfg.Mount, v.cfg.Role), nil, &secret); err != nil {
+		return "", "", fmt.Errorf("failed to read vault credentials: %w", err)
+	}
+	// The previous credentials aren't used by new connections anymore
+	if v.leaseId != "" {
+		if err := v.do(ctx, http.MethodPut, "/v1/sys/leases/revoke", map[string]string{"lease_id": v.leaseId}, nil); err != nil {
+			log.Printf("Failed to revoke vault lease: %v", err)
+		}
+	}
+	v.user, v.password = secret.Data.Username, secret.Data.Password
+	v.leaseId = secret.LeaseId
+	v.duration = time.Duration(secret.LeaseDuration) * time.Second
+	v.setExpiry(now, v.duration, secret.Renewable)
+	return v.user, v.password, nil
+}
+
+// setExpiry schedules the renewal at half of the lease, never renewing
+// non-renewable ones
+func (v *vaultCredentials) setExpiry(now time.Time, ttl time.Duration, renewable bool) {
+	v.expires = now.Add(ttl)
+	v.renewAt = now.Add(ttl / 2)
+	if !renewable {
+		v.renewAt = v.expires
+	}
+}
+
+func (v *vaultCredentials) renew(ctx context.Context) (bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := time.Now()
+	if v.leaseId == "" || now.Before(v.renewAt) {
+		return !v.valid(now), nil
+	}
+	var secret vaultSecret
+	body := map[string]any{"lease_id": v.leaseId, "increment": int(v.duration.Seconds())}
+	if err := v.do(ctx, http.MethodPut, "/v1/sys/leases/renew", body, &secret); err != nil {
+		return !v.valid(now), fmt.Errorf("failed to renew vault lease: %w", err)
+	}
+	v.setExpiry(now, time.Duration(secret.LeaseDuration)*time.Second, secret.Renewable)
+	return !v.valid(now), nil
+}
+
+// token returns the Vault token, from the token file or VAULT_TOKEN, or
+// logging in with the pod's service account
+func (v *vaultCredentials) token(ctx context.Context) (string, error) {
+	if v.cfg.Kubernetes.Role != "" {
+		jwt, err := os.ReadFile(kubeServiceAccountDir + "/token")
+		if err != nil {
+			return "", fmt.Errorf("failed to read the service account token: %w", err)
+		}
+		var secret vaultSecret
+		body := map[string]string{"role": v.cfg.Kubernetes.Role, "jwt": strings.TrimSpace(string(jwt))}
+		if err := v.request(ctx, http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", v.cfg.Kubernetes.Mount), "", body, &secret); err != nil {
+			return "", fmt.Errorf("failed to login to vault: %w", err)
+		}
+		return secret.Auth.ClientToken, nil
+	}
+	if v.cfg.TokenFile != "" {
+		token, err := os.ReadFile(v.cfg.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read vault token: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return os.Getenv("VAULT_TOKEN"), nil
+}
+
+// do sends an authenticated request to Vault
+func (v *vaultCredentials) do(ctx context.Context, method, path string, body any, out any) error {
+	token, err := v.token(ctx)
+	if err != nil {
+		return err
+	}
+	return v.request(ctx, method, path, token, body, out)
+}
+
+func (v *vaultCredentials) request(ctx context.Context, method, path, token string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode vault request: %w", err)
+		}
+		reqBody = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(v.cfg.Address, "/")+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create vault request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var secret vaultSecret
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		json.NewDecoder(resp.Body).Decode(&secret)
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(secret.Errors, ", "))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package forwarder
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Backoff between checks of the pg_tracing extension
+const (
+	extensionMinBackoff = time.Second
+	extensionMaxBackoff = time.Minute
+)
+
+// waitForExtension polls pg_extension until pg_tracing is installed, e.g.
+// while a fresh instance is provisioned, doubling the delay between checks
+func waitForExtension(ctx context.Context, conn *pgx.Conn, logger *log.Logger) error {
+	backoff := extensionMinBackoff
+	for {
+		version, err := checkPgTracing(ctx, conn)
+		if err == nil {
+			logger.Printf("Found pg_tracing %s", version)
+			return nil
+		}
+		logger.Printf("Waiting for pg_tracing, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, extensionMaxBackoff)
+	}
+}
@@ -0,0 +1,308 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	goruntime "runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// wasmSpan is the JSON representation of a span exchanged with WASM
+// modules. Attribute values are strings, booleans, numbers or string arrays.
+type wasmSpan struct {
+	Name          string         `json:"name"`
+	Kind          int            `json:"kind"`
+	Attributes    map[string]any `json:"attributes"`
+	StatusCode    int            `json:"status_code"`
+	StatusMessage string         `json:"status_message"`
+}
+
+type wasmRow struct {
+	TraceId       int64  `json:"trace_id"`
+	ParentId      int64  `json:"parent_id"`
+	SpanId        int64  `json:"span_id"`
+	SpanType      string `json:"span_type"`
+	SpanOperation string `json:"span_operation"`
+	DeparseInfo   string `json:"deparse_info"`
+	Parameters    string `json:"parameters"`
+	Start         int64  `json:"start_unix_nano"`
+	End           int64  `json:"end_unix_nano"`
+	Pid           int32  `json:"pid"`
+	SqlErrorCode  string `json:"sql_error_code"`
+	QueryId       int64  `json:"query_id"`
+	DatabaseName  string `json:"database_name"`
+	UserName      string `json:"user_name"`
+}
+
+type wasmInput struct {
+	Row  wasmRow  `json:"row"`
+	Span wasmSpan `json:"span"`
+}
+
+// wasmTransformer runs a WASM module's transform function on spans. The
+// module exports its memory and:
+//
+//	alloc(size i32) i32: returns a buffer of size bytes
+//	transform(ptr i32, len i32) i64: reads the JSON row and span at ptr, and
+//	returns the JSON span to export packed as ptr << 32 | len, or 0 to drop it
+//
+// Buffers are owned by the module, which can reuse them between calls. A
+// module instance isn't safe for concurrent use, idle instances are kept in
+// a free list for the conversion workers. The runtime holds every instance
+// until it's closed, instances not fitting in the free list are closed.
+type wasmTransformer struct {
+	path string
+	// timeout bounds each transform, the instance being closed when reached
+	timeout time.Duration
+	// module is replaced when the file changes
+	module atomic.Pointer[wasmModule]
+}
+
+// wasmModule is a compiled module with its runtime and idle instances
+type wasmModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	idle     chan api.Module
+	// hash is the SHA-256 of the module's source
+	hash [sha256.Size]byte
+}
+
+var (
+	wasmTransformersMu sync.Mutex
+	// wasmTransformers are shared by the converters of every target and
+	// the ones created on reload, their module being recompiled when the
+	// file changes
+	wasmTransformers = map[string]*wasmTransformer{}
+)
+
+// newWasmTransformer compiles the module at path, replacing and closing the
+// previous module compiled from path when the file changed. Modules only
+// get the WASI functions, without access to the file system or the
+// environment.
+func newWasmTransformer(path string) (*wasmTransformer, error) {
+	wasmTransformersMu.Lock()
+	defer wasmTransformersMu.Unlock()
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wasm module: %w", err)
+	}
+	hash := sha256.Sum256(source)
+	t, ok := wasmTransformers[path]
+	if ok && t.module.Load().hash == hash {
+		return t, nil
+	}
+	module, err := compileWasmModule(path, source)
+	if err != nil {
+		return nil, err
+	}
+	module.hash = hash
+	if !ok {
+		t = &wasmTransformer{path: path, timeout: scriptTimeout}
+		wasmTransformers[path] = t
+	}
+	// Transforms running on the replaced module fail, keeping their span
+	if previous := t.module.Swap(module); previous != nil {
+		previous.runtime.Close(context.Background())
+	}
+	return t, nil
+}
+
+func compileWasmModule(path string, source []byte) (*wasmModule, error) {
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	compiled, err := runtime.CompileModule(ctx, source)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to compile wasm module %s: %w", path, err)
+	}
+	for _, name := range []string{"alloc", "transform"} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			runtime.Close(ctx)
+			return nil, fmt.Errorf("wasm module %s doesn't export %s", path, name)
+		}
+	}
+	// At most GOMAXPROCS conversion workers run a module at once
+	return &wasmModule{runtime: runtime, compiled: compiled, idle: make(chan api.Module, goruntime.GOMAXPROCS(0))}, nil
+}
+
+// instance returns an idle instance, or a new one if none is left
+func (w *wasmModule) instance(ctx context.Context) (api.Module, error) {
+	select {
+	case m := <-w.idle:
+		return m, nil
+	default:
+	}
+	// Reactor modules are initialized, command modules aren't started
+	config := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	return w.runtime.InstantiateModule(ctx, w.compiled, config)
+}
+
+// release puts back an instance in the free list, closing it when full
+func (w *wasmModule) release(ctx context.Context, m api.Module) {
+	select {
+	case w.idle <- m:
+	default:
+		m.Close(ctx)
+	}
+}
+
+func (t *wasmTransformer) Transform(row Row, span *Span) bool {
+	keep, err := t.transform(row, span)
+	if err != nil {
+		// Spans are kept unchanged when the module fails
+		log.Printf("Failed to run wasm module %s: %v", t.path, err)
+		return true
+	}
+	return keep
+}
+
+func (t *wasmTransformer) transform(row Row, span *Span) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	input, err := json.Marshal(wasmInput{Row: newWasmRow(row), Span: newWasmSpan(span)})
+	if err != nil {
+		return true, fmt.Errorf("failed to encode span: %w", err)
+	}
+	module := t.module.Load()
+	m, err := module.instance(ctx)
+	if err != nil {
+		return true, fmt.Errorf("failed to instantiate wasm module %s: %w", t.path, err)
+	}
+	keep, err := t.call(ctx, m, input, span)
+	if err != nil {
+		// The instance may be left in an inconsistent state
+		m.Close(ctx)
+		return true, err
+	}
+	module.release(ctx, m)
+	return keep, nil
+}
+
+// call runs the instance's transform function on the encoded input
+func (t *wasmTransformer) call(ctx context.Context, m api.Module, input []byte, span *Span) (bool, error) {
+	res, err := m.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return true, fmt.Errorf("failed to allocate module memory: %w", err)
+	}
+	ptr := uint32(res[0])
+	if !m.Memory().Write(ptr, input) {
+		return true, fmt.Errorf("allocated buffer is out of memory bounds")
+	}
+	res, err = m.ExportedFunction("transform").Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return true, fmt.Errorf("failed to transform span: %w", err)
+	}
+	if res[0] == 0 {
+		return false, nil
+	}
+	output, ok := m.Memory().Read(uint32(res[0]>>32), uint32(res[0]))
+	if !ok {
+		return true, fmt.Errorf("returned span is out of memory bounds")
+	}
+	var transformed wasmSpan
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.UseNumber()
+	if err := decoder.Decode(&transformed); err != nil {
+		return true, fmt.Errorf("failed to decode returned span: %w", err)
+	}
+	transformed.apply(span)
+	return true, nil
+}
+
+func newWasmRow(row Row) wasmRow {
+	return wasmRow{
+		TraceId:       row.TraceId,
+		ParentId:      row.ParentId,
+		SpanId:        row.SpanId,
+		SpanType:      row.SpanType,
+		SpanOperation: row.SpanOperation,
+		DeparseInfo:   row.DeparseInfo,
+		Parameters:    row.Parameters,
+		Start:         row.Start.UnixNano(),
+		End:           row.End.UnixNano(),
+		Pid:           row.Pid,
+		SqlErrorCode:  row.SqlErrorCode,
+		QueryId:       row.QueryId,
+		DatabaseName:  row.DatabaseName,
+		UserName:      row.UserName,
+	}
+}
+
+func newWasmSpan(span *Span) wasmSpan {
+	attributes := make(map[string]any, len(span.Attributes))
+	for _, attr := range span.Attributes {
+		attributes[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	return wasmSpan{
+		Name:          span.Name,
+		Kind:          int(span.Kind),
+		Attributes:    attributes,
+		StatusCode:    int(span.StatusCode),
+		StatusMessage: span.StatusMessage,
+	}
+}
+
+// apply sets the span from the module's JSON span. Attributes are sorted by
+// key, integral numbers are converted to integers.
+func (w wasmSpan) apply(span *Span) {
+	span.Name = w.Name
+	span.Kind = trace.SpanKind(w.Kind)
+	span.StatusCode = codes.Code(w.StatusCode)
+	span.StatusMessage = w.StatusMessage
+	keys := make([]string, 0, len(w.Attributes))
+	for key := range w.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	span.Attributes = span.Attributes[:0]
+	for _, key := range keys {
+		k := attribute.Key(key)
+		switch value := w.Attributes[key].(type) {
+		case string:
+			span.Attributes = append(span.Attributes, k.String(value))
+		case bool:
+			span.Attributes = append(span.Attributes, k.Bool(value))
+		case json.Number:
+			if i, err := value.Int64(); err == nil {
+				span.Attributes = append(span.Attributes, k.Int64(i))
+			} else if f, err := value.Float64(); err == nil {
+				span.Attributes = append(span.Attributes, k.Float64(f))
+			}
+		case []any:
+			strs := make([]string, 0, len(value))
+			for _, item := range value {
+				strs = append(strs, fmt.Sprint(item))
+			}
+			span.Attributes = append(span.Attributes, k.StringSlice(strs))
+		}
+	}
+}
+
+// wasmSpanTransformers compiles the WASM modules at paths
+func wasmSpanTransformers(paths []string) ([]SpanTransformer, error) {
+	var transformers []SpanTransformer
+	for _, path := range paths {
+		t, err := newWasmTransformer(path)
+		if err != nil {
+			return nil, err
+		}
+		transformers = append(transformers, t)
+	}
+	return transformers, nil
+}
@@ -0,0 +1,237 @@
+package forwarder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tetratelabs/wazero/api"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// wasmTestModule assembles a module whose alloc returns a buffer at 1024,
+// and whose transform returns result, the span encoded in output being
+// stored at offset 0
+func wasmTestModule(output string, result int64) []byte {
+	return wasmTestModuleCode(output, append(append([]byte{0x42}, sleb128(result)...), 0x0b))
+}
+
+// wasmTestModuleCode assembles a module running the transform instructions
+func wasmTestModuleCode(output string, transform []byte) []byte {
+	section := func(id byte, items ...[]byte) []byte {
+		var body []byte
+		body = append(body, uleb128(uint64(len(items)))...)
+		for _, item := range items {
+			body = append(body, item...)
+		}
+		return append(append([]byte{id}, uleb128(uint64(len(body)))...), body...)
+	}
+	name := func(s string) []byte {
+		return append(uleb128(uint64(len(s))), s...)
+	}
+	code := func(instructions ...byte) []byte {
+		body := append([]byte{0}, instructions...)
+		return append(uleb128(uint64(len(body))), body...)
+	}
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1,
+		[]byte{0x60, 1, 0x7f, 1, 0x7f},
+		[]byte{0x60, 2, 0x7f, 0x7f, 1, 0x7e},
+	)...)
+	module = append(module, section(3, []byte{0}, []byte{1})...)
+	module = append(module, section(5, []byte{0x00, 1})...)
+	module = append(module, section(7,
+		append(name("memory"), 0x02, 0),
+		append(name("alloc"), 0x00, 0),
+		append(name("transform"), 0x00, 1),
+	)...)
+	module = append(module, section(10,
+		code(0x41, 0x80, 0x08, 0x0b),
+		code(transform...),
+	)...)
+	segment := append([]byte{0x00, 0x41, 0x00, 0x0b}, name(output)...)
+	return append(module, section(11, segment)...)
+}
+
+func uleb128(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if v == 0 {
+			return out
+		}
+	}
+}
+
+func sleb128(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func newTestWasmTransformer(t *testing.T, output string, result int64) *wasmTransformer {
+	t.Helper()
+	return newTestWasmModule(t, wasmTestModule(output, result))
+}
+
+func newTestWasmModule(t *testing.T, module []byte) *wasmTransformer {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transform.wasm")
+	if err := os.WriteFile(path, module, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	transformer, err := newWasmTransformer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { transformer.module.Load().runtime.Close(context.Background()) })
+	return transformer
+}
+
+func TestWasmTransformMany(t *testing.T) {
+	output := `{"name":"renamed","kind":2,"attributes":{"tenant":"a","n":1}}`
+	transformer := newTestWasmTransformer(t, output, int64(len(output)))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4*cap(transformer.module.Load().idle); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				span := &Span{Name: "select 1;", Attributes: []attribute.KeyValue{attribute.String("db.system", "postgresql")}}
+				if !transformer.Transform(Row{SpanId: int64(i)}, span) {
+					t.Error("span was dropped")
+					return
+				}
+				if span.Name != "renamed" || len(span.Attributes) != 2 {
+					t.Errorf("unexpected span %+v", span)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(transformer.module.Load().idle) > cap(transformer.module.Load().idle) {
+		t.Fatalf("%d idle instances", len(transformer.module.Load().idle))
+	}
+}
+
+func TestWasmTransformDrop(t *testing.T) {
+	transformer := newTestWasmTransformer(t, "", 0)
+	if transformer.Transform(Row{}, &Span{Name: "Planner"}) {
+		t.Fatal("span wasn't dropped")
+	}
+}
+
+func TestWasmReleaseClosesExtraInstances(t *testing.T) {
+	transformer := newTestWasmTransformer(t, "{}", 2)
+	ctx := context.Background()
+	var instances []api.Module
+	for i := 0; i < cap(transformer.module.Load().idle)+2; i++ {
+		m, err := transformer.module.Load().instance(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		instances = append(instances, m)
+	}
+	for _, m := range instances {
+		transformer.module.Load().release(ctx, m)
+	}
+	closed := 0
+	for _, m := range instances {
+		if m.IsClosed() {
+			closed++
+		}
+	}
+	if closed != 2 {
+		t.Fatalf("%d instances closed, expected 2", closed)
+	}
+}
+
+func TestWasmFailureClosesInstance(t *testing.T) {
+	// The returned span is beyond the module's single memory page
+	transformer := newTestWasmTransformer(t, "", 1<<48|8)
+	ctx := context.Background()
+	m, err := transformer.module.Load().instance(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transformer.module.Load().release(ctx, m)
+	span := &Span{Name: "select 1;"}
+	if !transformer.Transform(Row{}, span) || span.Name != "select 1;" {
+		t.Fatalf("span wasn't kept unchanged: %+v", span)
+	}
+	if !m.IsClosed() || len(transformer.module.Load().idle) != 0 {
+		t.Fatal("failed instance was put back")
+	}
+}
+
+func TestWasmTransformTimeout(t *testing.T) {
+	// transform loops forever
+	transformer := newTestWasmModule(t, wasmTestModuleCode("", []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b}))
+	transformer.timeout = 10 * time.Millisecond
+	span := &Span{Name: "select 1;"}
+	done := make(chan bool)
+	go func() { done <- transformer.Transform(Row{}, span) }()
+	select {
+	case keep := <-done:
+		if !keep || span.Name != "select 1;" {
+			t.Fatalf("span wasn't kept unchanged: %+v", span)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transform wasn't interrupted")
+	}
+	if len(transformer.module.Load().idle) != 0 {
+		t.Fatal("interrupted instance was put back")
+	}
+}
+
+func TestWasmTransformerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.wasm")
+	write := func(name string) {
+		output := `{"name":"` + name + `"}`
+		if err := os.WriteFile(path, wasmTestModule(output, int64(len(output))), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("first")
+	transformer, err := newWasmTransformer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { transformer.module.Load().runtime.Close(context.Background()) })
+	previous := transformer.module.Load()
+	if reloaded, err := newWasmTransformer(path); err != nil || reloaded.module.Load() != previous {
+		t.Fatalf("unchanged module was recompiled: %v", err)
+	}
+
+	write("second")
+	reloaded, err := newWasmTransformer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded != transformer || transformer.module.Load() == previous {
+		t.Fatal("changed module wasn't replaced")
+	}
+	if _, err := previous.instance(context.Background()); err == nil {
+		t.Fatal("replaced module's runtime wasn't closed")
+	}
+	span := &Span{}
+	if !transformer.Transform(Row{}, span) || span.Name != "second" {
+		t.Fatalf("span wasn't transformed by the changed module: %+v", span)
+	}
+}
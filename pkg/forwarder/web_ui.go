@@ -0,0 +1,130 @@
+package forwarder
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// webUITraces is the number of recent traces shown by the web UI
+const webUITraces = 50
+
+var webUITemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>pg_tracing forwarder</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.2em 1em; text-align: left; }
+.error { color: #c00; }
+pre { margin: 0.5em 0 1em 2em; }
+</style>
+</head>
+<body>
+<h1>pg_tracing forwarder</h1>
+{{range .Targets}}
+{{if .Name}}<h2>Target {{.Name}}</h2>{{end}}
+<h3>Throughput</h3>
+<table>
+<tr><th>Uptime</th><td>{{.Uptime}}</td></tr>
+<tr><th>Spans fetched</th><td>{{.Fetched}}</td></tr>
+<tr><th>Spans exported</th><td>{{.Exported}} ({{printf "%.1f" .Rate}} spans/s)</td></tr>
+<tr><th>Error spans</th><td{{if .Errors}} class="error"{{end}}>{{.Errors}} ({{printf "%.2f" .ErrorRate}}%)</td></tr>
+<tr><th>Duplicates dropped</th><td>{{.Duplicated}}</td></tr>
+<tr><th>Clock clamped / dropped</th><td>{{.ClockClamped}} / {{.ClockDropped}}</td></tr>
+</table>
+<h3>Recent traces</h3>
+{{range .Traces}}
+<details>
+<summary{{if .Errors}} class="error"{{end}}><code>{{.Id}}</code> {{.Start}} {{.Duration}}, {{.Spans}} spans{{if .Errors}}, {{.Errors}} errors{{end}}</summary>
+<pre>{{.Tree}}</pre>
+</details>
+{{else}}
+<p>No trace exported yet.</p>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+type webUITrace struct {
+	Id       string
+	Start    string
+	Duration string
+	Spans    int
+	Errors   int
+	Tree     string
+}
+
+type webUIPage struct {
+	Targets []webUITarget
+}
+
+type webUITarget struct {
+	Name         string
+	Uptime       time.Duration
+	Fetched      int64
+	Exported     int64
+	Rate         float64
+	Errors       int64
+	ErrorRate    float64
+	Duplicated   int64
+	ClockClamped int64
+	ClockDropped int64
+	Traces       []webUITrace
+}
+
+// serveWebUI renders a read-only page with the counters and recently
+// exported traces of each target
+func serveWebUI(targets func() []*target) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		var page webUIPage
+		for _, t := range targets() {
+			page.Targets = append(page.Targets, t.fw.webUITarget())
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := webUITemplate.Execute(w, page); err != nil {
+			log.Printf("Failed to render web UI: %v", err)
+		}
+	}
+}
+
+func (fw *targetForwarder) webUITarget() webUITarget {
+	uptime := time.Since(fw.started)
+	t := webUITarget{
+		Name:         fw.name,
+		Uptime:       uptime.Round(time.Second),
+		Fetched:      fw.stats.spansFetched.Load(),
+		Exported:     fw.stats.spansExported.Load(),
+		Errors:       fw.stats.spansErrored.Load(),
+		Duplicated:   fw.stats.spansDuplicated.Load(),
+		ClockClamped: fw.stats.spansClockClamped.Load(),
+		ClockDropped: fw.stats.spansClockDropped.Load(),
+	}
+	if uptime > 0 {
+		t.Rate = float64(t.Exported) / uptime.Seconds()
+	}
+	if t.Exported > 0 {
+		t.ErrorRate = 100 * float64(t.Errors) / float64(t.Exported)
+	}
+	for _, tr := range fw.recent.recent() {
+		t.Traces = append(t.Traces, webUITrace{
+			Id:       tr.traceId.String(),
+			Start:    tr.start.UTC().Format("2006-01-02 15:04:05.000"),
+			Duration: formatDuration(tr.end.Sub(tr.start)),
+			Spans:    len(tr.rows),
+			Errors:   tr.errors,
+			Tree:     strings.Join(renderTrace(nil, tr, 120, false), "\n"),
+		})
+	}
+	return t
+}
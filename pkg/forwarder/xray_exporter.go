@@ -0,0 +1,213 @@
+package forwarder
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultXRayDaemon = "127.0.0.1:2000"
+	xrayHeader        = "{\"format\": \"json\", \"version\": 1}\n"
+	// X-Ray rejects trace ids whose timestamp is older than 30 days
+	xrayMaxTraceAge = 30 * 24 * time.Hour
+	xrayMaxNameLen  = 200
+	// The daemon drops UDP documents above 64KB
+	xrayMaxDocument = 64 * 1024
+)
+
+// Characters X-Ray accepts in segment names and annotation keys
+var (
+	xrayInvalidName = regexp.MustCompile(`[^\p{L}\p{N}\p{Z}_.:/%&#=+\\\-@]`)
+	xrayInvalidKey  = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// xraySegment is a segment or subsegment document sent to the X-Ray daemon
+type xraySegment struct {
+	Name        string                    `json:"name"`
+	Id          string                    `json:"id"`
+	TraceId     string                    `json:"trace_id"`
+	ParentId    string                    `json:"parent_id,omitempty"`
+	Type        string                    `json:"type,omitempty"`
+	StartTime   float64                   `json:"start_time"`
+	EndTime     float64                   `json:"end_time"`
+	Fault       bool                      `json:"fault,omitempty"`
+	Cause       *xrayCause                `json:"cause,omitempty"`
+	Origin      string                    `json:"origin,omitempty"`
+	Sql         *xraySql                  `json:"sql,omitempty"`
+	Annotations map[string]any            `json:"annotations,omitempty"`
+	Metadata    map[string]map[string]any `json:"metadata,omitempty"`
+}
+
+type xrayCause struct {
+	Exceptions []xrayException `json:"exceptions"`
+}
+
+type xrayException struct {
+	Id      string `json:"id"`
+	Message string `json:"message"`
+}
+
+type xraySql struct {
+	DatabaseType    string `json:"database_type"`
+	DatabaseVersion string `json:"database_version,omitempty"`
+	User            string `json:"user,omitempty"`
+	SanitizedQuery  string `json:"sanitized_query,omitempty"`
+}
+
+// xrayExporter sends spans to the X-Ray daemon over UDP. Spans without a
+// local parent become segments, the others subsegments of their parent.
+type xrayExporter struct {
+	conn   net.Conn
+	origin string
+
+	mu sync.Mutex
+	// epochs remembers the timestamp part of the X-Ray trace ids, so all
+	// spans of a trace get the same id
+	epochs map[trace.TraceID]uint32
+	order  []trace.TraceID
+}
+
+func newXRayExporter(cfg XRayExporterConfig) (*xrayExporter, error) {
+	daemon := cfg.Daemon
+	if daemon == "" {
+		daemon = defaultXRayDaemon
+	}
+	conn, err := net.Dial("udp", daemon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to xray daemon: %w", err)
+	}
+	return &xrayExporter{conn: conn, origin: cfg.Origin, epochs: map[trace.TraceID]uint32{}}, nil
+}
+
+// xrayTraceId converts a trace id to X-Ray's 1-{epoch}-{96 bits} format.
+// Trace ids already starting with a recent timestamp, like the ones
+// generated by X-Ray aware propagators, are kept. pg_tracing's random ids
+// get the start of the trace's first span as epoch, followed by their first
+// 96 bits.
+func (e *xrayExporter) xrayTraceId(traceId trace.TraceID, start time.Time) string {
+	epoch := binary.BigEndian.Uint32(traceId[:4])
+	age := start.Sub(time.Unix(int64(epoch), 0))
+	if age >= 0 && age < xrayMaxTraceAge {
+		return fmt.Sprintf("1-%s-%s", hex.EncodeToString(traceId[:4]), hex.EncodeToString(traceId[4:]))
+	}
+	e.mu.Lock()
+	epoch, ok := e.epochs[traceId]
+	if !ok {
+		epoch = uint32(start.Unix())
+		if len(e.order) >= maxRoutedTraces {
+			delete(e.epochs, e.order[0])
+			e.order = e.order[1:]
+		}
+		e.epochs[traceId] = epoch
+		e.order = append(e.order, traceId)
+	}
+	e.mu.Unlock()
+	// The low 96 bits are kept, as the random part of W3C trace ids
+	return fmt.Sprintf("1-%08x-%s", epoch, hex.EncodeToString(traceId[4:]))
+}
+
+func xrayName(name string) string {
+	name, _ = truncateString(xrayInvalidName.ReplaceAllString(name, "_"), xrayMaxNameLen)
+	return name
+}
+
+func xrayTime(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func (e *xrayExporter) convert(span sdktrace.ReadOnlySpan) *xraySegment {
+	sc := span.SpanContext()
+	spanId := sc.SpanID()
+	seg := &xraySegment{
+		Id:          hex.EncodeToString(spanId[:]),
+		TraceId:     e.xrayTraceId(sc.TraceID(), span.StartTime()),
+		StartTime:   xrayTime(span.StartTime()),
+		EndTime:     xrayTime(span.EndTime()),
+		Annotations: map[string]any{},
+		Metadata:    map[string]map[string]any{"default": {}},
+	}
+	if span.Parent().IsValid() {
+		parentId := span.Parent().SpanID()
+		seg.ParentId = hex.EncodeToString(parentId[:])
+	}
+	sql := &xraySql{DatabaseType: "PostgreSQL"}
+	for _, attr := range span.Attributes() {
+		switch attr.Key {
+		case semconv.DBStatementKey:
+			sql.SanitizedQuery = attr.Value.Emit()
+		case semconv.DBUserKey:
+			sql.User = attr.Value.AsString()
+		case semconv.DBNameKey:
+			seg.Annotations[xrayInvalidKey.ReplaceAllString(string(attr.Key), "_")] = attr.Value.Emit()
+		}
+		switch attr.Value.Type() {
+		case attribute.BOOL, attribute.INT64, attribute.FLOAT64, attribute.STRING:
+			seg.Metadata["default"][string(attr.Key)] = attr.Value.AsInterface()
+		default:
+			seg.Metadata["default"][string(attr.Key)] = attr.Value.Emit()
+		}
+	}
+	sql.DatabaseVersion = resourceValue(span.Resource(), "db.version")
+
+	if span.Parent().IsValid() && !span.Parent().IsRemote() {
+		// Statements and plan nodes executed within their parent
+		seg.Type = "subsegment"
+		seg.Name = xrayName(span.Name())
+	} else {
+		seg.Name = xrayName(resourceValue(span.Resource(), semconv.ServiceNameKey))
+		if seg.Name == "" {
+			seg.Name = "PostgreSQL"
+		}
+		seg.Origin = e.origin
+		seg.Annotations["statement"] = span.Name()
+	}
+	if sql.SanitizedQuery != "" {
+		seg.Sql = sql
+	}
+	if span.Status().Code == codes.Error {
+		seg.Fault = true
+		seg.Cause = &xrayCause{Exceptions: []xrayException{{
+			Id:      seg.Id,
+			Message: span.Status().Description,
+		}}}
+	}
+	return seg
+}
+
+func (e *xrayExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, span := range spans {
+		seg := e.convert(span)
+		doc, err := json.Marshal(seg)
+		if err != nil {
+			return fmt.Errorf("failed to encode segment: %w", err)
+		}
+		if len(doc)+len(xrayHeader) > xrayMaxDocument {
+			// Metadata are the bulk of large documents
+			seg.Metadata = nil
+			if doc, err = json.Marshal(seg); err != nil {
+				return fmt.Errorf("failed to encode segment: %w", err)
+			}
+		}
+		if _, err := e.conn.Write(append([]byte(xrayHeader), doc...)); err != nil {
+			return fmt.Errorf("failed to send segment to xray daemon: %w", err)
+		}
+	}
+	return nil
+}
+
+func (e *xrayExporter) Shutdown(ctx context.Context) error {
+	return e.conn.Close()
+}
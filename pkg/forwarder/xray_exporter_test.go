@@ -0,0 +1,28 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestXRayTraceId(t *testing.T) {
+	e := &xrayExporter{epochs: map[trace.TraceID]uint32{}}
+	start := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		traceId trace.TraceID
+		want    string
+	}{
+		// Ids starting with a recent timestamp are kept
+		{traceIdOf(0x6553f100_00000001, 2), "1-6553f100-000000010000000000000002"},
+		// Other ids get the start's epoch followed by their low 96 bits
+		{traceIdOf(0, 2), "1-6553f100-000000000000000000000002"},
+		{traceIdOf(0, 3), "1-6553f100-000000000000000000000003"},
+		{traceIdOf(1, 0), "1-6553f100-000000010000000000000000"},
+	} {
+		if got := e.xrayTraceId(tc.traceId, start); got != tc.want {
+			t.Errorf("%s converted to %s, expected %s", tc.traceId, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package pgtracingreceiver
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bonnefoa/pg-tracing-otel-forwarder/pkg/forwarder"
+)
+
+// Config holds the forwarder settings, written in the receiver's section of
+// the collector configuration with the same keys as the forwarder's
+// configuration file. The exporter settings are ignored, spans are passed to
+// the next consumer of the pipeline.
+type Config struct {
+	Settings map[string]any `mapstructure:",remain"`
+}
+
+// forwarderConfig parses the settings as a forwarder configuration
+func (c *Config) forwarderConfig() (*forwarder.Config, error) {
+	content, err := yaml.Marshal(c.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode receiver settings: %w", err)
+	}
+	return forwarder.ParseConfig(content)
+}
+
+// Validate checks the forwarder settings
+func (c *Config) Validate() error {
+	_, err := c.forwarderConfig()
+	return err
+}
@@ -0,0 +1,27 @@
+// Package pgtracingreceiver is an OpenTelemetry Collector receiver consuming
+// the spans of pg_tracing, running the forwarder's pipeline in the collector.
+package pgtracingreceiver
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/receiver"
+)
+
+var typeStr = component.MustNewType("pgtracing")
+
+// NewFactory returns the factory of the pgtracing receiver
+func NewFactory() receiver.Factory {
+	return receiver.NewFactory(typeStr, createDefaultConfig,
+		receiver.WithTraces(createTracesReceiver, component.StabilityLevelAlpha))
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{}
+}
+
+func createTracesReceiver(ctx context.Context, set receiver.Settings, cfg component.Config, next consumer.Traces) (receiver.Traces, error) {
+	return newTracesReceiver(set, cfg.(*Config), next)
+}
@@ -0,0 +1,55 @@
+package pgtracingreceiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+)
+
+func TestFactory(t *testing.T) {
+	factory := NewFactory()
+	if factory.Type() != typeStr {
+		t.Fatalf("unexpected type %s", factory.Type())
+	}
+	cfg, ok := factory.CreateDefaultConfig().(*Config)
+	if !ok {
+		t.Fatalf("unexpected default config %T", factory.CreateDefaultConfig())
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	receiver, err := factory.CreateTracesReceiver(context.Background(), receivertest.NewNopSettings(), cfg, new(consumertest.TracesSink))
+	if err != nil || receiver == nil {
+		t.Fatalf("failed to create the receiver: %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cfg := &Config{Settings: map[string]any{"poll_interval": "1s", "orphans": "synthesize"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	fwdCfg, err := cfg.forwarderConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fwdCfg.PollInterval != time.Second || fwdCfg.Orphans != "synthesize" {
+		t.Fatalf("settings not applied: poll_interval %s, orphans %q", fwdCfg.PollInterval, fwdCfg.Orphans)
+	}
+
+	for _, settings := range []map[string]any{
+		{"orphans": "unknown"},
+		{"poll_interval": "soon"},
+	} {
+		cfg := &Config{Settings: settings}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%v: expected a validation error", settings)
+		}
+		if _, err := NewFactory().CreateTracesReceiver(context.Background(), receivertest.NewNopSettings(), cfg, new(consumertest.TracesSink)); err == nil {
+			t.Errorf("%v: receiver created from an invalid config", settings)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package pgtracingreceiver
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/receiver"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/bonnefoa/pg-tracing-otel-forwarder/pkg/forwarder"
+)
+
+// tracesReceiver runs a forwarder exporting to the next consumer
+type tracesReceiver struct {
+	set  receiver.Settings
+	cfg  *forwarder.Config
+	next consumer.Traces
+
+	exporter *otlptrace.Exporter
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func newTracesReceiver(set receiver.Settings, cfg *Config, next consumer.Traces) (*tracesReceiver, error) {
+	fwdCfg, err := cfg.forwarderConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &tracesReceiver{set: set, cfg: fwdCfg, next: next}, nil
+}
+
+func (r *tracesReceiver) Start(ctx context.Context, host component.Host) error {
+	exporter, err := otlptrace.New(ctx, &consumerClient{next: r.next})
+	if err != nil {
+		return fmt.Errorf("failed to create consumer exporter: %w", err)
+	}
+	fwd, err := forwarder.New(*r.cfg, forwarder.WithSpanExporter(exporter))
+	if err != nil {
+		return err
+	}
+	// The start context is only valid during Start
+	runCtx, cancel := context.WithCancel(context.Background())
+	r.exporter, r.cancel, r.done = exporter, cancel, make(chan struct{})
+	go func() {
+		defer close(r.done)
+		if err := fwd.Run(runCtx); err != nil {
+			r.set.Logger.Error("Forwarder stopped", zap.Error(err))
+			r.set.TelemetrySettings.ReportStatus(component.NewFatalErrorEvent(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the forwarder, once the buffered spans are passed to the
+// next consumer
+func (r *tracesReceiver) Shutdown(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return r.exporter.Shutdown(ctx)
+}
+
+// consumerClient is an otlptrace client passing the spans to the next
+// consumer
+type consumerClient struct {
+	next consumer.Traces
+}
+
+func (c *consumerClient) Start(ctx context.Context) error {
+	return nil
+}
+
+func (c *consumerClient) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (c *consumerClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	// pdata and the OTLP protos share the wire format
+	content, err := proto.Marshal(&collectortracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	traces, err := (&ptrace.ProtoUnmarshaler{}).UnmarshalTraces(content)
+	if err != nil {
+		return fmt.Errorf("failed to decode spans: %w", err)
+	}
+	return c.next.ConsumeTraces(ctx, traces)
+}
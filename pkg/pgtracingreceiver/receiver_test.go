@@ -0,0 +1,78 @@
+package pgtracingreceiver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestConsumerClient(t *testing.T) {
+	ctx := context.Background()
+	sink := new(consumertest.TracesSink)
+	exporter, err := otlptrace.New(ctx, &consumerClient{next: sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{15: 1},
+		SpanID:  trace.SpanID{7: 2},
+	})
+	spans := tracetest.SpanStubs{{
+		Name:        "select 1;",
+		SpanContext: spanContext,
+		StartTime:   start,
+		EndTime:     start.Add(time.Millisecond),
+	}}.Snapshots()
+	if err := exporter.ExportSpans(ctx, spans); err != nil {
+		t.Fatal(err)
+	}
+	if sink.SpanCount() != 1 {
+		t.Fatalf("%d spans consumed", sink.SpanCount())
+	}
+	span := sink.AllTraces()[0].ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	if span.Name() != "select 1;" || [16]byte(span.TraceID()) != [16]byte(spanContext.TraceID()) ||
+		[8]byte(span.SpanID()) != [8]byte(spanContext.SpanID()) {
+		t.Fatalf("unexpected span %s %s %s", span.Name(), span.TraceID(), span.SpanID())
+	}
+	if got := span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime()); got != time.Millisecond {
+		t.Fatalf("unexpected duration %s", got)
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReceiverStartShutdown runs the receiver against an unreachable
+// database, it must stop without touching the global providers
+func TestReceiverStartShutdown(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	cfg := &Config{Settings: map[string]any{
+		"poll_interval": "10ms",
+		"targets":       []any{map[string]any{"name": "unreachable", "dsn": "postgres://127.0.0.1:1/postgres?connect_timeout=1"}},
+	}}
+	receiver, err := NewFactory().CreateTracesReceiver(context.Background(), receivertest.NewNopSettings(), cfg, new(consumertest.TracesSink))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := receiver.Start(context.Background(), componenttest.NewNopHost()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := receiver.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if otel.GetTracerProvider() != provider || otel.GetTextMapPropagator() != propagator {
+		t.Fatal("the receiver replaced the global tracer provider or propagator")
+	}
+}